@@ -1,20 +1,238 @@
 package app
 
 import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/handlers"
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/cache"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/memory"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/postgres"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/sqlite"
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
 	"github.com/AndreyShep2012/go-company-handler/internal/config"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/changestream"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/dispatcher"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/jetstream"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/kafka"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/outbox"
 	"github.com/AndreyShep2012/go-company-handler/internal/events/simple"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
 	"github.com/AndreyShep2012/go-company-handler/internal/health"
 	"github.com/AndreyShep2012/go-company-handler/internal/version"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func setupRoutes(cfg config.Config, commonRoute, apiRoute fiber.Router, companiesCollection *mongo.Collection) {
-	companiesService := services.NewCompaniesService(repositories.NewCompaniesRepository(companiesCollection))
-	handlers.SetupCompaniesRoutes(apiRoute, companiesService, simple.New())
+// storage has repositories of the configured storage driver
+type storage struct {
+	companies services.CompaniesRepository
+	history   services.HistoryRepository
+	// outbox is nil when the events outbox is disabled
+	outbox outbox.Store
+	// changes and resumeTokens are nil when the events change stream is disabled
+	changes      changestream.Source
+	resumeTokens changestream.TokenStore
+	webhooks     webhook.Store
+}
+
+// initStorage returns repositories of the configured storage driver
+func initStorage(ctx context.Context, cfg config.Config) storage {
+	if cfg.EventsOutbox && cfg.StorageDriver != config.StorageDriverMongo {
+		panic("events outbox is supported by mongo storage only")
+	}
+	if cfg.EventsChangeStream && cfg.StorageDriver != config.StorageDriverMongo {
+		panic("events change stream is supported by mongo storage only")
+	}
+	if cfg.EventsOutbox && cfg.EventsChangeStream {
+		panic("events outbox and change stream can not be enabled together")
+	}
+
+	switch cfg.StorageDriver {
+	case config.StorageDriverMongo:
+		collection := initMongo(ctx, cfg.MongoUri, cfg.MongoDatabaseName, cfg.MongoCompaniesCollection, cfg.ConnectTimeoutSec)
+		historyCollection := initMongoHistory(ctx, collection.Database(), cfg.MongoHistoryCollection)
+		subscriptions, deliveries := initMongoWebhooks(ctx, collection.Database(), cfg.MongoWebhooksCollection, cfg.MongoDeliveriesCollection)
+		s := storage{
+			companies: repositories.NewCompaniesRepository(collection),
+			history:   repositories.NewHistoryRepository(historyCollection),
+			webhooks:  repositories.NewWebhooksRepository(subscriptions, deliveries),
+		}
+		if cfg.EventsChangeStream {
+			initMongoChangeStream(ctx, collection)
+			s.changes = repositories.NewCompaniesChangeStream(collection)
+			s.resumeTokens = repositories.NewResumeTokensRepository(collection.Database().Collection(cfg.MongoTokensCollection))
+		}
+		if !cfg.EventsOutbox {
+			return s
+		}
+
+		outboxCollection := initMongoOutbox(ctx, collection.Database(), cfg.MongoOutboxCollection)
+		s.companies = repositories.NewCompaniesRepository(collection, repositories.WithOutbox(outboxCollection))
+		s.outbox = repositories.NewOutboxRepository(outboxCollection)
+		return s
+	case config.StorageDriverPostgres:
+		pool := initPostgres(ctx, cfg.PostgresUri, cfg.ConnectTimeoutSec)
+		return storage{
+			companies: postgres.NewCompaniesRepository(pool),
+			history:   postgres.NewHistoryRepository(pool),
+			webhooks:  postgres.NewWebhooksRepository(pool),
+		}
+	case config.StorageDriverSQLite:
+		db := initSQLite(ctx, cfg.SQLitePath)
+		return storage{
+			companies: sqlite.NewCompaniesRepository(db),
+			history:   sqlite.NewHistoryRepository(db),
+			webhooks:  sqlite.NewWebhooksRepository(db),
+		}
+	case config.StorageDriverMemory:
+		slog.Warn("in-memory storage is used, data is lost on restart")
+		return storage{
+			companies: memory.NewCompaniesRepository(),
+			history:   memory.NewHistoryRepository(),
+			webhooks:  memory.NewWebhooksRepository(),
+		}
+	default:
+		panic("unknown storage driver: " + cfg.StorageDriver)
+	}
+}
+
+// initCache wraps the companies repository with the configured cache, nil cache is returned when cache is disabled
+func initCache(ctx context.Context, cfg config.Config, companies services.CompaniesRepository) (services.CompaniesRepository, *cache.Companies) {
+	var store cache.Store
+	switch cfg.CacheDriver {
+	case config.CacheDriverNone:
+		return companies, nil
+	case config.CacheDriverMemory:
+		store = cache.NewLRU(cfg.CacheSize, cfg.CacheTTL)
+	case config.CacheDriverRedis:
+		store = cache.NewRedis(initRedis(ctx, cfg.RedisUri, cfg.ConnectTimeoutSec), cfg.CacheTTL)
+	default:
+		panic("unknown cache driver: " + cfg.CacheDriver)
+	}
+
+	cached := cache.NewCompaniesRepository(companies, store)
+	return cached, cached
+}
+
+func initCompaniesService(cfg config.Config, companies services.CompaniesRepository, history services.HistoryRepository) *services.CompaniesService {
+	return services.NewCompaniesService(
+		companies,
+		services.WithPageLimits(cfg.ListDefaultLimit, cfg.ListMaxLimit),
+		services.WithHistory(history),
+	)
+}
+
+// storageIdFormat returns format of company ids generated by the storage driver
+func storageIdFormat(driver string) string {
+	if driver == config.StorageDriverPostgres {
+		return handlers.IdFormatUUID
+	}
+	return handlers.IdFormatObjectID
+}
+
+// initPublisher returns publisher of the company events, webhooks are nil unless the webhook publisher is configured
+func initPublisher(cfg config.Config, store webhook.Store) (outbox.Publisher, *webhook.Publisher) {
+	switch cfg.EventsPublisher {
+	case config.EventsPublisherLog:
+		return simple.New(), nil
+	case config.EventsPublisherWebhook:
+		webhooks := webhook.NewPublisher(
+			store,
+			webhook.WithHTTPClient(&http.Client{Timeout: cfg.WebhookTimeout}),
+			webhook.WithRetries(cfg.WebhookMaxAttempts, webhook.DefaultMinBackoff, cfg.WebhookMaxBackoff),
+			webhook.WithDeliveryTimeout(cfg.WebhookDeliveryTimeout),
+		)
+		return webhooks, webhooks
+	case config.EventsPublisherNATS:
+		publisher := jetstream.NewPublisher(
+			initJetStream(cfg.NatsUri, cfg.ConnectTimeoutSec),
+			jetstream.WithSubjectPrefix(cfg.NatsSubjectPrefix),
+			jetstream.WithTimeout(cfg.NatsTimeout),
+		)
+		if err := publisher.EnsureStream(cfg.NatsStream, cfg.NatsDuplicateWindow); err != nil {
+			panic("failed to create jetstream stream: " + err.Error())
+		}
+		return publisher, nil
+	case config.EventsPublisherKafka:
+		writer, err := kafka.NewWriter(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaAcks, cfg.KafkaBatchSize, cfg.KafkaBatchTimeout)
+		if err != nil {
+			panic("failed to create kafka writer: " + err.Error())
+		}
+		slog.Info("publishing events to kafka", "brokers", cfg.KafkaBrokers, "topic", cfg.KafkaTopic, "acks", cfg.KafkaAcks)
+		return kafka.NewPublisher(writer, kafka.WithTimeout(cfg.KafkaTimeout)), nil
+	default:
+		panic("unknown events publisher: " + cfg.EventsPublisher)
+	}
+}
+
+// initDispatcher returns dispatcher publishing events of the handlers in background
+func initDispatcher(cfg config.Config, publisher dispatcher.Publisher) *dispatcher.Dispatcher {
+	switch cfg.EventsOverflow {
+	case config.EventsOverflowBlock, config.EventsOverflowDropOldest, config.EventsOverflowReject:
+	default:
+		panic("unknown events overflow policy: " + cfg.EventsOverflow)
+	}
+
+	if cfg.EventsWorkers <= 0 {
+		panic("events workers should be positive: " + strconv.Itoa(cfg.EventsWorkers))
+	}
+	if cfg.EventsQueueSize <= 0 {
+		panic("events queue size should be positive: " + strconv.Itoa(cfg.EventsQueueSize))
+	}
+
+	return dispatcher.New(
+		publisher,
+		dispatcher.WithQueueSize(cfg.EventsQueueSize),
+		dispatcher.WithWorkers(cfg.EventsWorkers),
+		dispatcher.WithPolicy(cfg.EventsOverflow),
+	)
+}
+
+// drainDispatcher publishes events left in the queue, it gives up after the drain timeout
+func drainDispatcher(cfg config.Config, d *dispatcher.Dispatcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.EventsDrainTimeout)
+	defer cancel()
+
+	if err := d.Shutdown(ctx); err != nil {
+		slog.Error("failed to publish queued events", "error", err.Error())
+		return
+	}
+	slog.Info("events queue drained")
+}
+
+// initOutboxRelay returns relay delivering events of the outbox to the publisher
+func initOutboxRelay(cfg config.Config, store outbox.Store, publisher outbox.Publisher) *outbox.Relay {
+	return outbox.NewRelay(
+		store,
+		publisher,
+		outbox.WithInterval(cfg.OutboxInterval),
+		outbox.WithBackoff(outbox.DefaultMinBackoff, cfg.OutboxMaxBackoff),
+	)
+}
+
+// initChangeStreamWatcher returns watcher publishing events of the companies collection changes
+func initChangeStreamWatcher(cfg config.Config, s storage, publisher changestream.Publisher) *changestream.Watcher {
+	return changestream.NewWatcher(
+		s.changes,
+		s.resumeTokens,
+		publisher,
+		changestream.WithName(cfg.ChangeStreamName),
+		changestream.WithBackoff(changestream.DefaultMinBackoff, cfg.ChangeStreamMaxBackoff),
+	)
+}
+
+// setupRoutes registers the routes, publisher gets events of the changes made by the handlers
+func setupRoutes(commonRoute, apiRoute fiber.Router, companiesService *services.CompaniesService, publisher handlers.EventsPublisher, idFormat string, companiesCache *cache.Companies, webhooks *webhook.Publisher, stream handlers.EventsStream, auth fiber.Handler) {
+	handlers.SetupCompaniesRoutes(apiRoute, companiesService, publisher, handlers.WithIdFormat(idFormat), handlers.WithEventsStream(stream))
+	if webhooks != nil {
+		handlers.SetupWebhooksRoutes(apiRoute, webhooks, auth)
+	}
+	if companiesCache != nil {
+		handlers.SetupCacheRoutes(commonRoute, companiesCache)
+	}
 
 	// setup unprotected routes
 	version.SetupVersionHandler(commonRoute)
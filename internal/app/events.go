@@ -0,0 +1,72 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/handlers"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/dispatcher"
+)
+
+// fanOut passes every event to all publishers, failure of one of them does not stop the others
+type fanOut []handlers.EventsPublisher
+
+func (f fanOut) OnCreateCompany(e events.CompanyCreated) error {
+	return f.each(func(p handlers.EventsPublisher) error { return p.OnCreateCompany(e) })
+}
+
+func (f fanOut) OnPatchCompany(e events.CompanyUpdated) error {
+	return f.each(func(p handlers.EventsPublisher) error { return p.OnPatchCompany(e) })
+}
+
+func (f fanOut) OnDeleteCompany(e events.CompanyDeleted) error {
+	return f.each(func(p handlers.EventsPublisher) error { return p.OnDeleteCompany(e) })
+}
+
+// Admit refuses events when any of the publishers refuses them
+func (f fanOut) Admit(count int) error {
+	for _, p := range f {
+		if admitter, ok := p.(interface{ Admit(count int) error }); ok {
+			if err := admitter.Admit(count); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Admitted returns publishers for events of the admitted changes, the ones which refuse events wait for room instead
+func (f fanOut) Admitted() handlers.EventsPublisher {
+	res := make(fanOut, 0, len(f))
+	for _, p := range f {
+		if admitter, ok := p.(interface{ Admitted() dispatcher.Publisher }); ok {
+			p = admitter.Admitted()
+		}
+		res = append(res, p)
+	}
+
+	return res
+}
+
+// Blocking returns publishers which wait for room for the events instead of refusing them
+func (f fanOut) Blocking() handlers.EventsPublisher {
+	res := make(fanOut, 0, len(f))
+	for _, p := range f {
+		if blocking, ok := p.(interface{ Blocking() dispatcher.Publisher }); ok {
+			p = blocking.Blocking()
+		}
+		res = append(res, p)
+	}
+
+	return res
+}
+
+func (f fanOut) each(publish func(handlers.EventsPublisher) error) error {
+	var errs []error
+	for _, p := range f {
+		errs = append(errs, publish(p))
+	}
+
+	return errors.Join(errs...)
+}
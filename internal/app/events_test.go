@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/config"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/broadcast"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/dispatcher"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanOut(t *testing.T) {
+	broadcaster := broadcast.New(10)
+	failing := &mockFailingPublisher{err: errors.New("error")}
+	publisher := fanOut{failing, broadcaster}
+
+	err := publisher.OnCreateCompany(events.CompanyCreated{Metadata: events.Metadata{ID: "1"}})
+	require.ErrorIs(t, err, failing.err)
+
+	// the event is passed to the next publisher despite the failure
+	missed, _ := broadcaster.Subscribe("0")
+	require.Len(t, missed, 1)
+	require.Equal(t, "1", missed[0].Meta().ID)
+
+	require.NoError(t, publisher.Admit(1))
+
+	closed := dispatcher.New(failing)
+	require.NoError(t, closed.Shutdown(context.Background()))
+	require.ErrorIs(t, fanOut{broadcaster, closed}.Admit(1), dispatcher.ErrClosed{})
+
+	// dispatcher is replaced by its blocking publisher, it still refuses events after shutdown
+	blocking := fanOut{broadcaster, closed}.Blocking()
+	require.ErrorIs(t, blocking.OnCreateCompany(events.CompanyCreated{Metadata: events.Metadata{ID: "2"}}), dispatcher.ErrClosed{})
+	missed, _ = broadcaster.Subscribe("1")
+	require.Len(t, missed, 1)
+	require.Equal(t, "2", missed[0].Meta().ID)
+
+	admitted := fanOut{broadcaster, closed}.Admitted()
+	require.ErrorIs(t, admitted.OnCreateCompany(events.CompanyCreated{Metadata: events.Metadata{ID: "3"}}), dispatcher.ErrClosed{})
+	missed, _ = broadcaster.Subscribe("2")
+	require.Len(t, missed, 1)
+	require.Equal(t, "3", missed[0].Meta().ID)
+}
+
+func TestInitDispatcher(t *testing.T) {
+	cfg := config.Config{EventsOverflow: config.EventsOverflowBlock, EventsWorkers: 1, EventsQueueSize: 1}
+	d := initDispatcher(cfg, &mockFailingPublisher{})
+	require.NoError(t, d.Shutdown(context.Background()))
+
+	for _, invalid := range []config.Config{
+		{EventsOverflow: "unknown", EventsWorkers: 1, EventsQueueSize: 1},
+		{EventsOverflow: config.EventsOverflowBlock, EventsWorkers: 0, EventsQueueSize: 1},
+		{EventsOverflow: config.EventsOverflowBlock, EventsWorkers: 1, EventsQueueSize: -1},
+	} {
+		require.Panics(t, func() { initDispatcher(invalid, &mockFailingPublisher{}) })
+	}
+}
+
+type mockFailingPublisher struct {
+	err error
+}
+
+func (m *mockFailingPublisher) OnCreateCompany(events.CompanyCreated) error {
+	return m.err
+}
+
+func (m *mockFailingPublisher) OnPatchCompany(events.CompanyUpdated) error {
+	return m.err
+}
+
+func (m *mockFailingPublisher) OnDeleteCompany(events.CompanyDeleted) error {
+	return m.err
+}
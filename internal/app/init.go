@@ -2,7 +2,10 @@ package app
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -10,16 +13,30 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/postgres"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/sqlite"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/golang-jwt/jwt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
 	slogfiber "github.com/samber/slog-fiber"
-	"gopkg.in/mgo.v2/bson"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	// outboxRetention is how long delivered events are kept in the outbox
+	outboxRetention = 7 * 24 * time.Hour
+	// webhookDeliveriesRetention is how long attempts to deliver events to webhooks are kept
+	webhookDeliveriesRetention = 30 * 24 * time.Hour
+)
+
 func initLogger(level string) {
 	logLevel := slog.LevelInfo
 	switch level {
@@ -41,12 +58,16 @@ func initLogger(level string) {
 func initFiberServer(apiRoot, jwtKey string) (*fiber.App, fiber.Router) {
 	fiberServer := fiber.New(fiber.Config{
 		CaseSensitive: false,
+		// import reads the file as a stream, so it is not limited by BodyLimit, other bodies are limited by middleware
+		StreamRequestBody: true,
 	})
 
 	fiberServer.Use(panicMiddleware())
+	fiberServer.Use(bodyLimitMiddleware(fiber.DefaultBodyLimit, isImport))
 
 	apiRouter := fiberServer.Group(apiRoot)
 	apiRouter.Use(requestid.New())
+	apiRouter.Use(requestContextMiddleware())
 	apiRouter.Use(jwtMiddleware([]byte(jwtKey)))
 
 	extendedLogs := false
@@ -54,12 +75,27 @@ func initFiberServer(apiRoot, jwtKey string) (*fiber.App, fiber.Router) {
 		extendedLogs = true
 	}
 
-	config := slogfiber.Config{WithRequestBody: extendedLogs, WithResponseBody: extendedLogs, WithRequestHeader: extendedLogs, WithResponseHeader: extendedLogs}
+	config := slogfiber.Config{
+		WithRequestBody:    extendedLogs,
+		WithResponseBody:   extendedLogs,
+		WithRequestHeader:  extendedLogs,
+		WithResponseHeader: extendedLogs,
+		// logger reads the whole response body, which never ends for the events stream
+		Filters: []slogfiber.Filter{ignoreEventStream},
+	}
 	apiRouter.Use(slogfiber.NewWithConfig(slog.Default(), config))
 
 	return fiberServer, apiRouter
 }
 
+func isImport(c *fiber.Ctx) bool {
+	return c.Method() == http.MethodPost && strings.HasSuffix(c.Path(), "/companies/import")
+}
+
+func ignoreEventStream(c *fiber.Ctx) bool {
+	return !strings.HasPrefix(string(c.Response().Header.ContentType()), "text/event-stream")
+}
+
 func initMongo(ctx context.Context, mongoUri, databaseName, collectionName string, connectTimeoutSec int) *mongo.Collection {
 	slog.Info("connecting to mongo: ", "uri", mongoUri, "timeout", connectTimeoutSec)
 
@@ -76,9 +112,15 @@ func initMongo(ctx context.Context, mongoUri, databaseName, collectionName strin
 
 	collection := client.Database(databaseName).Collection(collectionName)
 
-	// Create a unique index on the name field
+	// Drop the unique index on the name field created by previous versions,
+	// it does not let to create a company with the name of a deleted one
+	if _, err := collection.Indexes().DropOne(ctx, "name_1"); err != nil && !isIndexNotFound(err) {
+		panic("failed to drop unique index on name field: " + err.Error())
+	}
+
+	// Create a unique index on the name field, deleted companies have deleted_at set so they do not conflict
 	indexModel := mongo.IndexModel{
-		Keys:    bson.M{"name": 1},
+		Keys:    bson.D{{Key: "name", Value: 1}, {Key: "deleted_at", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	}
 	_, err = collection.Indexes().CreateOne(ctx, indexModel)
@@ -86,10 +128,186 @@ func initMongo(ctx context.Context, mongoUri, databaseName, collectionName strin
 		panic("failed to create unique index on name field: " + err.Error())
 	}
 
+	if err := repositories.FillMissingMetadata(ctx, collection); err != nil {
+		panic("failed to fill missing metadata of companies: " + err.Error())
+	}
+
+	// Create indexes for the fields companies list can be filtered and sorted by
+	listIndexModels := []mongo.IndexModel{
+		{Keys: bson.M{"type": 1}},
+		{Keys: bson.M{"registered": 1}},
+		{Keys: bson.M{"amount_of_employees": 1}},
+		{Keys: bson.M{"deleted_at": 1}},
+		{Keys: bson.M{"created_at": 1}},
+		{Keys: bson.M{"created_by": 1}},
+		{Keys: bson.M{"updated_at": 1}},
+		{Keys: bson.M{"updated_by": 1}},
+	}
+	_, err = collection.Indexes().CreateMany(ctx, listIndexModels)
+	if err != nil {
+		panic("failed to create list indexes: " + err.Error())
+	}
+
+	// Create a text index for the companies search, name matches are more relevant than description ones
+	textIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"name": "text", "description": "text"},
+		Options: options.Index().SetName("companies_text").SetWeights(bson.M{"name": 10, "description": 1}),
+	}
+	_, err = collection.Indexes().CreateOne(ctx, textIndexModel)
+	if err != nil {
+		panic("failed to create text index: " + err.Error())
+	}
+
 	slog.Info("connected to mongo")
 	return collection
 }
 
+func initMongoHistory(ctx context.Context, database *mongo.Database, collectionName string) *mongo.Collection {
+	collection := database.Collection(collectionName)
+
+	// Create indexes the company history is listed and the company past state is looked up by
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		panic("failed to create history indexes: " + err.Error())
+	}
+
+	return collection
+}
+
+// initMongoOutbox returns collection of the events outbox, delivered events are removed after a week
+func initMongoOutbox(ctx context.Context, database *mongo.Database, collectionName string) *mongo.Collection {
+	collection := database.Collection(collectionName)
+
+	indexModels := []mongo.IndexModel{
+		// due events are claimed without reading the ones which are not due
+		{Keys: bson.D{{Key: "delivered_at", Value: 1}, {Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}},
+		// the oldest pending event of the company is found to keep events of the company in order
+		{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "delivered_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.M{"delivered_at": 1}, Options: options.Index().SetExpireAfterSeconds(int32(outboxRetention.Seconds()))},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		panic("failed to create outbox indexes: " + err.Error())
+	}
+
+	return collection
+}
+
+// initMongoChangeStream enables pre- and post-images of the companies collection, so the change stream has companies
+// before and after the change. Without them events of updates have no changes and can have newer company
+func initMongoChangeStream(ctx context.Context, collection *mongo.Collection) {
+	command := bson.D{
+		{Key: "collMod", Value: collection.Name()},
+		{Key: "changeStreamPreAndPostImages", Value: bson.M{"enabled": true}},
+	}
+	if err := collection.Database().RunCommand(ctx, command).Err(); err != nil {
+		slog.Warn("failed to enable pre- and post-images of companies collection, updated events have no changes", "error", err.Error())
+	}
+}
+
+// initMongoWebhooks returns collections of webhook subscriptions and their deliveries, deliveries are removed after a month
+func initMongoWebhooks(ctx context.Context, database *mongo.Database, subscriptionsName, deliveriesName string) (*mongo.Collection, *mongo.Collection) {
+	deliveries := database.Collection(deliveriesName)
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.M{"timestamp": 1}, Options: options.Index().SetExpireAfterSeconds(int32(webhookDeliveriesRetention.Seconds()))},
+	}
+	if _, err := deliveries.Indexes().CreateMany(ctx, indexModels); err != nil {
+		panic("failed to create webhook deliveries indexes: " + err.Error())
+	}
+
+	return database.Collection(subscriptionsName), deliveries
+}
+
+func initPostgres(ctx context.Context, postgresUri string, connectTimeoutSec int) *pgxpool.Pool {
+	poolConfig, err := pgxpool.ParseConfig(postgresUri)
+	if err != nil {
+		panic("failed to parse postgres uri: " + err.Error())
+	}
+	poolConfig.ConnConfig.ConnectTimeout = time.Duration(connectTimeoutSec) * time.Second
+
+	slog.Info("connecting to postgres: ", "host", poolConfig.ConnConfig.Host, "database", poolConfig.ConnConfig.Database, "timeout", connectTimeoutSec)
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		panic("failed to connect to postgres: " + err.Error())
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		panic("failed to ping postgres: " + err.Error())
+	}
+
+	if err := postgres.Migrate(ctx, pool); err != nil {
+		panic("failed to migrate postgres: " + err.Error())
+	}
+
+	slog.Info("connected to postgres")
+	return pool
+}
+
+func initSQLite(ctx context.Context, path string) *sql.DB {
+	slog.Info("opening sqlite database: ", "path", path)
+
+	db, err := sqlite.Open(path)
+	if err != nil {
+		panic("failed to open sqlite database: " + err.Error())
+	}
+
+	if err := sqlite.Migrate(ctx, db); err != nil {
+		panic("failed to migrate sqlite database: " + err.Error())
+	}
+
+	slog.Info("opened sqlite database")
+	return db
+}
+
+func initRedis(ctx context.Context, redisUri string, connectTimeoutSec int) *redis.Client {
+	redisOptions, err := redis.ParseURL(redisUri)
+	if err != nil {
+		panic("failed to parse redis uri: " + err.Error())
+	}
+	redisOptions.DialTimeout = time.Duration(connectTimeoutSec) * time.Second
+
+	slog.Info("connecting to redis: ", "addr", redisOptions.Addr, "db", redisOptions.DB, "timeout", connectTimeoutSec)
+
+	client := redis.NewClient(redisOptions)
+	if err := client.Ping(ctx).Err(); err != nil {
+		panic("failed to ping redis: " + err.Error())
+	}
+
+	slog.Info("connected to redis")
+	return client
+}
+
+func initJetStream(natsUri string, connectTimeoutSec int) nats.JetStreamContext {
+	slog.Info("connecting to nats: ", "uri", natsUri, "timeout", connectTimeoutSec)
+
+	nc, err := nats.Connect(natsUri, nats.Timeout(time.Duration(connectTimeoutSec)*time.Second), nats.Name("company-handler"))
+	if err != nil {
+		panic("failed to connect to nats: " + err.Error())
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		panic("failed to get jetstream: " + err.Error())
+	}
+
+	slog.Info("connected to nats")
+	return js
+}
+
+// isIndexNotFound checks if the error is returned for the missing index or collection
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code == 26 || cmdErr.Code == 27 // NamespaceNotFound, IndexNotFound
+	}
+	return false
+}
+
 func panicMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) (err error) {
 		defer func() {
@@ -107,12 +325,55 @@ func panicMiddleware() fiber.Handler {
 	}
 }
 
+// bodyLimitMiddleware reads streamed request body into memory and rejects it when it is longer than limit,
+// requests which read the stream themselves are skipped
+func bodyLimitMiddleware(limit int, skip func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		stream := c.Context().RequestBodyStream()
+		if stream == nil || skip(c) {
+			return c.Next()
+		}
+
+		body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+		if err != nil {
+			return fiber.ErrBadRequest
+		}
+		if len(body) > limit {
+			return fiber.ErrRequestEntityTooLarge
+		}
+
+		c.Request().SetBody(body)
+		return c.Next()
+	}
+}
+
+// requestContextMiddleware puts id of the request generated by requestid middleware to the user context
+func requestContextMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if requestID, ok := c.Locals("requestid").(string); ok {
+			c.SetUserContext(reqctx.WithRequestID(c.UserContext(), requestID))
+		}
+
+		return c.Next()
+	}
+}
+
+// jwtMiddleware checks the token of the requests changing data, GET requests are public,
+// the ones which are not should check the token with jwtAuth
 func jwtMiddleware(secretKey []byte) fiber.Handler {
-	return func(c *fiber.Ctx) (err error) {
+	auth := jwtAuth(secretKey)
+	return func(c *fiber.Ctx) error {
 		if c.Method() == http.MethodGet {
 			return c.Next()
 		}
 
+		return auth(c)
+	}
+}
+
+// jwtAuth rejects requests without valid token, subject of the token is put to the user context as the actor
+func jwtAuth(secretKey []byte) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
 		tokenString := c.Get("Authorization")
 		if tokenString == "" {
 			slog.Debug("get empty Authorization header")
@@ -136,6 +397,12 @@ func jwtMiddleware(secretKey []byte) fiber.Handler {
 			return fiber.ErrUnauthorized
 		}
 
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			if subject, ok := claims["sub"].(string); ok {
+				c.SetUserContext(reqctx.WithActor(c.UserContext(), subject))
+			}
+		}
+
 		slog.Debug("token parsed successfully")
 		return c.Next()
 	}
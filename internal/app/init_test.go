@@ -1,11 +1,16 @@
 package app
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/require"
 )
 
@@ -34,3 +39,94 @@ func TestPanicMiddleware(t *testing.T) {
 	response.Body.Close()
 	require.Equal(t, fiber.StatusInternalServerError, response.StatusCode)
 }
+
+func TestRequestContextMiddleware(t *testing.T) {
+	fiberApp := fiber.New(fiber.Config{})
+	fiberApp.Use(requestid.New())
+	fiberApp.Use(requestContextMiddleware())
+	fiberApp.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString(reqctx.RequestID(c.UserContext()))
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "request")
+	response, err := fiberApp.Test(req)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, "request", string(body))
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	fiberApp := fiber.New(fiber.Config{StreamRequestBody: true})
+	fiberApp.Use(bodyLimitMiddleware(4, func(c *fiber.Ctx) bool { return c.Path() == "/stream" }))
+	fiberApp.Post("/body", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	fiberApp.Post("/stream", func(c *fiber.Ctx) error {
+		body, err := io.ReadAll(c.Context().RequestBodyStream())
+		if err != nil {
+			return err
+		}
+		return c.Send(body)
+	})
+
+	doTest := func(target, body string, expectedStatus int, expectedBody string) {
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, expectedStatus, response.StatusCode)
+
+		if expectedBody != "" {
+			data, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+			require.Equal(t, expectedBody, string(data))
+		}
+	}
+
+	doTest("/body", "body", fiber.StatusOK, "body")
+	doTest("/body", "long body", fiber.StatusRequestEntityTooLarge, "")
+	doTest("/stream", "long body", fiber.StatusOK, "long body")
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	secretKey := []byte("secret")
+	fiberApp := fiber.New(fiber.Config{})
+	fiberApp.Use(jwtMiddleware(secretKey))
+	handler := func(c *fiber.Ctx) error {
+		return c.SendString(reqctx.Actor(c.UserContext()))
+	}
+	fiberApp.Get("/public", handler)
+	fiberApp.Get("/private", jwtAuth(secretKey), handler)
+	fiberApp.Post("/public", handler)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user"}).SignedString(secretKey)
+	require.NoError(t, err)
+
+	doTest := func(method, target, token string, expectedStatus int, expectedBody string) {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, expectedStatus, response.StatusCode, method+" "+target)
+
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		if expectedStatus == fiber.StatusOK {
+			require.Equal(t, expectedBody, string(body))
+		}
+	}
+
+	doTest("GET", "/public", "", fiber.StatusOK, "")
+	doTest("GET", "/private", "", fiber.StatusUnauthorized, "")
+	doTest("GET", "/private", "broken", fiber.StatusUnauthorized, "")
+	doTest("GET", "/private", token, fiber.StatusOK, "user")
+	doTest("POST", "/public", "", fiber.StatusUnauthorized, "")
+	doTest("POST", "/public", token, fiber.StatusOK, "user")
+}
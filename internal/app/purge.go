@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type companiesPurger interface {
+	Purge(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// runPurge periodically removes deleted companies which retention period is over, it returns when ctx is done.
+// Not positive interval disables the purge
+func runPurge(ctx context.Context, purger companiesPurger, interval, retention time.Duration) {
+	if interval <= 0 {
+		slog.Info("purge of deleted companies is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := purger.Purge(ctx, retention)
+			if err != nil {
+				slog.Error("failed to purge deleted companies", "error", err.Error())
+				continue
+			}
+
+			if purged > 0 {
+				slog.Info("deleted companies purged", "count", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPurge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	purger := &mockPurger{t: t, expectedRetention: time.Hour, returnError: errors.New("error")}
+	done := make(chan struct{})
+	go func() {
+		runPurge(ctx, purger, 10*time.Millisecond, time.Hour)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return purger.calls.Load() >= 2
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "purge is not stopped")
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		purger := &mockPurger{t: t}
+		runPurge(context.Background(), purger, 0, time.Hour)
+		require.Zero(t, purger.calls.Load())
+	})
+}
+
+type mockPurger struct {
+	t                 *testing.T
+	expectedRetention time.Duration
+	returnError       error
+	calls             atomic.Int32
+}
+
+func (m *mockPurger) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	require.Equal(m.t, m.expectedRetention, retention)
+	m.calls.Add(1)
+	return 0, m.returnError
+}
@@ -9,6 +9,8 @@ import (
 	"syscall"
 
 	"github.com/AndreyShep2012/go-company-handler/internal/config"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/broadcast"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/dispatcher"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -18,8 +20,22 @@ func Serve(config config.Config) {
 
 	initLogger(config.LogLevel)
 	fiberServer, api := initFiberServer(config.ApiRoot, config.JWTSecretKey)
-	collection := initMongo(mainCtx, config.MongoUri, config.MongoDatabaseName, config.MongoCompaniesCollection, config.ConnectTimeoutSec)
-	setupRoutes(config, fiberServer, api, collection)
+	storage := initStorage(mainCtx, config)
+	companies, companiesCache := initCache(mainCtx, config, storage.companies)
+	companiesService := initCompaniesService(config, companies, storage.history)
+
+	publisher, webhooks := initPublisher(config, storage.webhooks)
+	// events stream gets events from the handlers, it does not wait for the outbox
+	broadcaster := broadcast.New(config.EventsStreamBuffer)
+	handlersPublisher := fanOut{broadcaster}
+	// with outbox events are written by the storage and delivered by the relay, and with change stream
+	// they are read from the storage by the watcher, so handlers do not publish them
+	var eventsDispatcher *dispatcher.Dispatcher
+	if storage.outbox == nil && storage.changes == nil {
+		eventsDispatcher = initDispatcher(config, publisher)
+		handlersPublisher = append(handlersPublisher, eventsDispatcher)
+	}
+	setupRoutes(fiberServer, api, companiesService, handlersPublisher, storageIdFormat(config.StorageDriver), companiesCache, webhooks, broadcaster, jwtAuth([]byte(config.JWTSecretKey)))
 
 	g, gCtx := errgroup.WithContext(mainCtx)
 
@@ -27,10 +43,37 @@ func Serve(config config.Config) {
 		return fiberServer.Listen(config.ListenAddr)
 	})
 
+	g.Go(func() error {
+		runPurge(gCtx, companiesService, config.PurgeInterval, config.DeletedRetention)
+		return nil
+	})
+
+	if storage.outbox != nil {
+		relay := initOutboxRelay(config, storage.outbox, publisher)
+		g.Go(func() error {
+			relay.Run(gCtx)
+			return nil
+		})
+	}
+
+	if storage.changes != nil {
+		watcher := initChangeStreamWatcher(config, storage, publisher)
+		g.Go(func() error {
+			watcher.Run(gCtx)
+			return nil
+		})
+	}
+
 	g.Go(func() error {
 		<-gCtx.Done()
+		// open events streams would keep the server from shutting down
+		broadcaster.Close()
 		fiberServer.Shutdown()
 		slog.Info("server shutdown")
+		// requests are finished, so no more events are queued
+		if eventsDispatcher != nil {
+			drainDispatcher(config, eventsDispatcher)
+		}
 		return gCtx.Err()
 	})
 
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/cache"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CacheStats interface {
+	Stats() cache.Stats
+}
+
+// SetupCacheRoutes exposes hit and miss counters of the companies cache
+func SetupCacheRoutes(r fiber.Router, stats CacheStats) {
+	r.Get("/cache/stats", func(c *fiber.Ctx) error {
+		return c.JSON(stats.Stats())
+	})
+}
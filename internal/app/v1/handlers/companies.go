@@ -2,29 +2,92 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"time"
 
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/broadcast"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 )
 
 type CompaniesService interface {
 	Create(ctx context.Context, company services.Company) (services.Company, error)
+	CreateMany(ctx context.Context, companies []services.Company) ([]services.Company, []error)
+	UpsertByName(ctx context.Context, company services.Company) (services.CompanyChange, error)
 	Get(ctx context.Context, id string) (services.Company, error)
-	Update(ctx context.Context, update services.CompanyUpdate) error
-	Delete(ctx context.Context, id string) error
+	GetAsOf(ctx context.Context, id string, asOf time.Time) (services.Company, error)
+	List(ctx context.Context, query services.ListQuery) (services.CompaniesPage, error)
+	Search(ctx context.Context, query services.SearchQuery) ([]services.SearchResult, error)
+	Export(ctx context.Context, filter services.CompanyFilter, fn func(services.Company) error) error
+	Update(ctx context.Context, update services.CompanyUpdate) (services.CompanyChange, error)
+	Delete(ctx context.Context, id string, version int64) error
+	Restore(ctx context.Context, id string) (services.Company, error)
+	History(ctx context.Context, query services.HistoryQuery) (services.HistoryPage, error)
 }
 
 type EventsPublisher interface {
-	OnCreateCompany(e any)
-	OnPatchCompany(e any)
-	OnDeleteCompany(e any)
+	OnCreateCompany(e events.CompanyCreated) error
+	OnPatchCompany(e events.CompanyUpdated) error
+	OnDeleteCompany(e events.CompanyDeleted) error
+}
+
+// EventsAdmitter is implemented by publishers which can refuse events while they are overloaded,
+// changes are rejected before they are applied then, so no change is left without its event
+type EventsAdmitter interface {
+	// Admit reports whether the given number of events would be accepted now
+	Admit(count int) error
+	// Admitted returns publisher for events of the admitted changes, it does not refuse them
+	Admitted() EventsPublisher
+}
+
+// BlockingEventsPublisher is implemented by publishers which can refuse events, Blocking returns publisher
+// which waits for room instead. Changes of many companies are admitted as a whole and use it for their events
+type BlockingEventsPublisher interface {
+	Blocking() EventsPublisher
+}
+
+// retryAfterSec is how long clients are asked to wait before retrying the change rejected because of the events backlog
+const retryAfterSec = "1"
+
+const (
+	// IdFormatObjectID is hex encoded MongoDB ObjectID, ids of mongo and memory storages have this format
+	IdFormatObjectID = "mongodb"
+	// IdFormatUUID is canonical UUID, ids of postgres storage have this format
+	IdFormatUUID = "uuid"
+)
+
+// EventsStream is source of the company events streamed to clients
+type EventsStream interface {
+	Subscribe(lastEventID string) ([]events.Event, *broadcast.Subscription)
+	Unsubscribe(s *broadcast.Subscription)
 }
 
 type companiesHandler struct {
 	srv             CompaniesService
 	validator       *validator.Validate
 	eventsPublisher EventsPublisher
+	eventsStream    EventsStream
+	idFormat        string
+}
+
+type Option func(*companiesHandler)
+
+// WithIdFormat sets format of company ids generated by the storage, requests with other ids are rejected.
+// IdFormatObjectID is used by default
+func WithIdFormat(format string) Option {
+	return func(h *companiesHandler) {
+		h.idFormat = format
+	}
+}
+
+// WithEventsStream enables streaming of the company events at GET /companies/events
+func WithEventsStream(stream EventsStream) Option {
+	return func(h *companiesHandler) {
+		h.eventsStream = stream
+	}
 }
 
 func (h companiesHandler) createCompany(c *fiber.Ctx) error {
@@ -37,25 +100,69 @@ func (h companiesHandler) createCompany(c *fiber.Ctx) error {
 		return handleErrorStatus(c, fiber.StatusBadRequest, err)
 	}
 
-	var registered bool
-	if req.Registered != nil {
-		registered = *req.Registered
-	}
-	company, err := h.srv.Create(c.Context(), services.Company{
-		Name:              req.Name,
-		Description:       req.Description,
-		AmountOfEmployees: req.AmountOfEmployees,
-		Registered:        registered,
-		Type:              req.Type,
-	})
+	company, err := h.srv.Create(c.UserContext(), CompanyFromCreateRequest(req))
 	if err != nil {
 		return handleError(c, err)
 	}
 
-	createdCompany := CompanyFromService(company)
-	go h.eventsPublisher.OnCreateCompany(createdCompany)
+	event := CompanyCreatedEvent(company)
+	h.publishAdmitted(func(p EventsPublisher) error { return p.OnCreateCompany(event) })
+
+	c.Set(fiber.HeaderETag, formatETag(company.Version))
+	return c.JSON(CompanyFromService(company))
+}
+
+// bulkCreateCompanies creates every valid company of the request, one invalid or duplicated company
+// does not fail the others, so the response has status for every company in the request order
+func (h companiesHandler) bulkCreateCompanies(c *fiber.Ctx) error {
+	var req []CreateCompanyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if len(req) == 0 || len(req) > maxBulkCompanies {
+		return handleErrorStatus(c, fiber.StatusBadRequest, errInvalidBulkSize)
+	}
+
+	results := make([]BulkCreateResult, len(req))
+	companies := make([]services.Company, 0, len(req))
+	indexes := make([]int, 0, len(req))
+	for i, item := range req {
+		results[i].Index = i
+		if err := h.validator.Struct(item); err != nil {
+			results[i].Status, results[i].Error = BulkStatusInvalid, err.Error()
+			continue
+		}
+
+		companies = append(companies, CompanyFromCreateRequest(item))
+		indexes = append(indexes, i)
+	}
+
+	if len(companies) == 0 {
+		return c.JSON(BulkCreateResponse{Results: results})
+	}
+
+	// every created company has an event, so the request is refused unless all of them can be accepted
+	if err := h.admit(len(companies)); err != nil {
+		return handleNotAdmitted(c, err)
+	}
+
+	created, errs := h.srv.CreateMany(c.UserContext(), companies)
+	for i, index := range indexes {
+		switch {
+		case errs[i] == nil:
+			company := CompanyFromService(created[i])
+			results[index].Status, results[index].Company = BulkStatusCreated, &company
+			event := CompanyCreatedEvent(created[i])
+			h.publishBlocking(func(p EventsPublisher) error { return p.OnCreateCompany(event) })
+		case errors.As(errs[i], &services.ErrDbDuplicatedKey{}):
+			results[index].Status, results[index].Error = BulkStatusDuplicate, errs[i].Error()
+		default:
+			results[index].Status, results[index].Error = BulkStatusFailed, errs[i].Error()
+		}
+	}
 
-	return c.JSON(createdCompany)
+	return c.JSON(BulkCreateResponse{Results: results})
 }
 
 func (h companiesHandler) updateCompany(c *fiber.Ctx) error {
@@ -64,6 +171,11 @@ func (h companiesHandler) updateCompany(c *fiber.Ctx) error {
 		return handleErrorStatus(c, fiber.StatusBadRequest, err)
 	}
 
+	version, err := parseIfMatch(c.Get(fiber.HeaderIfMatch))
+	if err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
 	var req UpdateCompanyRequest
 	if err := c.BodyParser(&req); err != nil {
 		return handleErrorStatus(c, fiber.StatusBadRequest, err)
@@ -73,14 +185,16 @@ func (h companiesHandler) updateCompany(c *fiber.Ctx) error {
 		return handleErrorStatus(c, fiber.StatusBadRequest, err)
 	}
 
-	update := CompanyUpdateToService(id, req)
-	err := h.srv.Update(c.Context(), update)
+	change, err := h.srv.Update(c.UserContext(), CompanyUpdateToService(id, version, req))
 	if err != nil {
 		return handleError(c, err)
 	}
 
-	go h.eventsPublisher.OnPatchCompany(update)
+	event := CompanyUpdatedEvent(change)
+	h.publishAdmitted(func(p EventsPublisher) error { return p.OnPatchCompany(event) })
 
+	// the new version lets the client make the next conditional write without getting the company
+	c.Set(fiber.HeaderETag, formatETag(change.Company.Version))
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
@@ -90,7 +204,28 @@ func (h companiesHandler) getCompany(c *fiber.Ctx) error {
 		return handleErrorStatus(c, fiber.StatusBadRequest, err)
 	}
 
-	company, err := h.srv.Get(c.Context(), id)
+	if asOf := c.Query("as_of"); asOf != "" {
+		return h.getCompanyAsOf(c, id, asOf)
+	}
+
+	company, err := h.srv.Get(c.UserContext(), id)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, formatETag(company.Version))
+	return c.JSON(CompanyFromService(company))
+}
+
+// getCompanyAsOf responds with the past state of the company, ETag is not set because
+// the past version can not be used for the conditional writes
+func (h companiesHandler) getCompanyAsOf(c *fiber.Ctx, id, asOf string) error {
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	company, err := h.srv.GetAsOf(c.UserContext(), id, at)
 	if err != nil {
 		return handleError(c, err)
 	}
@@ -98,35 +233,192 @@ func (h companiesHandler) getCompany(c *fiber.Ctx) error {
 	return c.JSON(CompanyFromService(company))
 }
 
+func (h companiesHandler) listCompanies(c *fiber.Ctx) error {
+	var req ListCompaniesRequest
+	if err := c.QueryParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	page, err := h.srv.List(c.UserContext(), ListQueryToService(req))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(CompaniesPageFromService(page))
+}
+
+func (h companiesHandler) searchCompanies(c *fiber.Ctx) error {
+	var req SearchCompaniesRequest
+	if err := c.QueryParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	results, err := h.srv.Search(c.UserContext(), services.SearchQuery{Text: req.Query, Limit: req.Limit})
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(SearchResultsFromService(results))
+}
+
 func (h companiesHandler) deleteCompany(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if err := h.validateId(id); err != nil {
 		return handleErrorStatus(c, fiber.StatusBadRequest, err)
 	}
 
-	err := h.srv.Delete(c.Context(), id)
+	version, err := parseIfMatch(c.Get(fiber.HeaderIfMatch))
+	if err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	err = h.srv.Delete(c.UserContext(), id, version)
 	if err != nil {
 		return handleError(c, err)
 	}
 
-	go h.eventsPublisher.OnDeleteCompany(id)
+	event := CompanyDeletedEvent(id)
+	h.publishAdmitted(func(p EventsPublisher) error { return p.OnDeleteCompany(event) })
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+func (h companiesHandler) restoreCompany(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := h.validateId(id); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	company, err := h.srv.Restore(c.UserContext(), id)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	// consumers which have removed the deleted company learn that it is available again
+	event := CompanyCreatedEvent(company)
+	h.publishAdmitted(func(p EventsPublisher) error { return p.OnCreateCompany(event) })
+
+	c.Set(fiber.HeaderETag, formatETag(company.Version))
+	return c.JSON(CompanyFromService(company))
+}
+
+func (h companiesHandler) companyHistory(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := h.validateId(id); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	var req HistoryRequest
+	if err := c.QueryParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	page, err := h.srv.History(c.UserContext(), services.HistoryQuery{CompanyID: id, Cursor: req.Cursor, Limit: req.Limit})
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(HistoryPageFromService(page))
+}
+
+// publish passes the event to the publisher, failure is only logged because the change is already applied.
+// The publisher is called within the request, so it should queue events rather than deliver them.
+// Nothing is sent without publisher, events are written to the outbox by the storage then
+func (h companiesHandler) publish(send func(EventsPublisher) error) {
+	if h.eventsPublisher == nil {
+		return
+	}
+
+	if err := send(h.eventsPublisher); err != nil {
+		slog.Error("failed to publish company event", "error", err.Error())
+	}
+}
+
+// publishAdmitted passes the event of the change admitted by admitEvents, the publisher does not refuse it,
+// because the change is already applied
+func (h companiesHandler) publishAdmitted(send func(EventsPublisher) error) {
+	if admitter, ok := h.eventsPublisher.(EventsAdmitter); ok {
+		h.eventsPublisher = admitter.Admitted()
+	}
+
+	h.publish(send)
+}
+
+// publishBlocking passes the event of the change of many companies, the change is admitted as a whole,
+// so the publisher waits for room for every its event instead of refusing the ones which do not fit
+func (h companiesHandler) publishBlocking(send func(EventsPublisher) error) {
+	if blocking, ok := h.eventsPublisher.(BlockingEventsPublisher); ok {
+		h.eventsPublisher = blocking.Blocking()
+	}
+
+	h.publish(send)
+}
+
+// admitEvents responds with 503 without applying the change when the publisher can not accept its event
+func (h companiesHandler) admitEvents(c *fiber.Ctx) error {
+	if err := h.admit(1); err != nil {
+		return handleNotAdmitted(c, err)
+	}
+
+	return c.Next()
+}
+
+// admit reports whether the publisher can accept the given number of events now
+func (h companiesHandler) admit(count int) error {
+	if admitter, ok := h.eventsPublisher.(EventsAdmitter); ok {
+		return admitter.Admit(count)
+	}
+
+	return nil
+}
+
+// handleNotAdmitted responds with 503 to the change refused because of the events backlog
+func handleNotAdmitted(c *fiber.Ctx, err error) error {
+	c.Set(fiber.HeaderRetryAfter, retryAfterSec)
+	return handleErrorStatus(c, fiber.StatusServiceUnavailable, err)
+}
+
 func (h companiesHandler) validateId(id string) error {
-	return h.validator.Var(id, "required,len=24")
+	return h.validator.Var(id, "required,"+h.idFormat)
 }
 
-func SetupCompaniesRoutes(r fiber.Router, srv CompaniesService, eventsPublisher EventsPublisher) {
+// SetupCompaniesRoutes registers companies API, nil publisher means events of the changes are published
+// by somebody else, for example by the outbox relay
+func SetupCompaniesRoutes(r fiber.Router, srv CompaniesService, eventsPublisher EventsPublisher, opts ...Option) {
 	handler := &companiesHandler{
 		srv:             srv,
-		validator:       validator.New(),
+		validator:       newValidator(),
 		eventsPublisher: eventsPublisher,
+		idFormat:        IdFormatObjectID,
+	}
+	for _, opt := range opts {
+		opt(handler)
 	}
 
-	r.Post("/companies/create", handler.createCompany)
+	r.Post("/companies/create", handler.admitEvents, handler.createCompany)
+	r.Post("/companies/bulk", handler.bulkCreateCompanies)
+	r.Post("/companies/import", handler.admitEvents, handler.importCompanies)
+	r.Get("/companies", handler.listCompanies)
+	r.Get("/companies/search", handler.searchCompanies)
+	r.Get("/companies/export", handler.exportCompanies)
+	if handler.eventsStream != nil {
+		r.Get("/companies/events", handler.streamEvents)
+	}
 	r.Get("/companies/:id", handler.getCompany)
-	r.Patch("/companies/:id", handler.updateCompany)
-	r.Delete("/companies/:id", handler.deleteCompany)
+	r.Patch("/companies/:id", handler.admitEvents, handler.updateCompany)
+	r.Delete("/companies/:id", handler.admitEvents, handler.deleteCompany)
+	r.Post("/companies/:id/restore", handler.admitEvents, handler.restoreCompany)
+	r.Get("/companies/:id/history", handler.companyHistory)
 }
@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/handlers"
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/require"
 )
@@ -28,7 +31,7 @@ func TestCreateCompany(t *testing.T) {
 
 		fiberApp := initFiberApp()
 
-		ch := make(chan any)
+		ch := make(chan any, 1)
 		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
 			t: t,
 			expectedCompany: services.Company{
@@ -45,6 +48,7 @@ func TestCreateCompany(t *testing.T) {
 				AmountOfEmployees: 10,
 				Registered:        true,
 				Type:              "Sole Proprietorship",
+				Version:           1,
 			},
 		}, newMockPublisher(ch))
 		defer close(ch)
@@ -64,6 +68,7 @@ func TestCreateCompany(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, response)
 		require.Equal(t, fiber.StatusOK, response.StatusCode)
+		require.Equal(t, `"1"`, response.Header.Get(fiber.HeaderETag))
 
 		defer response.Body.Close()
 		bodyBytes, err := io.ReadAll(response.Body)
@@ -77,7 +82,60 @@ func TestCreateCompany(t *testing.T) {
 
 		select {
 		case e := <-ch:
-			require.Equal(t, expectedResponse, e)
+			created := e.(events.CompanyCreated)
+			require.NotEmpty(t, created.ID)
+			require.False(t, created.Time.IsZero())
+			require.Equal(t, events.Company{
+				ID:                "605c72efb1e2c3d1f8a1b2c3",
+				Name:              "name",
+				Description:       "description",
+				AmountOfEmployees: 10,
+				Registered:        true,
+				Type:              "Sole Proprietorship",
+				Version:           1,
+			}, created.Company)
+		case <-time.After(time.Millisecond * 500):
+			require.Fail(t, "timeout")
+		}
+	})
+
+	t.Run("events publisher overloaded", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		// nil service fails the test if the company is created
+		handlers.SetupCompaniesRoutes(fiberApp, nil, &mockOverloadedPublisher{})
+
+		req := httptest.NewRequest("POST", "/companies/create", strings.NewReader(`{"name":"name","amount_of_employees":1,"registered":true,"type":"Corporations"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusServiceUnavailable, response.StatusCode)
+		require.Equal(t, "1", response.Header.Get(fiber.HeaderRetryAfter))
+	})
+
+	t.Run("event of admitted company is not refused", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		ch := make(chan any, 1)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:               t,
+			expectedCompany: services.Company{Name: "name", AmountOfEmployees: 1, Registered: true, Type: "Corporations"},
+			returnCompany:   services.Company{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "name", AmountOfEmployees: 1, Registered: true, Type: "Corporations", Version: 1},
+		}, &mockOverloadedPublisher{capacity: 1, blocking: newMockPublisher(ch)})
+
+		req := httptest.NewRequest("POST", "/companies/create", strings.NewReader(`{"name":"name","amount_of_employees":1,"registered":true,"type":"Corporations"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		select {
+		case e := <-ch:
+			require.Equal(t, "605c72efb1e2c3d1f8a1b2c3", e.(events.CompanyCreated).Company.ID)
 		case <-time.After(time.Millisecond * 500):
 			require.Fail(t, "timeout")
 		}
@@ -136,6 +194,143 @@ func TestCreateCompany(t *testing.T) {
 	})
 }
 
+func TestBulkCreateCompanies(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		eventsChan := make(chan any, 2)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t: t,
+			expectedCompanies: []services.Company{
+				{Name: "first", AmountOfEmployees: 10, Registered: true, Type: "Corporations"},
+				{Name: "second", AmountOfEmployees: 20, Type: "NonProfit"},
+				{Name: "third", AmountOfEmployees: 30, Type: "Cooperative"},
+				{Name: "fourth", AmountOfEmployees: 40, Type: "Cooperative"},
+			},
+			returnCompanies: []services.Company{
+				{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "first", AmountOfEmployees: 10, Registered: true, Type: "Corporations"},
+				{},
+				{ID: "605c72efb1e2c3d1f8a1b2c4", Name: "third", AmountOfEmployees: 30, Type: "Cooperative"},
+				{},
+			},
+			returnErrors: []error{nil, services.ErrDbDuplicatedKey{}, nil, services.ErrDb{}},
+		}, &mockOverloadedPublisher{capacity: 4, blocking: newMockPublisher(eventsChan)})
+
+		body := `[
+			{"name":"first","amount_of_employees":10,"registered":true,"type":"Corporations"},
+			{"name":"second","amount_of_employees":20,"registered":false,"type":"NonProfit"},
+			{"name":"invalid","amount_of_employees":20,"type":"NonProfit"},
+			{"name":"third","amount_of_employees":30,"registered":false,"type":"Cooperative"},
+			{"name":"fourth","amount_of_employees":40,"registered":false,"type":"Cooperative"}
+		]`
+		req := httptest.NewRequest("POST", "/companies/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		defer response.Body.Close()
+		bodyBytes, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+
+		var res handlers.BulkCreateResponse
+		err = json.Unmarshal(bodyBytes, &res)
+		require.NoError(t, err)
+
+		require.Len(t, res.Results, 5)
+		for i, result := range res.Results {
+			require.Equal(t, i, result.Index)
+		}
+
+		require.Equal(t, handlers.BulkStatusCreated, res.Results[0].Status)
+		require.Equal(t, &handlers.Company{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "first", AmountOfEmployees: 10, Registered: true, Type: "Corporations"}, res.Results[0].Company)
+		require.Equal(t, handlers.BulkStatusDuplicate, res.Results[1].Status)
+		require.NotEmpty(t, res.Results[1].Error)
+		require.Equal(t, handlers.BulkStatusInvalid, res.Results[2].Status)
+		require.NotEmpty(t, res.Results[2].Error)
+		require.Equal(t, handlers.BulkStatusCreated, res.Results[3].Status)
+		require.Equal(t, "605c72efb1e2c3d1f8a1b2c4", res.Results[3].Company.ID)
+		require.Equal(t, handlers.BulkStatusFailed, res.Results[4].Status)
+		require.Nil(t, res.Results[4].Company)
+
+		// event is published for every created company, the publisher waits for room for them
+		var ids []string
+		for range 2 {
+			select {
+			case e := <-eventsChan:
+				ids = append(ids, e.(events.CompanyCreated).Company.ID)
+			case <-time.After(time.Second):
+				require.FailNow(t, "event is not published")
+			}
+		}
+		require.ElementsMatch(t, []string{"605c72efb1e2c3d1f8a1b2c3", "605c72efb1e2c3d1f8a1b2c4"}, ids)
+	})
+
+	t.Run("events publisher overloaded", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		// nil service fails the test if the companies are created
+		handlers.SetupCompaniesRoutes(fiberApp, nil, &mockOverloadedPublisher{capacity: 1})
+
+		body := `[
+			{"name":"first","amount_of_employees":10,"registered":true,"type":"Corporations"},
+			{"name":"second","amount_of_employees":20,"registered":false,"type":"NonProfit"}
+		]`
+		req := httptest.NewRequest("POST", "/companies/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusServiceUnavailable, response.StatusCode)
+		require.Equal(t, "1", response.Header.Get(fiber.HeaderRetryAfter))
+	})
+
+	t.Run("all companies are invalid", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		req := httptest.NewRequest("POST", "/companies/bulk", strings.NewReader(`[{"name":"invalid"}]`))
+		req.Header.Set("Content-Type", "application/json")
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		defer response.Body.Close()
+		var res handlers.BulkCreateResponse
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&res))
+		require.Len(t, res.Results, 1)
+		require.Equal(t, handlers.BulkStatusInvalid, res.Results[0].Status)
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		doTest := func(body string) {
+			req := httptest.NewRequest("POST", "/companies/bulk", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+		}
+
+		doTest(`[]`)
+		doTest(`{"name":"not an array"}`)
+		doTest(`[{"name":`)
+		doTest("[" + strings.Repeat(`{"name":"name"},`, 1000) + `{"name":"name"}]`)
+	})
+}
+
 func TestGetCompany(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		expectedResponse := handlers.Company{
@@ -145,6 +340,10 @@ func TestGetCompany(t *testing.T) {
 			AmountOfEmployees: 10,
 			Registered:        true,
 			Type:              "Sole Proprietorship",
+			CreatedAt:         time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			CreatedBy:         "alice",
+			UpdatedAt:         time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+			UpdatedBy:         "bob",
 		}
 
 		fiberApp := initFiberApp()
@@ -158,6 +357,11 @@ func TestGetCompany(t *testing.T) {
 				AmountOfEmployees: 10,
 				Registered:        true,
 				Type:              "Sole Proprietorship",
+				Version:           3,
+				CreatedAt:         time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+				CreatedBy:         "alice",
+				UpdatedAt:         time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+				UpdatedBy:         "bob",
 			},
 			expectedId: "605c72efb1e2c3d1f8a1b2c3",
 		}, nil)
@@ -168,6 +372,7 @@ func TestGetCompany(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, response)
 		require.Equal(t, fiber.StatusOK, response.StatusCode)
+		require.Equal(t, `"3"`, response.Header.Get(fiber.HeaderETag))
 
 		defer response.Body.Close()
 		bodyBytes, err := io.ReadAll(response.Body)
@@ -194,6 +399,24 @@ func TestGetCompany(t *testing.T) {
 		require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
 	})
 
+	t.Run("uuid ids", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:             t,
+			returnCompany: services.Company{ID: "0190a8f2-8e2f-7c3a-9b1d-3f1e2d4c5b6a", Version: 1},
+			expectedId:    "0190a8f2-8e2f-7c3a-9b1d-3f1e2d4c5b6a",
+		}, nil, handlers.WithIdFormat(handlers.IdFormatUUID))
+
+		response, err := fiberApp.Test(httptest.NewRequest("GET", "/companies/0190a8f2-8e2f-7c3a-9b1d-3f1e2d4c5b6a", nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		response, err = fiberApp.Test(httptest.NewRequest("GET", "/companies/605c72efb1e2c3d1f8a1b2c3", nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+	})
+
 	t.Run("internal server error", func(t *testing.T) {
 		fiberApp := initFiberApp()
 
@@ -211,6 +434,72 @@ func TestGetCompany(t *testing.T) {
 		defer response.Body.Close()
 		require.Equal(t, fiber.StatusInternalServerError, response.StatusCode)
 	})
+
+	t.Run("success as of time", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:            t,
+			expectedId:   "605c72efb1e2c3d1f8a1b2c3",
+			expectedAsOf: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			returnCompany: services.Company{
+				ID:                "605c72efb1e2c3d1f8a1b2c3",
+				Name:              "old name",
+				AmountOfEmployees: 10,
+				Type:              "Corporations",
+				Version:           2,
+			},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies/605c72efb1e2c3d1f8a1b2c3?as_of=2026-01-01T00:00:00Z", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+		require.Empty(t, response.Header.Get(fiber.HeaderETag))
+
+		defer response.Body.Close()
+		bodyBytes, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+
+		var res handlers.Company
+		err = json.Unmarshal(bodyBytes, &res)
+		require.NoError(t, err)
+
+		require.Equal(t, handlers.Company{
+			ID:                "605c72efb1e2c3d1f8a1b2c3",
+			Name:              "old name",
+			AmountOfEmployees: 10,
+			Type:              "Corporations",
+		}, res)
+	})
+
+	t.Run("as of time errors", func(t *testing.T) {
+		doTest := func(query string, returnError error, expectedStatus int) {
+			fiberApp := initFiberApp()
+
+			handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+				t:            t,
+				expectedId:   "605c72efb1e2c3d1f8a1b2c3",
+				expectedAsOf: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+				returnError:  returnError,
+			}, nil)
+
+			req := httptest.NewRequest("GET", "/companies/605c72efb1e2c3d1f8a1b2c3?"+query, nil)
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, expectedStatus, response.StatusCode)
+		}
+
+		doTest("as_of=yesterday", nil, fiber.StatusBadRequest)
+		doTest("as_of=2026-01-01", nil, fiber.StatusBadRequest)
+		doTest("as_of=2026-01-01T00:00:00Z", services.ErrNotFound{}, fiber.StatusNotFound)
+		doTest("as_of=2026-01-01T02:00:00%2B02:00", services.ErrDb{}, fiber.StatusInternalServerError)
+	})
 }
 
 func TestUpdateCompany(t *testing.T) {
@@ -227,10 +516,12 @@ func TestUpdateCompany(t *testing.T) {
 			Registered:        &registered,
 			Type:              "Sole Proprietorship",
 		}
-		ch := make(chan any)
+		ch := make(chan any, 1)
 		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
 			t:                     t,
 			expectedCompanyUpdate: expectedCompanyUpdate,
+			returnCompany:         services.Company{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "name", Version: 2},
+			returnChanges:         []services.FieldChange{{Field: "name", Before: "old name", After: "name"}},
 		}, newMockPublisher(ch))
 
 		body := `{
@@ -249,50 +540,27 @@ func TestUpdateCompany(t *testing.T) {
 		require.NotNil(t, response)
 		defer response.Body.Close()
 		require.Equal(t, fiber.StatusNoContent, response.StatusCode)
+		require.Equal(t, `"2"`, response.Header.Get(fiber.HeaderETag))
 
 		select {
 		case e := <-ch:
-			require.Equal(t, expectedCompanyUpdate, e)
+			updated := e.(events.CompanyUpdated)
+			require.NotEmpty(t, updated.ID)
+			require.Equal(t, events.Company{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "name", Version: 2}, updated.Company)
+			require.Equal(t, []events.FieldChange{{Field: "name", Before: "old name", After: "name"}}, updated.Changes)
 		case <-time.After(time.Millisecond * 500):
 			require.Fail(t, "timeout")
 		}
 	})
 
-	t.Run("bad request error", func(t *testing.T) {
-		fiberApp := initFiberApp()
-
-		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
-
-		doTest := func(id, body string) {
-			req := httptest.NewRequest("PATCH", "/companies/"+id, bytes.NewReader([]byte(body)))
-			req.Header.Set("Content-Type", "application/json")
-
-			response, err := fiberApp.Test(req)
-			require.NoError(t, err)
-			require.NotNil(t, response)
-			defer response.Body.Close()
-			require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
-		}
-
-		doTest("605c72efb1e2c3d1f8a1b2c3", `{}`)
-		doTest("wrong_id", `{
-			"name":"name",
-			"description":"description",
-			"amount_of_employees":100,
-			"registered":true,
-			"type":"Sole Proprietorship"
-		}`)
-		doTest("605c72efb1e2c3d1f8a1b2c3", `not a json`)
-	})
-
-	t.Run("internal server error", func(t *testing.T) {
+	t.Run("success with If-Match", func(t *testing.T) {
 		fiberApp := initFiberApp()
 
 		description := "description"
 		registered := true
+		ch := make(chan any, 1)
 		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
-			t:           t,
-			returnError: services.ErrDb{},
+			t: t,
 			expectedCompanyUpdate: services.CompanyUpdate{
 				ID:                "605c72efb1e2c3d1f8a1b2c3",
 				Name:              "name",
@@ -300,8 +568,9 @@ func TestUpdateCompany(t *testing.T) {
 				AmountOfEmployees: 100,
 				Registered:        &registered,
 				Type:              "Sole Proprietorship",
+				Version:           7,
 			},
-		}, nil)
+		}, newMockPublisher(ch))
 
 		body := `{
 			"name":"name",
@@ -310,68 +579,555 @@ func TestUpdateCompany(t *testing.T) {
 			"registered":true,
 			"type":"Sole Proprietorship"
 		}`
+
 		req := httptest.NewRequest("PATCH", "/companies/605c72efb1e2c3d1f8a1b2c3", bytes.NewReader([]byte(body)))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"7"`)
 
 		response, err := fiberApp.Test(req)
 		require.NoError(t, err)
 		require.NotNil(t, response)
 		defer response.Body.Close()
-		require.Equal(t, fiber.StatusInternalServerError, response.StatusCode)
+		require.Equal(t, fiber.StatusNoContent, response.StatusCode)
+
+		select {
+		case <-ch:
+		case <-time.After(time.Millisecond * 500):
+			require.Fail(t, "timeout")
+		}
 	})
-}
 
-func TestDeleteCompany(t *testing.T) {
-	t.Run("success", func(t *testing.T) {
+	t.Run("not found error", func(t *testing.T) {
 		fiberApp := initFiberApp()
 
-		ch := make(chan any)
+		description := "description"
+		registered := true
+		ch := make(chan any, 1)
 		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
-			t:          t,
-			expectedId: "605c72efb1e2c3d1f8a1b2c3",
+			t:           t,
+			returnError: services.ErrNotFound{},
+			expectedCompanyUpdate: services.CompanyUpdate{
+				ID:                "605c72efb1e2c3d1f8a1b2c3",
+				Name:              "name",
+				Description:       &description,
+				AmountOfEmployees: 100,
+				Registered:        &registered,
+				Type:              "Sole Proprietorship",
+			},
 		}, newMockPublisher(ch))
 
-		req := httptest.NewRequest("DELETE", "/companies/605c72efb1e2c3d1f8a1b2c3", nil)
+		body := `{
+			"name":"name",
+			"description":"description",
+			"amount_of_employees":100,
+			"registered":true,
+			"type":"Sole Proprietorship"
+		}`
+
+		req := httptest.NewRequest("PATCH", "/companies/605c72efb1e2c3d1f8a1b2c3", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
 
 		response, err := fiberApp.Test(req)
 		require.NoError(t, err)
 		require.NotNil(t, response)
 		defer response.Body.Close()
-		require.Equal(t, fiber.StatusNoContent, response.StatusCode)
+		require.Equal(t, fiber.StatusNotFound, response.StatusCode)
 
 		select {
 		case e := <-ch:
-			require.Equal(t, "605c72efb1e2c3d1f8a1b2c3", e)
-		case <-time.After(time.Millisecond * 500):
-			require.Fail(t, "timeout")
+			require.Fail(t, "unexpected event", e)
+		case <-time.After(time.Millisecond * 100):
 		}
 	})
 
-	t.Run("bad request error", func(t *testing.T) {
+	t.Run("precondition failed error", func(t *testing.T) {
 		fiberApp := initFiberApp()
 
-		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+		description := "description"
+		registered := true
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:           t,
+			returnError: services.ErrVersionMismatch{},
+			expectedCompanyUpdate: services.CompanyUpdate{
+				ID:                "605c72efb1e2c3d1f8a1b2c3",
+				Name:              "name",
+				Description:       &description,
+				AmountOfEmployees: 100,
+				Registered:        &registered,
+				Type:              "Sole Proprietorship",
+				Version:           7,
+			},
+		}, nil)
+
+		body := `{
+			"name":"name",
+			"description":"description",
+			"amount_of_employees":100,
+			"registered":true,
+			"type":"Sole Proprietorship"
+		}`
 
-		req := httptest.NewRequest("DELETE", "/companies/wrong_id", nil)
+		req := httptest.NewRequest("PATCH", "/companies/605c72efb1e2c3d1f8a1b2c3", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"7"`)
 
 		response, err := fiberApp.Test(req)
 		require.NoError(t, err)
 		require.NotNil(t, response)
 		defer response.Body.Close()
-		require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+		require.Equal(t, fiber.StatusPreconditionFailed, response.StatusCode)
 	})
 
-	t.Run("internal server error", func(t *testing.T) {
+	t.Run("conflict error", func(t *testing.T) {
 		fiberApp := initFiberApp()
 
+		registered := true
 		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
 			t:           t,
-			returnError: services.ErrDb{},
-			expectedId:  "605c72efb1e2c3d1f8a1b2c3",
-		}, nil)
-
-		req := httptest.NewRequest("DELETE", "/companies/605c72efb1e2c3d1f8a1b2c3", nil)
-
+			returnError: services.ErrConcurrentUpdate{},
+			expectedCompanyUpdate: services.CompanyUpdate{
+				ID:                "605c72efb1e2c3d1f8a1b2c3",
+				Name:              "name",
+				AmountOfEmployees: 100,
+				Registered:        &registered,
+				Type:              "Sole Proprietorship",
+			},
+		}, nil)
+
+		body := `{"name":"name","amount_of_employees":100,"registered":true,"type":"Sole Proprietorship"}`
+		req := httptest.NewRequest("PATCH", "/companies/605c72efb1e2c3d1f8a1b2c3", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusConflict, response.StatusCode)
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		doTest := func(id, body string) {
+			req := httptest.NewRequest("PATCH", "/companies/"+id, bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", "application/json")
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+		}
+
+		doTest("605c72efb1e2c3d1f8a1b2c3", `{}`)
+		doTest("wrong_id", `{
+			"name":"name",
+			"description":"description",
+			"amount_of_employees":100,
+			"registered":true,
+			"type":"Sole Proprietorship"
+		}`)
+		doTest("605c72efb1e2c3d1f8a1b2c3", `not a json`)
+
+		// invalid If-Match header
+		req := httptest.NewRequest("PATCH", "/companies/605c72efb1e2c3d1f8a1b2c3", bytes.NewReader([]byte(`{}`)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "7")
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("internal server error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		description := "description"
+		registered := true
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:           t,
+			returnError: services.ErrDb{},
+			expectedCompanyUpdate: services.CompanyUpdate{
+				ID:                "605c72efb1e2c3d1f8a1b2c3",
+				Name:              "name",
+				Description:       &description,
+				AmountOfEmployees: 100,
+				Registered:        &registered,
+				Type:              "Sole Proprietorship",
+			},
+		}, nil)
+
+		body := `{
+			"name":"name",
+			"description":"description",
+			"amount_of_employees":100,
+			"registered":true,
+			"type":"Sole Proprietorship"
+		}`
+		req := httptest.NewRequest("PATCH", "/companies/605c72efb1e2c3d1f8a1b2c3", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusInternalServerError, response.StatusCode)
+	})
+}
+
+func TestDeleteCompany(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		ch := make(chan any, 1)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:          t,
+			expectedId: "605c72efb1e2c3d1f8a1b2c3",
+		}, newMockPublisher(ch))
+
+		req := httptest.NewRequest("DELETE", "/companies/605c72efb1e2c3d1f8a1b2c3", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusNoContent, response.StatusCode)
+
+		select {
+		case e := <-ch:
+			require.Equal(t, "605c72efb1e2c3d1f8a1b2c3", e.(events.CompanyDeleted).CompanyID)
+		case <-time.After(time.Millisecond * 500):
+			require.Fail(t, "timeout")
+		}
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		doTest := func(id, ifMatch string) {
+			req := httptest.NewRequest("DELETE", "/companies/"+id, nil)
+			req.Header.Set("If-Match", ifMatch)
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+		}
+
+		doTest("wrong_id", "")
+		doTest("605c72efb1e2c3d1f8a1b2c3", `"abc"`)
+		doTest("605c72efb1e2c3d1f8a1b2c3", `"-1"`)
+	})
+
+	t.Run("company created before versioning", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:               t,
+			expectedId:      "605c72efb1e2c3d1f8a1b2c3",
+			expectedVersion: services.VersionUnset,
+		}, newMockPublisher(make(chan any, 1)))
+
+		req := httptest.NewRequest("DELETE", "/companies/605c72efb1e2c3d1f8a1b2c3", nil)
+		req.Header.Set("If-Match", `"0"`)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusNoContent, response.StatusCode)
+	})
+
+	t.Run("not found error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		ch := make(chan any, 1)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:           t,
+			returnError: services.ErrNotFound{},
+			expectedId:  "605c72efb1e2c3d1f8a1b2c3",
+		}, newMockPublisher(ch))
+
+		req := httptest.NewRequest("DELETE", "/companies/605c72efb1e2c3d1f8a1b2c3", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusNotFound, response.StatusCode)
+
+		select {
+		case e := <-ch:
+			require.Fail(t, "unexpected event", e)
+		case <-time.After(time.Millisecond * 100):
+		}
+	})
+
+	t.Run("precondition failed error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:               t,
+			returnError:     services.ErrVersionMismatch{},
+			expectedId:      "605c72efb1e2c3d1f8a1b2c3",
+			expectedVersion: 2,
+		}, nil)
+
+		req := httptest.NewRequest("DELETE", "/companies/605c72efb1e2c3d1f8a1b2c3", nil)
+		req.Header.Set("If-Match", `W/"2"`)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusPreconditionFailed, response.StatusCode)
+	})
+
+	t.Run("internal server error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:           t,
+			returnError: services.ErrDb{},
+			expectedId:  "605c72efb1e2c3d1f8a1b2c3",
+		}, nil)
+
+		req := httptest.NewRequest("DELETE", "/companies/605c72efb1e2c3d1f8a1b2c3", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusInternalServerError, response.StatusCode)
+	})
+}
+
+func TestListCompanies(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:                 t,
+			expectedListQuery: services.ListQuery{Cursor: "cursor", Limit: 2},
+			returnPage: services.CompaniesPage{
+				Companies: []services.Company{
+					{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "first", AmountOfEmployees: 10, Type: "Corporations"},
+					{ID: "605c72efb1e2c3d1f8a1b2c4", Name: "second", AmountOfEmployees: 20, Registered: true, Type: "NonProfit"},
+				},
+				NextCursor: "next",
+			},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies?cursor=cursor&limit=2", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		defer response.Body.Close()
+		bodyBytes, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+
+		var res handlers.ListCompaniesResponse
+		err = json.Unmarshal(bodyBytes, &res)
+		require.NoError(t, err)
+
+		require.Equal(t, handlers.ListCompaniesResponse{
+			Companies: []handlers.Company{
+				{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "first", AmountOfEmployees: 10, Type: "Corporations"},
+				{ID: "605c72efb1e2c3d1f8a1b2c4", Name: "second", AmountOfEmployees: 20, Registered: true, Type: "NonProfit"},
+			},
+			NextCursor: "next",
+		}, res)
+	})
+
+	t.Run("success with filters and sorting", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		registered := true
+		minEmployees := 10
+		maxEmployees := 100
+		createdAfter := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		updatedBefore := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t: t,
+			expectedListQuery: services.ListQuery{
+				Limit: 5,
+				Filter: services.CompanyFilter{
+					Type:          "NonProfit",
+					Registered:    &registered,
+					MinEmployees:  &minEmployees,
+					MaxEmployees:  &maxEmployees,
+					CreatedAfter:  &createdAfter,
+					CreatedBy:     "alice",
+					UpdatedBefore: &updatedBefore,
+					UpdatedBy:     "bob",
+				},
+				Sort: []services.SortField{
+					{Field: "amount_of_employees", Desc: true},
+					{Field: "name"},
+					{Field: "updated_at", Desc: true},
+				},
+			},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies?limit=5&type=NonProfit&registered=true&min_employees=10&max_employees=100"+
+			"&created_after=2026-01-01T00:00:00Z&created_by=alice&updated_before=2026-02-01T00:00:00Z&updated_by=bob"+
+			"&sort=-amount_of_employees,name,-updated_at", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		doTest := func(query string) {
+			req := httptest.NewRequest("GET", "/companies?"+query, nil)
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+		}
+
+		doTest("limit=-1")
+		doTest("limit=abc")
+		doTest("type=Unknown")
+		doTest("registered=maybe")
+		doTest("min_employees=-1")
+		doTest("min_employees=100&max_employees=10")
+		doTest("sort=description")
+		doTest("sort=name,-name")
+		doTest("sort=name,")
+		doTest("created_after=yesterday")
+		doTest("created_before=2026-01-01")
+		doTest("updated_after=2026-01-01%2000:00:00")
+		doTest("updated_before=1767225600")
+	})
+
+	t.Run("invalid cursor error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:                 t,
+			expectedListQuery: services.ListQuery{Cursor: "broken"},
+			returnError:       services.ErrInvalidCursor{},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies?cursor=broken", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("internal server error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:           t,
+			returnError: services.ErrDb{},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusInternalServerError, response.StatusCode)
+	})
+}
+
+func TestSearchCompanies(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:                   t,
+			expectedSearchQuery: services.SearchQuery{Text: "green energy", Limit: 5},
+			returnSearchResults: []services.SearchResult{
+				{
+					Company:    services.Company{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "Green", Description: "energy", Type: "NonProfit"},
+					Score:      1.5,
+					Highlights: map[string]string{"name": "<em>Green</em>", "description": "<em>energy</em>"},
+				},
+			},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies/search?q=green%20energy&limit=5", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		defer response.Body.Close()
+		bodyBytes, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+
+		var res handlers.SearchCompaniesResponse
+		err = json.Unmarshal(bodyBytes, &res)
+		require.NoError(t, err)
+
+		require.Equal(t, handlers.SearchCompaniesResponse{
+			Results: []handlers.SearchResult{
+				{
+					Company:    handlers.Company{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "Green", Description: "energy", Type: "NonProfit"},
+					Score:      1.5,
+					Highlights: map[string]string{"name": "<em>Green</em>", "description": "<em>energy</em>"},
+				},
+			},
+		}, res)
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		doTest := func(query string) {
+			req := httptest.NewRequest("GET", "/companies/search?"+query, nil)
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+		}
+
+		doTest("")
+		doTest("q=green&limit=-1")
+		doTest("q=" + strings.Repeat("a", 201))
+	})
+
+	t.Run("internal server error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:                   t,
+			expectedSearchQuery: services.SearchQuery{Text: "green"},
+			returnError:         services.ErrDb{},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies/search?q=green", nil)
+
 		response, err := fiberApp.Test(req)
 		require.NoError(t, err)
 		require.NotNil(t, response)
@@ -380,6 +1136,206 @@ func TestDeleteCompany(t *testing.T) {
 	})
 }
 
+func TestRestoreCompany(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		ch := make(chan any, 1)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:          t,
+			expectedId: "605c72efb1e2c3d1f8a1b2c3",
+			returnCompany: services.Company{
+				ID:                "605c72efb1e2c3d1f8a1b2c3",
+				Name:              "name",
+				AmountOfEmployees: 10,
+				Type:              "Corporations",
+				Version:           4,
+			},
+		}, newMockPublisher(ch))
+
+		req := httptest.NewRequest("POST", "/companies/605c72efb1e2c3d1f8a1b2c3/restore", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+		require.Equal(t, `"4"`, response.Header.Get(fiber.HeaderETag))
+
+		defer response.Body.Close()
+		bodyBytes, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+
+		var res handlers.Company
+		err = json.Unmarshal(bodyBytes, &res)
+		require.NoError(t, err)
+
+		require.Equal(t, handlers.Company{
+			ID:                "605c72efb1e2c3d1f8a1b2c3",
+			Name:              "name",
+			AmountOfEmployees: 10,
+			Type:              "Corporations",
+		}, res)
+
+		select {
+		case e := <-ch:
+			created := e.(events.CompanyCreated)
+			require.NotEmpty(t, created.ID)
+			require.Equal(t, events.Company{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "name", AmountOfEmployees: 10, Type: "Corporations", Version: 4}, created.Company)
+		case <-time.After(time.Millisecond * 500):
+			require.Fail(t, "timeout")
+		}
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		req := httptest.NewRequest("POST", "/companies/wrong_id/restore", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		doTest := func(returnError error, expectedStatus int) {
+			fiberApp := initFiberApp()
+
+			handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+				t:           t,
+				expectedId:  "605c72efb1e2c3d1f8a1b2c3",
+				returnError: returnError,
+			}, nil)
+
+			req := httptest.NewRequest("POST", "/companies/605c72efb1e2c3d1f8a1b2c3/restore", nil)
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, expectedStatus, response.StatusCode)
+		}
+
+		doTest(services.ErrNotFound{}, fiber.StatusNotFound)
+		doTest(services.ErrDbDuplicatedKey{}, fiber.StatusConflict)
+		doTest(services.ErrDb{}, fiber.StatusInternalServerError)
+	})
+}
+
+func TestCompanyHistory(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		timestamp := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:                    t,
+			expectedHistoryQuery: services.HistoryQuery{CompanyID: "605c72efb1e2c3d1f8a1b2c3", Cursor: "cursor", Limit: 2},
+			returnHistory: services.HistoryPage{
+				Entries: []services.HistoryEntry{
+					{
+						ID:        "1",
+						CompanyID: "605c72efb1e2c3d1f8a1b2c3",
+						Action:    services.ActionUpdate,
+						Actor:     "user",
+						RequestID: "request",
+						Timestamp: timestamp,
+						Changes:   []services.FieldChange{{Field: "name", Before: "old", After: "new"}},
+					},
+					{
+						ID:        "2",
+						CompanyID: "605c72efb1e2c3d1f8a1b2c3",
+						Action:    services.ActionDelete,
+						Timestamp: timestamp,
+					},
+				},
+				NextCursor: "next",
+			},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies/605c72efb1e2c3d1f8a1b2c3/history?cursor=cursor&limit=2", nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		defer response.Body.Close()
+		bodyBytes, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+
+		var res handlers.HistoryResponse
+		err = json.Unmarshal(bodyBytes, &res)
+		require.NoError(t, err)
+
+		require.Equal(t, handlers.HistoryResponse{
+			Entries: []handlers.HistoryEntry{
+				{
+					ID:        "1",
+					CompanyID: "605c72efb1e2c3d1f8a1b2c3",
+					Action:    "update",
+					Actor:     "user",
+					RequestID: "request",
+					Timestamp: timestamp,
+					Changes:   []handlers.FieldChange{{Field: "name", Before: "old", After: "new"}},
+				},
+				{
+					ID:        "2",
+					CompanyID: "605c72efb1e2c3d1f8a1b2c3",
+					Action:    "delete",
+					Timestamp: timestamp,
+				},
+			},
+			NextCursor: "next",
+		}, res)
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		doTest := func(target string) {
+			req := httptest.NewRequest("GET", target, nil)
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+		}
+
+		doTest("/companies/wrong_id/history")
+		doTest("/companies/605c72efb1e2c3d1f8a1b2c3/history?limit=-1")
+		doTest("/companies/605c72efb1e2c3d1f8a1b2c3/history?limit=abc")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		doTest := func(returnError error, expectedStatus int) {
+			fiberApp := initFiberApp()
+
+			handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+				t:                    t,
+				expectedHistoryQuery: services.HistoryQuery{CompanyID: "605c72efb1e2c3d1f8a1b2c3"},
+				returnError:          returnError,
+			}, nil)
+
+			req := httptest.NewRequest("GET", "/companies/605c72efb1e2c3d1f8a1b2c3/history", nil)
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, expectedStatus, response.StatusCode)
+		}
+
+		doTest(services.ErrInvalidCursor{}, fiber.StatusBadRequest)
+		doTest(services.ErrDb{}, fiber.StatusInternalServerError)
+	})
+}
+
 func initFiberApp() *fiber.App {
 	return fiber.New(fiber.Config{})
 }
@@ -389,7 +1345,22 @@ type mockCompaniesService struct {
 	expectedCompany       services.Company
 	expectedCompanyUpdate services.CompanyUpdate
 	expectedId            string
+	expectedVersion       int64
+	expectedListQuery     services.ListQuery
+	expectedSearchQuery   services.SearchQuery
+	expectedHistoryQuery  services.HistoryQuery
+	expectedAsOf          time.Time
+	expectedCompanies     []services.Company
+	returnCompanies       []services.Company
+	returnErrors          []error
+	returnCreated         bool
+	returnChanges         []services.FieldChange
+	expectedFilter        services.CompanyFilter
+	returnExported        []services.Company
 	returnCompany         services.Company
+	returnPage            services.CompaniesPage
+	returnSearchResults   []services.SearchResult
+	returnHistory         services.HistoryPage
 	returnError           error
 }
 
@@ -400,6 +1371,32 @@ func (m mockCompaniesService) Create(ctx context.Context, company services.Compa
 	return m.returnCompany, m.returnError
 }
 
+func (m mockCompaniesService) CreateMany(ctx context.Context, companies []services.Company) ([]services.Company, []error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedCompanies, companies)
+	return m.returnCompanies, m.returnErrors
+}
+
+func (m mockCompaniesService) UpsertByName(ctx context.Context, company services.Company) (services.CompanyChange, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedCompany, company)
+	return services.CompanyChange{Company: m.returnCompany, Changes: m.returnChanges, Created: m.returnCreated}, m.returnError
+}
+
+func (m mockCompaniesService) Export(ctx context.Context, filter services.CompanyFilter, fn func(services.Company) error) error {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedFilter, filter)
+	for _, company := range m.returnExported {
+		if err := fn(company); err != nil {
+			return err
+		}
+	}
+	return m.returnError
+}
+
 func (m mockCompaniesService) Get(ctx context.Context, id string) (services.Company, error) {
 	m.t.Helper()
 
@@ -407,20 +1404,57 @@ func (m mockCompaniesService) Get(ctx context.Context, id string) (services.Comp
 	return m.returnCompany, m.returnError
 }
 
-func (m mockCompaniesService) Update(ctx context.Context, update services.CompanyUpdate) error {
+func (m mockCompaniesService) GetAsOf(ctx context.Context, id string, asOf time.Time) (services.Company, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedId, id)
+	require.True(m.t, m.expectedAsOf.Equal(asOf))
+	return m.returnCompany, m.returnError
+}
+
+func (m mockCompaniesService) List(ctx context.Context, query services.ListQuery) (services.CompaniesPage, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedListQuery, query)
+	return m.returnPage, m.returnError
+}
+
+func (m mockCompaniesService) Search(ctx context.Context, query services.SearchQuery) ([]services.SearchResult, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedSearchQuery, query)
+	return m.returnSearchResults, m.returnError
+}
+
+func (m mockCompaniesService) Update(ctx context.Context, update services.CompanyUpdate) (services.CompanyChange, error) {
 	m.t.Helper()
 
 	require.Equal(m.t, m.expectedCompanyUpdate, update)
-	return m.returnError
+	return services.CompanyChange{Company: m.returnCompany, Changes: m.returnChanges}, m.returnError
 }
 
-func (m mockCompaniesService) Delete(ctx context.Context, id string) error {
+func (m mockCompaniesService) Delete(ctx context.Context, id string, version int64) error {
 	m.t.Helper()
 
 	require.Equal(m.t, m.expectedId, id)
+	require.Equal(m.t, m.expectedVersion, version)
 	return m.returnError
 }
 
+func (m mockCompaniesService) Restore(ctx context.Context, id string) (services.Company, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedId, id)
+	return m.returnCompany, m.returnError
+}
+
+func (m mockCompaniesService) History(ctx context.Context, query services.HistoryQuery) (services.HistoryPage, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedHistoryQuery, query)
+	return m.returnHistory, m.returnError
+}
+
 type mockPublisher struct {
 	ch chan<- any
 }
@@ -429,14 +1463,51 @@ func newMockPublisher(c chan<- any) *mockPublisher {
 	return &mockPublisher{ch: c}
 }
 
-func (m *mockPublisher) OnCreateCompany(e any) {
+func (m *mockPublisher) OnCreateCompany(e events.CompanyCreated) error {
 	m.ch <- e
+	return nil
 }
 
-func (m *mockPublisher) OnPatchCompany(e any) {
+func (m *mockPublisher) OnPatchCompany(e events.CompanyUpdated) error {
 	m.ch <- e
+	return nil
 }
 
-func (m *mockPublisher) OnDeleteCompany(e any) {
+func (m *mockPublisher) OnDeleteCompany(e events.CompanyDeleted) error {
 	m.ch <- e
+	return nil
+}
+
+// mockOverloadedPublisher admits up to capacity events at once and refuses events unless they are published
+// through the blocking or admitted publisher
+type mockOverloadedPublisher struct {
+	capacity int
+	blocking *mockPublisher
+}
+
+func (m *mockOverloadedPublisher) Admit(count int) error {
+	if count > m.capacity {
+		return errors.New("events queue is full")
+	}
+	return nil
+}
+
+func (m *mockOverloadedPublisher) Blocking() handlers.EventsPublisher {
+	return m.blocking
+}
+
+func (m *mockOverloadedPublisher) Admitted() handlers.EventsPublisher {
+	return m.blocking
+}
+
+func (m *mockOverloadedPublisher) OnCreateCompany(events.CompanyCreated) error {
+	return errors.New("events queue is full")
+}
+
+func (m *mockOverloadedPublisher) OnPatchCompany(events.CompanyUpdated) error {
+	return errors.New("events queue is full")
+}
+
+func (m *mockOverloadedPublisher) OnDeleteCompany(events.CompanyDeleted) error {
+	return errors.New("events queue is full")
 }
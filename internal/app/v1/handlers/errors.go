@@ -15,6 +15,12 @@ func handleError(c *fiber.Ctx, err error) error {
 		status = fiber.StatusNotFound
 	case errors.As(err, &services.ErrDbDuplicatedKey{}):
 		status = fiber.StatusConflict
+	case errors.As(err, &services.ErrConcurrentUpdate{}):
+		status = fiber.StatusConflict
+	case errors.As(err, &services.ErrVersionMismatch{}):
+		status = fiber.StatusPreconditionFailed
+	case errors.As(err, &services.ErrInvalidCursor{}):
+		status = fiber.StatusBadRequest
 	}
 
 	return handleErrorStatus(c, status, err)
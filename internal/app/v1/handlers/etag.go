@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+)
+
+var errInvalidIfMatch = errors.New("invalid If-Match header, expected single entity tag or '*'")
+
+// formatETag returns company version as strong entity tag
+func formatETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// parseIfMatch returns company version from If-Match header,
+// zero is returned when header is empty or is '*', so the write is unconditional.
+// Companies created before versioning have "0" entity tag, it is returned as VersionUnset
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errInvalidIfMatch
+	}
+
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, errInvalidIfMatch
+	}
+
+	if version == 0 {
+		return services.VersionUnset, nil
+	}
+
+	return version, nil
+}
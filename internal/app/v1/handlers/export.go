@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatJSON   = "json"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:    mimeTextCSV,
+	ExportFormatNDJSON: mimeApplicationNDJSON,
+	ExportFormatJSON:   fiber.MIMEApplicationJSON,
+}
+
+var exportCSVHeader = []string{
+	"id", "name", "description", "amount_of_employees", "registered", "type",
+	"created_at", "created_by", "updated_at", "updated_by",
+}
+
+// companyEncoder writes companies to the export stream in one of the formats
+type companyEncoder interface {
+	encode(company Company) error
+	close() error
+}
+
+func newCompanyEncoder(format string, w io.Writer) (companyEncoder, error) {
+	switch format {
+	case ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		return &csvEncoder{writer: writer}, writer.Write(exportCSVHeader)
+	case ExportFormatNDJSON:
+		return &ndjsonEncoder{encoder: json.NewEncoder(w)}, nil
+	default:
+		_, err := io.WriteString(w, "[")
+		return &jsonEncoder{w: w, encoder: json.NewEncoder(w)}, err
+	}
+}
+
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvEncoder) encode(company Company) error {
+	return e.writer.Write([]string{
+		company.ID,
+		company.Name,
+		company.Description,
+		strconv.Itoa(company.AmountOfEmployees),
+		strconv.FormatBool(company.Registered),
+		company.Type,
+		company.CreatedAt.Format(time.RFC3339Nano),
+		company.CreatedBy,
+		company.UpdatedAt.Format(time.RFC3339Nano),
+		company.UpdatedBy,
+	})
+}
+
+func (e *csvEncoder) close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonEncoder) encode(company Company) error {
+	return e.encoder.Encode(company)
+}
+
+func (e *ndjsonEncoder) close() error {
+	return nil
+}
+
+// jsonEncoder writes companies as one JSON array
+type jsonEncoder struct {
+	w       io.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+func (e *jsonEncoder) encode(company Company) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+
+	return e.encoder.Encode(company)
+}
+
+func (e *jsonEncoder) close() error {
+	_, err := io.WriteString(e.w, "]")
+	return err
+}
+
+// exportCompanies streams all companies matching the filter, the response is written after the handler returns,
+// so errors happened in the middle of the export can only be logged and the response is cut
+func (h companiesHandler) exportCompanies(c *fiber.Ctx) error {
+	var req ExportCompaniesRequest
+	if err := c.QueryParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	format := req.Format
+	if format == "" {
+		format = ExportFormatJSON
+	}
+
+	ctx := c.UserContext()
+	filter := CompanyFilterToService(req.CompanyFilterRequest)
+
+	c.Set(fiber.HeaderContentType, exportContentTypes[format])
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="companies.%s"`, format))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.writeExport(ctx, w, format, filter); err != nil {
+			slog.Error("failed to export companies", "format", format, "error", err.Error())
+		}
+	})
+
+	return nil
+}
+
+func (h companiesHandler) writeExport(ctx context.Context, w *bufio.Writer, format string, filter services.CompanyFilter) error {
+	encoder, err := newCompanyEncoder(format, w)
+	if err != nil {
+		return err
+	}
+
+	err = h.srv.Export(ctx, filter, func(company services.Company) error {
+		return encoder.encode(CompanyFromService(company))
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := encoder.close(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
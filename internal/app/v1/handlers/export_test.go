@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/handlers"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCompanies(t *testing.T) {
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	exported := []services.Company{
+		{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "first", Description: "with, comma", AmountOfEmployees: 10, Registered: true, Type: "Corporations", CreatedAt: createdAt, CreatedBy: "alice", UpdatedAt: createdAt, UpdatedBy: "alice"},
+		{ID: "605c72efb1e2c3d1f8a1b2c4", Name: "second", AmountOfEmployees: 20, Type: "NonProfit", CreatedAt: createdAt, UpdatedAt: createdAt},
+	}
+
+	doExport := func(t *testing.T, query string, filter services.CompanyFilter, expectedContentType string) string {
+		t.Helper()
+
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:              t,
+			expectedFilter: filter,
+			returnExported: exported,
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/companies/export"+query, nil)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+		require.Equal(t, expectedContentType, response.Header.Get(fiber.HeaderContentType))
+
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		body := doExport(t, "?format=csv", services.CompanyFilter{}, "text/csv")
+		require.Equal(t, "id,name,description,amount_of_employees,registered,type,created_at,created_by,updated_at,updated_by\n"+
+			"605c72efb1e2c3d1f8a1b2c3,first,\"with, comma\",10,true,Corporations,2026-01-01T00:00:00Z,alice,2026-01-01T00:00:00Z,alice\n"+
+			"605c72efb1e2c3d1f8a1b2c4,second,,20,false,NonProfit,2026-01-01T00:00:00Z,,2026-01-01T00:00:00Z,\n", body)
+	})
+
+	t.Run("ndjson with filter", func(t *testing.T) {
+		registered := true
+		body := doExport(t, "?format=ndjson&type=NonProfit&registered=true", services.CompanyFilter{Type: "NonProfit", Registered: &registered}, "application/x-ndjson")
+
+		decoder := json.NewDecoder(strings.NewReader(body))
+		var companies []handlers.Company
+		for decoder.More() {
+			var company handlers.Company
+			require.NoError(t, decoder.Decode(&company))
+			companies = append(companies, company)
+		}
+		require.Len(t, companies, 2)
+		require.Equal(t, "first", companies[0].Name)
+		require.Equal(t, "second", companies[1].Name)
+	})
+
+	t.Run("json by default", func(t *testing.T) {
+		body := doExport(t, "", services.CompanyFilter{}, "application/json")
+
+		var companies []handlers.Company
+		require.NoError(t, json.Unmarshal([]byte(body), &companies))
+		require.Len(t, companies, 2)
+		require.Equal(t, handlers.CompanyFromService(exported[0]), companies[0])
+	})
+
+	t.Run("empty json", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{t: t}, nil)
+
+		response, err := fiberApp.Test(httptest.NewRequest("GET", "/companies/export?format=json", nil))
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		require.Equal(t, "[]", string(body))
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		doTest := func(query string) {
+			response, err := fiberApp.Test(httptest.NewRequest("GET", "/companies/export?"+query, nil))
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+		}
+
+		doTest("format=xml")
+		doTest("type=Unknown")
+		doTest("min_employees=100&max_employees=10")
+	})
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	ImportModeCreate = "create"
+	ImportModeUpsert = "upsert"
+
+	mimeTextCSV           = "text/csv"
+	mimeApplicationNDJSON = "application/x-ndjson"
+
+	// importBatchSize is the number of companies created by one bulk insert during the import
+	importBatchSize = 500
+	// maxNDJSONLine is the maximum length of the NDJSON line
+	maxNDJSONLine = 1 << 20
+	// maxImportErrors is the maximum number of row errors in the import response, the rest are only counted
+	maxImportErrors = 1000
+)
+
+var errUnsupportedImportType = fmt.Errorf("content type should be %s or %s", mimeTextCSV, mimeApplicationNDJSON)
+
+// importRow is a company read from the import file, err is set if the row can not be parsed
+type importRow struct {
+	line int
+	req  CreateCompanyRequest
+	err  error
+}
+
+// rowReader reads the import file row by row, io.EOF is returned after the last row
+type rowReader interface {
+	next() (importRow, error)
+}
+
+func newRowReader(contentType string, r io.Reader) (rowReader, error) {
+	switch contentType {
+	case mimeTextCSV:
+		return newCSVRowReader(r)
+	case mimeApplicationNDJSON:
+		return newNDJSONRowReader(r), nil
+	default:
+		return nil, errUnsupportedImportType
+	}
+}
+
+// csvRowReader reads CSV file with header row, columns are named as JSON fields of CreateCompanyRequest
+type csvRowReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+var csvColumns = []string{"name", "description", "amount_of_employees", "registered", "type"}
+
+func newCSVRowReader(r io.Reader) (*csvRowReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+
+	for _, column := range csvColumns {
+		// description is optional the same way as in create request
+		if _, ok := columns[column]; !ok && column != "description" {
+			return nil, fmt.Errorf("CSV header has no %s column", column)
+		}
+	}
+
+	return &csvRowReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvRowReader) next() (importRow, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+			return importRow{line: parseErr.StartLine, err: err}, nil
+		}
+		return importRow{}, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	row := importRow{line: line}
+	value := func(column string) string {
+		if i, ok := r.columns[column]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row.req.Name = value("name")
+	row.req.Description = value("description")
+	row.req.Type = value("type")
+
+	if amount := value("amount_of_employees"); amount != "" {
+		if row.req.AmountOfEmployees, err = strconv.Atoi(amount); err != nil {
+			row.err = fmt.Errorf("invalid amount_of_employees: %w", err)
+			return row, nil
+		}
+	}
+
+	if registered := value("registered"); registered != "" {
+		b, err := strconv.ParseBool(registered)
+		if err != nil {
+			row.err = fmt.Errorf("invalid registered: %w", err)
+			return row, nil
+		}
+		row.req.Registered = &b
+	}
+
+	return row, nil
+}
+
+// ndjsonRowReader reads one JSON encoded CreateCompanyRequest per line, empty lines are skipped
+type ndjsonRowReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONRowReader(r io.Reader) *ndjsonRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxNDJSONLine)
+
+	return &ndjsonRowReader{scanner: scanner}
+}
+
+func (r *ndjsonRowReader) next() (importRow, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		data := bytes.TrimSpace(r.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := importRow{line: r.line}
+		row.err = json.Unmarshal(data, &row.req)
+		return row, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return importRow{}, err
+	}
+
+	return importRow{}, io.EOF
+}
+
+// importCompanies validates every row of the file and stores valid companies unless it is a dry run.
+// Rows are independent of each other, so the response has counters and errors of the failed rows.
+// Number of rows is not known before the file is read, so the events of the stored rows wait for room in the queue
+func (h companiesHandler) importCompanies(c *fiber.Ctx) error {
+	var req ImportRequest
+	if err := c.QueryParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	contentType := strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0])
+	reader, err := newRowReader(contentType, requestBody(c))
+	if errors.Is(err, errUnsupportedImportType) {
+		return handleErrorStatus(c, fiber.StatusUnsupportedMediaType, err)
+	}
+	if err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	res := ImportResponse{DryRun: req.DryRun, Errors: []ImportRowError{}}
+	batch := make([]importRow, 0, importBatchSize)
+	for {
+		row, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return handleErrorStatus(c, fiber.StatusBadRequest, err)
+		}
+
+		res.Total++
+		if row.err == nil {
+			row.err = h.validator.Struct(row.req)
+		}
+		if row.err != nil {
+			res.addError(row.line, BulkStatusInvalid, row.err)
+			continue
+		}
+
+		res.Valid++
+		if req.DryRun {
+			continue
+		}
+
+		if req.Mode == ImportModeUpsert {
+			h.upsertImportRow(c, row, &res)
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == importBatchSize {
+			h.createImportBatch(c, batch, &res)
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		h.createImportBatch(c, batch, &res)
+	}
+
+	// errors of the stored rows are found after the rows read later had been validated
+	slices.SortStableFunc(res.Errors, func(a, b ImportRowError) int { return a.Line - b.Line })
+
+	return c.JSON(res)
+}
+
+func (h companiesHandler) createImportBatch(c *fiber.Ctx, batch []importRow, res *ImportResponse) {
+	companies := make([]services.Company, 0, len(batch))
+	for _, row := range batch {
+		companies = append(companies, CompanyFromCreateRequest(row.req))
+	}
+
+	created, errs := h.srv.CreateMany(c.UserContext(), companies)
+	for i, row := range batch {
+		switch {
+		case errs[i] == nil:
+			res.Created++
+			event := CompanyCreatedEvent(created[i])
+			h.publishBlocking(func(p EventsPublisher) error { return p.OnCreateCompany(event) })
+		case errors.As(errs[i], &services.ErrDbDuplicatedKey{}):
+			res.addError(row.line, BulkStatusDuplicate, errs[i])
+		default:
+			res.addError(row.line, BulkStatusFailed, errs[i])
+		}
+	}
+}
+
+func (h companiesHandler) upsertImportRow(c *fiber.Ctx, row importRow, res *ImportResponse) {
+	change, err := h.srv.UpsertByName(c.UserContext(), CompanyFromCreateRequest(row.req))
+	switch {
+	case err == nil && change.Created:
+		res.Created++
+		event := CompanyCreatedEvent(change.Company)
+		h.publishBlocking(func(p EventsPublisher) error { return p.OnCreateCompany(event) })
+	case err == nil:
+		res.Updated++
+		event := CompanyUpdatedEvent(change)
+		h.publishBlocking(func(p EventsPublisher) error { return p.OnPatchCompany(event) })
+	case errors.As(err, &services.ErrDbDuplicatedKey{}):
+		res.addError(row.line, BulkStatusDuplicate, err)
+	default:
+		res.addError(row.line, BulkStatusFailed, err)
+	}
+}
+
+func (r *ImportResponse) addError(line int, status string, err error) {
+	if len(r.Errors) == maxImportErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	r.Errors = append(r.Errors, ImportRowError{Line: line, Status: status, Error: err.Error()})
+}
+
+// requestBody returns the body of the request, it is read as a stream when the server streams request bodies,
+// so the file is not kept in memory and is not limited by the body limit
+func requestBody(c *fiber.Ctx) io.Reader {
+	if stream := c.Context().RequestBodyStream(); stream != nil {
+		return stream
+	}
+	return bytes.NewReader(c.Body())
+}
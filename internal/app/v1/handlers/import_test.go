@@ -0,0 +1,168 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/handlers"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportCompanies(t *testing.T) {
+	doImport := func(t *testing.T, fiberApp *fiber.App, target, contentType, body string) handlers.ImportResponse {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		var res handlers.ImportResponse
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&res))
+		return res
+	}
+
+	t.Run("csv import", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		eventsChan := make(chan any, 1)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t: t,
+			expectedCompanies: []services.Company{
+				{Name: "first", Description: "first, the best", AmountOfEmployees: 10, Registered: true, Type: "Corporations"},
+				{Name: "second", AmountOfEmployees: 20, Type: "NonProfit"},
+			},
+			returnCompanies: []services.Company{{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "first"}, {}},
+			returnErrors:    []error{nil, services.ErrDbDuplicatedKey{}},
+		}, &mockOverloadedPublisher{capacity: 1, blocking: newMockPublisher(eventsChan)})
+
+		body := "name,description,amount_of_employees,registered,type\n" +
+			`first,"first, the best",10,true,Corporations` + "\n" +
+			"second,,20,false,NonProfit\n" +
+			"third,,many,false,NonProfit\n" +
+			"fourth,,10,false\n" +
+			"fifth,,10,,NonProfit\n"
+
+		res := doImport(t, fiberApp, "/companies/import", "text/csv; charset=utf-8", body)
+		require.Equal(t, 5, res.Total)
+		require.Equal(t, 2, res.Valid)
+		require.Equal(t, 1, res.Created)
+		require.False(t, res.DryRun)
+
+		require.Len(t, res.Errors, 4)
+		require.Equal(t, []int{3, 4, 5, 6}, []int{res.Errors[0].Line, res.Errors[1].Line, res.Errors[2].Line, res.Errors[3].Line})
+		require.Equal(t, handlers.BulkStatusDuplicate, res.Errors[0].Status)
+		require.Equal(t, handlers.BulkStatusInvalid, res.Errors[1].Status)
+		require.Equal(t, handlers.BulkStatusInvalid, res.Errors[2].Status)
+		require.Equal(t, handlers.BulkStatusInvalid, res.Errors[3].Status)
+
+		select {
+		case e := <-eventsChan:
+			require.Equal(t, "605c72efb1e2c3d1f8a1b2c3", e.(events.CompanyCreated).Company.ID)
+		case <-time.After(time.Second):
+			require.FailNow(t, "event is not published")
+		}
+	})
+
+	t.Run("ndjson dry run", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		// nothing is stored during dry run
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		body := `{"name":"first","amount_of_employees":10,"registered":true,"type":"Corporations"}` + "\n" +
+			"\n" +
+			`{"name":"second","amount_of_employees":10,"registered":true,"type":"Unknown"}` + "\n" +
+			`{"name":` + "\n"
+
+		res := doImport(t, fiberApp, "/companies/import?dry_run=true", "application/x-ndjson", body)
+		require.True(t, res.DryRun)
+		require.Equal(t, 3, res.Total)
+		require.Equal(t, 1, res.Valid)
+		require.Zero(t, res.Created)
+
+		require.Len(t, res.Errors, 2)
+		require.Equal(t, 3, res.Errors[0].Line)
+		require.Equal(t, 4, res.Errors[1].Line)
+	})
+
+	t.Run("streamed file larger than body limit", func(t *testing.T) {
+		fiberApp := fiber.New(fiber.Config{StreamRequestBody: true, BodyLimit: 1024})
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		// every row is invalid, so only the first of the errors are reported
+		var body strings.Builder
+		body.WriteString("name,amount_of_employees,registered,type\n")
+		for range 2000 {
+			body.WriteString("company,many,true,NonProfit\n")
+		}
+
+		res := doImport(t, fiberApp, "/companies/import?dry_run=true", "text/csv", body.String())
+		require.Equal(t, 2000, res.Total)
+		require.Zero(t, res.Valid)
+		require.Len(t, res.Errors, 1000)
+		require.True(t, res.ErrorsTruncated)
+		require.Equal(t, 2, res.Errors[0].Line)
+	})
+
+	t.Run("upsert by name", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		eventsChan := make(chan any, 1)
+		handlers.SetupCompaniesRoutes(fiberApp, mockCompaniesService{
+			t:               t,
+			expectedCompany: services.Company{Name: "first", AmountOfEmployees: 10, Registered: true, Type: "Corporations"},
+			returnCompany:   services.Company{ID: "605c72efb1e2c3d1f8a1b2c3", Name: "first"},
+		}, newMockPublisher(eventsChan))
+
+		body := `{"name":"first","amount_of_employees":10,"registered":true,"type":"Corporations"}`
+
+		res := doImport(t, fiberApp, "/companies/import?mode=upsert", "application/x-ndjson", body)
+		require.Equal(t, 1, res.Total)
+		require.Equal(t, 1, res.Updated)
+		require.Zero(t, res.Created)
+		require.Empty(t, res.Errors)
+
+		select {
+		case e := <-eventsChan:
+			require.Equal(t, "605c72efb1e2c3d1f8a1b2c3", e.(events.CompanyUpdated).Company.ID)
+		case <-time.After(time.Second):
+			require.FailNow(t, "event is not published")
+		}
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil)
+
+		doTest := func(target, contentType, body string, expectedStatus int) {
+			req := httptest.NewRequest("POST", target, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			defer response.Body.Close()
+			require.Equal(t, expectedStatus, response.StatusCode)
+		}
+
+		doTest("/companies/import", "application/json", "[]", fiber.StatusUnsupportedMediaType)
+		doTest("/companies/import?mode=replace", "text/csv", "name", fiber.StatusBadRequest)
+		doTest("/companies/import?dry_run=maybe", "text/csv", "name", fiber.StatusBadRequest)
+		doTest("/companies/import", "text/csv", "", fiber.StatusBadRequest)
+		doTest("/companies/import", "text/csv", "name,amount_of_employees,registered\n", fiber.StatusBadRequest)
+		doTest("/companies/import", "text/csv", "name,amount_of_employees,registered,type\n\"broken,1,true,NonProfit\n", fiber.StatusBadRequest)
+	})
+}
@@ -1,6 +1,14 @@
 package handlers
 
-import "github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+)
 
 type CreateCompanyRequest struct {
 	Name              string `json:"name" validate:"required,max=15"`
@@ -10,6 +18,11 @@ type CreateCompanyRequest struct {
 	Type              string `json:"type" validate:"required,oneof=Corporations NonProfit Cooperative 'Sole Proprietorship'"`
 }
 
+// maxBulkCompanies is the maximum number of companies in one bulk create request
+const maxBulkCompanies = 1000
+
+var errInvalidBulkSize = fmt.Errorf("request should contain from 1 to %d companies", maxBulkCompanies)
+
 type UpdateCompanyRequest struct {
 	Name              string  `json:"name" validate:"required,max=15"`
 	Description       *string `json:"description" validate:"omitempty,max=3000"`
@@ -18,13 +31,171 @@ type UpdateCompanyRequest struct {
 	Type              string  `json:"type" validate:"required,oneof=Corporations NonProfit Cooperative 'Sole Proprietorship'"`
 }
 
+// CompanyFilterRequest has query parameters companies can be filtered by
+type CompanyFilterRequest struct {
+	Type          string `query:"type" validate:"omitempty,oneof=Corporations NonProfit Cooperative 'Sole Proprietorship'"`
+	Registered    *bool  `query:"registered"`
+	MinEmployees  *int   `query:"min_employees" validate:"omitempty,gte=0"`
+	MaxEmployees  *int   `query:"max_employees" validate:"omitempty,gte=0"`
+	CreatedAfter  string `query:"created_after" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedBefore string `query:"created_before" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedBy     string `query:"created_by"`
+	UpdatedAfter  string `query:"updated_after" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	UpdatedBefore string `query:"updated_before" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	UpdatedBy     string `query:"updated_by"`
+}
+
+type ListCompaniesRequest struct {
+	CompanyFilterRequest
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"omitempty,gte=1"`
+	Sort   string `query:"sort" validate:"omitempty,sort"`
+}
+
+type ExportCompaniesRequest struct {
+	CompanyFilterRequest
+	Format string `query:"format" validate:"omitempty,oneof=csv ndjson json"`
+}
+
+type StreamEventsRequest struct {
+	Type string `query:"type" validate:"omitempty,oneof=Corporations NonProfit Cooperative 'Sole Proprietorship'"`
+}
+
+type SearchCompaniesRequest struct {
+	Query string `query:"q" validate:"required,max=200"`
+	Limit int    `query:"limit" validate:"omitempty,gte=1"`
+}
+
+type HistoryRequest struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"omitempty,gte=1"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string `json:"url" validate:"required,http_url,max=2048"`
+	Secret string `json:"secret" validate:"omitempty,min=16,max=256"`
+}
+
+type WebhookDeliveriesRequest struct {
+	Limit int `query:"limit" validate:"omitempty,gte=1,lte=100"`
+}
+
+type ImportRequest struct {
+	DryRun bool   `query:"dry_run"`
+	Mode   string `query:"mode" validate:"omitempty,oneof=create upsert"`
+}
+
 type Company struct {
-	ID                string `json:"id"`
-	Name              string `json:"name"`
-	Description       string `json:"description,omitempty"`
-	AmountOfEmployees int    `json:"amount_of_employees"`
-	Registered        bool   `json:"registered"`
-	Type              string `json:"type"`
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Description       string    `json:"description,omitempty"`
+	AmountOfEmployees int       `json:"amount_of_employees"`
+	Registered        bool      `json:"registered"`
+	Type              string    `json:"type"`
+	CreatedAt         time.Time `json:"created_at"`
+	CreatedBy         string    `json:"created_by,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	UpdatedBy         string    `json:"updated_by,omitempty"`
+}
+
+const (
+	BulkStatusCreated   = "created"
+	BulkStatusInvalid   = "invalid"
+	BulkStatusDuplicate = "duplicate"
+	BulkStatusFailed    = "failed"
+)
+
+type BulkCreateResult struct {
+	Index   int      `json:"index"`
+	Status  string   `json:"status"`
+	Company *Company `json:"company,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type BulkCreateResponse struct {
+	Results []BulkCreateResult `json:"results"`
+}
+
+type ImportRowError struct {
+	// Line is the line of the file the row starts at
+	Line   int    `json:"line"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+type ImportResponse struct {
+	DryRun  bool             `json:"dry_run"`
+	Total   int              `json:"total"`
+	Valid   int              `json:"valid"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Errors  []ImportRowError `json:"errors"`
+	// ErrorsTruncated is set when there are more failed rows than reported in Errors
+	ErrorsTruncated bool `json:"errors_truncated"`
+}
+
+type ListCompaniesResponse struct {
+	Companies  []Company `json:"companies"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+type SearchResult struct {
+	Company
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+type SearchCompaniesResponse struct {
+	Results []SearchResult `json:"results"`
+}
+
+type HistoryEntry struct {
+	ID        string        `json:"id"`
+	CompanyID string        `json:"company_id"`
+	Action    string        `json:"action"`
+	Actor     string        `json:"actor,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+type HistoryResponse struct {
+	Entries    []HistoryEntry `json:"entries"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// Webhook is the webhook subscription, the secret is shown only when the subscription is created
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
 }
 
 func CompanyFromService(company services.Company) Company {
@@ -35,12 +206,32 @@ func CompanyFromService(company services.Company) Company {
 		AmountOfEmployees: company.AmountOfEmployees,
 		Registered:        company.Registered,
 		Type:              company.Type,
+		CreatedAt:         company.CreatedAt,
+		CreatedBy:         company.CreatedBy,
+		UpdatedAt:         company.UpdatedAt,
+		UpdatedBy:         company.UpdatedBy,
 	}
 }
 
-func CompanyUpdateToService(id string, req UpdateCompanyRequest) services.CompanyUpdate {
+func CompanyFromCreateRequest(req CreateCompanyRequest) services.Company {
+	var registered bool
+	if req.Registered != nil {
+		registered = *req.Registered
+	}
+
+	return services.Company{
+		Name:              req.Name,
+		Description:       req.Description,
+		AmountOfEmployees: req.AmountOfEmployees,
+		Registered:        registered,
+		Type:              req.Type,
+	}
+}
+
+func CompanyUpdateToService(id string, version int64, req UpdateCompanyRequest) services.CompanyUpdate {
 	return services.CompanyUpdate{
 		ID:                id,
+		Version:           version,
 		Name:              req.Name,
 		Description:       req.Description,
 		AmountOfEmployees: req.AmountOfEmployees,
@@ -48,3 +239,171 @@ func CompanyUpdateToService(id string, req UpdateCompanyRequest) services.Compan
 		Type:              req.Type,
 	}
 }
+
+func ListQueryToService(req ListCompaniesRequest) services.ListQuery {
+	return services.ListQuery{
+		Cursor: req.Cursor,
+		Limit:  req.Limit,
+		Filter: CompanyFilterToService(req.CompanyFilterRequest),
+		Sort:   SortToService(req.Sort),
+	}
+}
+
+func CompanyFilterToService(req CompanyFilterRequest) services.CompanyFilter {
+	return services.CompanyFilter{
+		Type:          req.Type,
+		Registered:    req.Registered,
+		MinEmployees:  req.MinEmployees,
+		MaxEmployees:  req.MaxEmployees,
+		CreatedAfter:  parseTime(req.CreatedAfter),
+		CreatedBefore: parseTime(req.CreatedBefore),
+		CreatedBy:     req.CreatedBy,
+		UpdatedAfter:  parseTime(req.UpdatedAfter),
+		UpdatedBefore: parseTime(req.UpdatedBefore),
+		UpdatedBy:     req.UpdatedBy,
+	}
+}
+
+// parseTime parses already validated RFC 3339 time, empty value means the time is not set
+func parseTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// SortToService converts sort query parameter like "-amount_of_employees,name" to the list of sort fields
+func SortToService(sort string) []services.SortField {
+	if sort == "" {
+		return nil
+	}
+
+	var res []services.SortField
+	for _, field := range strings.Split(sort, ",") {
+		res = append(res, services.SortField{
+			Field: strings.TrimPrefix(field, "-"),
+			Desc:  strings.HasPrefix(field, "-"),
+		})
+	}
+
+	return res
+}
+
+func CompaniesPageFromService(page services.CompaniesPage) ListCompaniesResponse {
+	companies := make([]Company, 0, len(page.Companies))
+	for _, company := range page.Companies {
+		companies = append(companies, CompanyFromService(company))
+	}
+
+	return ListCompaniesResponse{
+		Companies:  companies,
+		NextCursor: page.NextCursor,
+	}
+}
+
+func SearchResultsFromService(results []services.SearchResult) SearchCompaniesResponse {
+	res := make([]SearchResult, 0, len(results))
+	for _, r := range results {
+		res = append(res, SearchResult{
+			Company:    CompanyFromService(r.Company),
+			Score:      r.Score,
+			Highlights: r.Highlights,
+		})
+	}
+
+	return SearchCompaniesResponse{Results: res}
+}
+
+func HistoryPageFromService(page services.HistoryPage) HistoryResponse {
+	entries := make([]HistoryEntry, 0, len(page.Entries))
+	for _, e := range page.Entries {
+		var changes []FieldChange
+		for _, c := range e.Changes {
+			changes = append(changes, FieldChange{Field: c.Field, Before: c.Before, After: c.After})
+		}
+
+		entries = append(entries, HistoryEntry{
+			ID:        e.ID,
+			CompanyID: e.CompanyID,
+			Action:    e.Action,
+			Actor:     e.Actor,
+			RequestID: e.RequestID,
+			Timestamp: e.Timestamp,
+			Changes:   changes,
+		})
+	}
+
+	return HistoryResponse{
+		Entries:    entries,
+		NextCursor: page.NextCursor,
+	}
+}
+
+func WebhookFromRepository(subscription repositories.WebhookSubscription) Webhook {
+	return Webhook{
+		ID:        subscription.ID,
+		URL:       subscription.URL,
+		CreatedAt: subscription.CreatedAt,
+		CreatedBy: subscription.CreatedBy,
+	}
+}
+
+func WebhookDeliveriesFromRepository(deliveries []repositories.WebhookDelivery) WebhookDeliveriesResponse {
+	res := make([]WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		res = append(res, WebhookDelivery{
+			ID:         d.ID,
+			EventID:    d.EventID,
+			EventType:  d.EventType,
+			Attempt:    d.Attempt,
+			StatusCode: d.StatusCode,
+			Error:      d.Error,
+			Timestamp:  d.Timestamp,
+			DurationMs: d.Duration.Milliseconds(),
+		})
+	}
+
+	return WebhookDeliveriesResponse{Deliveries: res}
+}
+
+// CompanyCreatedEvent returns event of the company created now
+func CompanyCreatedEvent(company services.Company) events.CompanyCreated {
+	return events.CompanyCreated{Metadata: events.NewMetadata(), Company: EventCompanyFromService(company)}
+}
+
+// CompanyUpdatedEvent returns event of the company updated now
+func CompanyUpdatedEvent(change services.CompanyChange) events.CompanyUpdated {
+	changes := make([]events.FieldChange, 0, len(change.Changes))
+	for _, c := range change.Changes {
+		changes = append(changes, events.FieldChange{Field: c.Field, Before: c.Before, After: c.After})
+	}
+
+	return events.CompanyUpdated{Metadata: events.NewMetadata(), Company: EventCompanyFromService(change.Company), Changes: changes}
+}
+
+// CompanyDeletedEvent returns event of the deleted company, the id is copied because the event outlives
+// the request and fiber reuses buffers of the request path parameters
+func CompanyDeletedEvent(id string) events.CompanyDeleted {
+	return events.CompanyDeleted{Metadata: events.NewMetadata(), CompanyID: strings.Clone(id)}
+}
+
+func EventCompanyFromService(company services.Company) events.Company {
+	return events.Company{
+		ID:                company.ID,
+		Name:              company.Name,
+		Description:       company.Description,
+		AmountOfEmployees: company.AmountOfEmployees,
+		Registered:        company.Registered,
+		Type:              company.Type,
+		Version:           company.Version,
+		CreatedAt:         company.CreatedAt,
+		CreatedBy:         company.CreatedBy,
+		UpdatedAt:         company.UpdatedAt,
+		UpdatedBy:         company.UpdatedBy,
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/broadcast"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	mimeTextEventStream = "text/event-stream"
+
+	// streamHeartbeat is how often comment is sent to the idle stream, it keeps proxies from closing
+	// the connection and detects disconnected clients
+	streamHeartbeat = 15 * time.Second
+)
+
+// streamEvents streams company events as Server-Sent Events. Client reconnecting with Last-Event-ID header
+// gets events it has missed first, if they are still buffered. Deleted events have no company type,
+// so they are streamed regardless of the type filter
+func (h companiesHandler) streamEvents(c *fiber.Ctx) error {
+	var req StreamEventsRequest
+	if err := c.QueryParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	missed, subscription := h.eventsStream.Subscribe(c.Get("Last-Event-ID"))
+
+	c.Set(fiber.HeaderContentType, mimeTextEventStream)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.eventsStream.Unsubscribe(subscription)
+
+		if err := writeEventsStream(w, missed, subscription, req.Type); err != nil {
+			slog.Debug("events stream is closed", "error", err.Error())
+		}
+	})
+
+	return nil
+}
+
+// writeEventsStream writes the events until the subscription is closed or writing fails because the client is gone
+func writeEventsStream(w *bufio.Writer, missed []events.Event, subscription *broadcast.Subscription, companyType string) error {
+	// headers are sent with the first written data, the comment lets the client know the stream is open
+	if _, err := w.WriteString(": stream opened\n\n"); err != nil {
+		return err
+	}
+
+	for _, e := range missed {
+		if err := writeStreamEvent(w, e, companyType); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-subscription.C:
+			if !ok {
+				return nil
+			}
+			if err := writeStreamEvent(w, e, companyType); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if _, err := w.WriteString(": heartbeat\n\n"); err != nil {
+				return err
+			}
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// writeStreamEvent writes the event as CloudEvent in the data field, events of other company types are skipped
+func writeStreamEvent(w *bufio.Writer, e events.Event, companyType string) error {
+	if companyType != "" && !eventHasCompanyType(e, companyType) {
+		return nil
+	}
+
+	data, err := events.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.Meta().ID, e.Type(), data)
+	return err
+}
+
+// eventHasCompanyType checks whether the event is about company of the type, update changing the type
+// matches both types, so the client learns that the company has left the type. Deleted event has
+// no company type and matches any type
+func eventHasCompanyType(e events.Event, companyType string) bool {
+	switch e := e.(type) {
+	case events.CompanyCreated:
+		return e.Company.Type == companyType
+	case events.CompanyUpdated:
+		if e.Company.Type == companyType {
+			return true
+		}
+		for _, change := range e.Changes {
+			if change.Field == "type" && change.Before == companyType {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
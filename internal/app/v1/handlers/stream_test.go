@@ -0,0 +1,115 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/handlers"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/broadcast"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEvents(t *testing.T) {
+	missed := []events.Event{
+		events.CompanyCreated{Metadata: events.Metadata{ID: "1"}, Company: events.Company{ID: "a", Type: "Corporations"}},
+		events.CompanyCreated{Metadata: events.Metadata{ID: "2"}, Company: events.Company{ID: "b", Type: "NonProfit"}},
+	}
+	live := []events.Event{
+		events.CompanyUpdated{
+			Metadata: events.Metadata{ID: "3"},
+			Company:  events.Company{ID: "a", Type: "NonProfit"},
+			Changes:  []events.FieldChange{{Field: "type", Before: "Corporations", After: "NonProfit"}},
+		},
+		events.CompanyUpdated{Metadata: events.Metadata{ID: "4"}, Company: events.Company{ID: "b", Type: "NonProfit"}},
+		events.CompanyDeleted{Metadata: events.Metadata{ID: "5"}, CompanyID: "b"},
+	}
+
+	doStream := func(t *testing.T, query, lastEventID string) (*mockEventsStream, string) {
+		t.Helper()
+
+		stream := newMockEventsStream(missed, live)
+		fiberApp := initFiberApp()
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil, handlers.WithEventsStream(stream))
+
+		req := httptest.NewRequest("GET", "/companies/events"+query, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		response, err := fiberApp.Test(req, -1)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+		require.Equal(t, "text/event-stream", response.Header.Get(fiber.HeaderContentType))
+		require.Equal(t, "no-cache", response.Header.Get(fiber.HeaderCacheControl))
+
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return stream, string(body)
+	}
+
+	expected := func(t *testing.T, e events.Event) string {
+		data, err := events.Marshal(e)
+		require.NoError(t, err)
+		return "id: " + e.Meta().ID + "\nevent: " + e.Type() + "\ndata: " + string(data) + "\n\n"
+	}
+
+	t.Run("resumes after the last event", func(t *testing.T) {
+		stream, body := doStream(t, "", "0")
+		require.Equal(t, "0", stream.lastEventID)
+		require.True(t, stream.unsubscribed)
+
+		all := ": stream opened\n\n"
+		for _, e := range append(missed, live...) {
+			all += expected(t, e)
+		}
+		require.Equal(t, all, body)
+	})
+
+	t.Run("filters by company type", func(t *testing.T) {
+		_, body := doStream(t, "?type=Corporations", "")
+		// the update moves the company out of the type and deleted company type is not known
+		require.Equal(t, ": stream opened\n\n"+expected(t, missed[0])+expected(t, live[0])+expected(t, live[2]), body)
+	})
+
+	t.Run("bad request error", func(t *testing.T) {
+		fiberApp := initFiberApp()
+		handlers.SetupCompaniesRoutes(fiberApp, nil, nil, handlers.WithEventsStream(newMockEventsStream(nil, nil)))
+
+		response, err := fiberApp.Test(httptest.NewRequest("GET", "/companies/events?type=Unknown", nil))
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+	})
+}
+
+// mockEventsStream returns the missed events and subscription having the live events, which is closed after them
+type mockEventsStream struct {
+	missed       []events.Event
+	live         []events.Event
+	lastEventID  string
+	unsubscribed bool
+}
+
+func newMockEventsStream(missed, live []events.Event) *mockEventsStream {
+	return &mockEventsStream{missed: missed, live: live}
+}
+
+func (m *mockEventsStream) Subscribe(lastEventID string) ([]events.Event, *broadcast.Subscription) {
+	m.lastEventID = lastEventID
+
+	ch := make(chan events.Event, len(m.live))
+	for _, e := range m.live {
+		ch <- e
+	}
+	close(ch)
+
+	return m.missed, &broadcast.Subscription{C: ch}
+}
+
+func (m *mockEventsStream) Unsubscribe(*broadcast.Subscription) {
+	m.unsubscribed = true
+}
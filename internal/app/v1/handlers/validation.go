@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// sortableFields are fields companies list can be sorted by
+var sortableFields = map[string]struct{}{
+	"name":                {},
+	"amount_of_employees": {},
+	"registered":          {},
+	"type":                {},
+	"created_at":          {},
+	"created_by":          {},
+	"updated_at":          {},
+	"updated_by":          {},
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterValidation("sort", validateSort) //nolint errcheck
+	v.RegisterStructValidation(validateCompanyFilterRequest, CompanyFilterRequest{})
+
+	return v
+}
+
+// validateSort checks comma separated list of sortable fields, every field can be prefixed by '-' for descending order
+func validateSort(fl validator.FieldLevel) bool {
+	seen := make(map[string]struct{})
+	for _, field := range strings.Split(fl.Field().String(), ",") {
+		field = strings.TrimPrefix(field, "-")
+		if _, ok := sortableFields[field]; !ok {
+			return false
+		}
+
+		if _, ok := seen[field]; ok {
+			return false
+		}
+		seen[field] = struct{}{}
+	}
+
+	return true
+}
+
+func validateCompanyFilterRequest(sl validator.StructLevel) {
+	req, ok := sl.Current().Interface().(CompanyFilterRequest)
+	if !ok {
+		return
+	}
+
+	if req.MinEmployees != nil && req.MaxEmployees != nil && *req.MaxEmployees < *req.MinEmployees {
+		sl.ReportError(req.MaxEmployees, "MaxEmployees", "max_employees", "gtefield", "MinEmployees")
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultDeliveriesLimit is the number of deliveries returned when the limit is not set
+const defaultDeliveriesLimit = 20
+
+type WebhooksService interface {
+	Subscribe(ctx context.Context, url, secret string) (repositories.WebhookSubscription, error)
+	Subscriptions(ctx context.Context) ([]repositories.WebhookSubscription, error)
+	Unsubscribe(ctx context.Context, id string) error
+	Deliveries(ctx context.Context, subscriptionID string, limit int) ([]repositories.WebhookDelivery, error)
+}
+
+type webhooksHandler struct {
+	srv       WebhooksService
+	validator *validator.Validate
+}
+
+// subscribe adds subscriber, the secret is returned only in this response
+func (h webhooksHandler) subscribe(c *fiber.Ctx) error {
+	var req CreateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	subscription, err := h.srv.Subscribe(c.UserContext(), req.URL, req.Secret)
+	if err != nil {
+		return handleWebhookError(c, err)
+	}
+
+	res := WebhookFromRepository(subscription)
+	res.Secret = subscription.Secret
+	return c.Status(fiber.StatusCreated).JSON(res)
+}
+
+func (h webhooksHandler) listSubscriptions(c *fiber.Ctx) error {
+	subscriptions, err := h.srv.Subscriptions(c.UserContext())
+	if err != nil {
+		return handleWebhookError(c, err)
+	}
+
+	res := ListWebhooksResponse{Webhooks: make([]Webhook, 0, len(subscriptions))}
+	for _, subscription := range subscriptions {
+		res.Webhooks = append(res.Webhooks, WebhookFromRepository(subscription))
+	}
+
+	return c.JSON(res)
+}
+
+func (h webhooksHandler) unsubscribe(c *fiber.Ctx) error {
+	if err := h.srv.Unsubscribe(c.UserContext(), c.Params("id")); err != nil {
+		return handleWebhookError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h webhooksHandler) listDeliveries(c *fiber.Ctx) error {
+	var req WebhookDeliveriesRequest
+	if err := c.QueryParser(&req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		return handleErrorStatus(c, fiber.StatusBadRequest, err)
+	}
+
+	if req.Limit == 0 {
+		req.Limit = defaultDeliveriesLimit
+	}
+
+	deliveries, err := h.srv.Deliveries(c.UserContext(), c.Params("id"), req.Limit)
+	if err != nil {
+		return handleWebhookError(c, err)
+	}
+
+	return c.JSON(WebhookDeliveriesFromRepository(deliveries))
+}
+
+func handleWebhookError(c *fiber.Ctx, err error) error {
+	if errors.As(err, &webhook.ErrNotFound{}) {
+		return handleErrorStatus(c, fiber.StatusNotFound, err)
+	}
+
+	return handleErrorStatus(c, fiber.StatusInternalServerError, err)
+}
+
+// SetupWebhooksRoutes registers management API of webhook subscribers. Subscribers and deliveries are not public,
+// so auth checks the GET requests which are not checked by the API authentication
+func SetupWebhooksRoutes(r fiber.Router, srv WebhooksService, auth fiber.Handler) {
+	handler := &webhooksHandler{
+		srv:       srv,
+		validator: newValidator(),
+	}
+
+	r.Post("/webhooks", handler.subscribe)
+	r.Get("/webhooks", auth, handler.listSubscriptions)
+	r.Delete("/webhooks/:id", handler.unsubscribe)
+	r.Get("/webhooks/:id/deliveries", auth, handler.listDeliveries)
+}
@@ -0,0 +1,106 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/handlers"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/memory"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	fiberApp := initFiberApp()
+	publisher := webhook.NewPublisher(memory.NewWebhooksRepository())
+	handlers.SetupWebhooksRoutes(fiberApp, publisher, mockAuth)
+
+	get := func(target string) *http.Request {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer token")
+		return req
+	}
+
+	var created handlers.Webhook
+	t.Run("subscribe", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(`{"url":"http://localhost:8080/hook"}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		response, err := fiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusCreated, response.StatusCode)
+
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&created))
+		require.NotEmpty(t, created.ID)
+		require.Equal(t, "http://localhost:8080/hook", created.URL)
+		require.Len(t, created.Secret, 64)
+	})
+
+	t.Run("invalid subscription", func(t *testing.T) {
+		for _, body := range []string{`{}`, `{"url":"localhost/hook"}`, `{"url":"ftp://localhost/hook"}`, `{"url":"http://localhost/hook","secret":"short"}`} {
+			req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			response, err := fiberApp.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusBadRequest, response.StatusCode, body)
+		}
+	})
+
+	t.Run("reads require auth", func(t *testing.T) {
+		for _, target := range []string{"/webhooks", "/webhooks/" + created.ID + "/deliveries"} {
+			response, err := fiberApp.Test(httptest.NewRequest("GET", target, nil))
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusUnauthorized, response.StatusCode, target)
+		}
+	})
+
+	t.Run("list subscriptions without secrets", func(t *testing.T) {
+		response, err := fiberApp.Test(get("/webhooks"))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		var res handlers.ListWebhooksResponse
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&res))
+		require.Len(t, res.Webhooks, 1)
+		require.Equal(t, created.ID, res.Webhooks[0].ID)
+		require.Empty(t, res.Webhooks[0].Secret)
+	})
+
+	t.Run("deliveries", func(t *testing.T) {
+		response, err := fiberApp.Test(get("/webhooks/" + created.ID + "/deliveries?limit=10"))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, response.StatusCode)
+
+		var res handlers.WebhookDeliveriesResponse
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&res))
+		require.Empty(t, res.Deliveries)
+
+		response, err = fiberApp.Test(get("/webhooks/" + created.ID + "/deliveries?limit=1000"))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		response, err := fiberApp.Test(httptest.NewRequest("DELETE", "/webhooks/"+created.ID, nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusNoContent, response.StatusCode)
+
+		response, err = fiberApp.Test(httptest.NewRequest("DELETE", "/webhooks/"+created.ID, nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusNotFound, response.StatusCode)
+
+		response, err = fiberApp.Test(get("/webhooks/" + created.ID + "/deliveries"))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusNotFound, response.StatusCode)
+	})
+}
+
+func mockAuth(c *fiber.Ctx) error {
+	if c.Get(fiber.HeaderAuthorization) != "Bearer token" {
+		return fiber.ErrUnauthorized
+	}
+	return c.Next()
+}
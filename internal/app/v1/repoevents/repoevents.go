@@ -0,0 +1,32 @@
+// Package repoevents maps the stored companies to the company events
+package repoevents
+
+import (
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+)
+
+func Company(company repositories.Company) events.Company {
+	return events.Company{
+		ID:                company.ID,
+		Name:              company.Name,
+		Description:       company.Description,
+		AmountOfEmployees: company.AmountOfEmployees,
+		Registered:        company.Registered,
+		Type:              company.Type,
+		Version:           company.Version,
+		CreatedAt:         company.CreatedAt,
+		CreatedBy:         company.CreatedBy,
+		UpdatedAt:         company.UpdatedAt,
+		UpdatedBy:         company.UpdatedBy,
+	}
+}
+
+func Changes(changes []repositories.FieldChange) []events.FieldChange {
+	result := make([]events.FieldChange, 0, len(changes))
+	for _, c := range changes {
+		result = append(result, events.FieldChange{Field: c.Field, Before: c.Before, After: c.After})
+	}
+
+	return result
+}
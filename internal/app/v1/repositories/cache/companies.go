@@ -0,0 +1,135 @@
+// Package cache has read-through cache of companies on top of any companies repository
+package cache
+
+import (
+	"context"
+	"hash/maphash"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+)
+
+// Store keeps cached companies by their ids
+type Store interface {
+	// Get returns cached company, false is returned if the company is not cached or has expired
+	Get(ctx context.Context, id string) (repositories.Company, bool, error)
+	Set(ctx context.Context, company repositories.Company) error
+	Delete(ctx context.Context, id string) error
+}
+
+// generationShards is the number of invalidation counters, companies share the counter when their ids
+// have the same hash, then the invalidation of one of them only skips caching of another
+const generationShards = 256
+
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// Companies caches results of Get of the wrapped repository, cached company is dropped when it is changed
+// through the repository. Companies changed bypassing the repository are served from the cache until they expire.
+// Cache failures are logged and do not fail the requests, the wrapped repository is used instead
+type Companies struct {
+	services.CompaniesRepository
+	store  Store
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	// generations are counters of invalidations, the company read from the wrapped repository is not cached
+	// if it has been invalidated during the read, as the read company may be older than the change
+	generations [generationShards]atomic.Uint64
+	seed        maphash.Seed
+}
+
+func NewCompaniesRepository(repo services.CompaniesRepository, store Store) *Companies {
+	return &Companies{CompaniesRepository: repo, store: store, seed: maphash.MakeSeed()}
+}
+
+func (r *Companies) Get(ctx context.Context, id string) (repositories.Company, error) {
+	company, ok, err := r.store.Get(ctx, id)
+	if err != nil {
+		slog.Warn("failed to get company from cache", "id", id, "error", err.Error())
+	}
+	if ok {
+		r.hits.Add(1)
+		return company, nil
+	}
+
+	r.misses.Add(1)
+	generation := r.generation(id)
+	started := generation.Load()
+	company, err = r.CompaniesRepository.Get(ctx, id)
+	if err != nil {
+		return company, err
+	}
+
+	if generation.Load() != started {
+		return company, nil
+	}
+	if err := r.store.Set(ctx, company); err != nil {
+		slog.Warn("failed to cache company", "id", id, "error", err.Error())
+	}
+	// invalidation which has happened during Set could have dropped the company before it was cached
+	if generation.Load() != started {
+		r.invalidate(ctx, id)
+	}
+
+	return company, nil
+}
+
+func (r *Companies) UpsertByName(ctx context.Context, company repositories.Company) (repositories.Company, *repositories.Company, error) {
+	upserted, previous, err := r.CompaniesRepository.UpsertByName(ctx, company)
+	if err == nil && previous != nil {
+		r.invalidate(ctx, upserted.ID)
+	}
+
+	return upserted, previous, err
+}
+
+func (r *Companies) Update(ctx context.Context, company repositories.CompanyUpdate) (repositories.Company, error) {
+	updated, err := r.CompaniesRepository.Update(ctx, company)
+	r.invalidate(ctx, company.ID)
+
+	return updated, err
+}
+
+func (r *Companies) Delete(ctx context.Context, id string, version int64) error {
+	err := r.CompaniesRepository.Delete(ctx, id, version)
+	r.invalidate(ctx, id)
+
+	return err
+}
+
+func (r *Companies) Restore(ctx context.Context, id string) (repositories.Company, error) {
+	restored, err := r.CompaniesRepository.Restore(ctx, id)
+	r.invalidate(ctx, id)
+
+	return restored, err
+}
+
+// Stats returns number of Get calls served from the cache and the ones passed to the wrapped repository
+func (r *Companies) Stats() Stats {
+	return Stats{Hits: r.hits.Load(), Misses: r.misses.Load()}
+}
+
+// invalidate drops cached company even if the change has failed, the company could have been changed
+// by somebody else and the cached one is likely stale
+func (r *Companies) invalidate(ctx context.Context, id string) {
+	// the counter is changed before the company is dropped, so Get which has read the company before the change
+	// either skips caching it or drops it after caching
+	r.generation(id).Add(1)
+
+	// the change is done, so the company is dropped even if the request has been canceled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+	defer cancel()
+
+	if err := r.store.Delete(ctx, id); err != nil {
+		slog.Warn("failed to drop company from cache", "id", id, "error", err.Error())
+	}
+}
+
+func (r *Companies) generation(id string) *atomic.Uint64 {
+	return &r.generations[maphash.String(r.seed, id)%generationShards]
+}
@@ -0,0 +1,182 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/cache"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/memory"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompaniesContract(t *testing.T) {
+	repotest.RunCompaniesRepository(t, func(t *testing.T) services.CompaniesRepository {
+		return cache.NewCompaniesRepository(memory.NewCompaniesRepository(), cache.NewLRU(100, time.Minute))
+	})
+}
+
+func TestGet(t *testing.T) {
+	t.Run("company is cached", func(t *testing.T) {
+		storage := memory.NewCompaniesRepository()
+		repo := cache.NewCompaniesRepository(storage, cache.NewLRU(100, time.Minute))
+
+		created, err := repo.Create(context.Background(), repotest.NewCompany("cached"))
+		require.NoError(t, err)
+
+		for range 3 {
+			company, err := repo.Get(context.Background(), created.ID)
+			require.NoError(t, err)
+			require.Equal(t, created, company)
+		}
+		require.Equal(t, cache.Stats{Hits: 2, Misses: 1}, repo.Stats())
+
+		// the company changed bypassing the cache is served from the cache
+		_, err = storage.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit"})
+		require.NoError(t, err)
+
+		company, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, created, company)
+	})
+
+	t.Run("missing company is not cached", func(t *testing.T) {
+		repo := cache.NewCompaniesRepository(memory.NewCompaniesRepository(), cache.NewLRU(100, time.Minute))
+
+		for range 2 {
+			_, err := repo.Get(context.Background(), "missing")
+			require.ErrorAs(t, err, &repositories.ErrNotFound{})
+		}
+		require.Equal(t, cache.Stats{Misses: 2}, repo.Stats())
+	})
+
+	t.Run("cache failure", func(t *testing.T) {
+		storage := memory.NewCompaniesRepository()
+		repo := cache.NewCompaniesRepository(storage, brokenStore{})
+
+		created, err := repo.Create(context.Background(), repotest.NewCompany("broken"))
+		require.NoError(t, err)
+
+		company, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, created, company)
+		require.Equal(t, cache.Stats{Misses: 1}, repo.Stats())
+
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit"})
+		require.NoError(t, err)
+	})
+}
+
+func TestInvalidate(t *testing.T) {
+	repo := cache.NewCompaniesRepository(memory.NewCompaniesRepository(), cache.NewLRU(100, time.Minute))
+
+	// get caches the company, so the next get is a miss only if the company has been dropped from the cache
+	requireDropped := func(t *testing.T, id string) repositories.Company {
+		misses := repo.Stats().Misses
+		company, err := repo.Get(context.Background(), id)
+		require.NoError(t, err)
+		require.Equal(t, misses+1, repo.Stats().Misses)
+		return company
+	}
+
+	created, err := repo.Create(context.Background(), repotest.NewCompany("invalidate"))
+	require.NoError(t, err)
+	requireDropped(t, created.ID)
+
+	t.Run("update", func(t *testing.T) {
+		updated, err := repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit"})
+		require.NoError(t, err)
+		require.Equal(t, updated, requireDropped(t, created.ID))
+	})
+
+	t.Run("failed update", func(t *testing.T) {
+		_, err := repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "Cooperative", Version: 1})
+		require.ErrorAs(t, err, &repositories.ErrVersionMismatch{})
+		requireDropped(t, created.ID)
+	})
+
+	t.Run("upsert by name", func(t *testing.T) {
+		company := repotest.NewCompany("invalidate")
+		company.Name = created.Name
+		company.AmountOfEmployees = 99
+		updated, previous, err := repo.UpsertByName(context.Background(), company)
+		require.NoError(t, err)
+		require.NotNil(t, previous)
+		require.Equal(t, updated, requireDropped(t, created.ID))
+	})
+
+	t.Run("delete and restore", func(t *testing.T) {
+		require.NoError(t, repo.Delete(context.Background(), created.ID, 0))
+
+		_, err := repo.Get(context.Background(), created.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		restored, err := repo.Restore(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, restored, requireDropped(t, created.ID))
+	})
+}
+
+func TestGetConcurrentUpdate(t *testing.T) {
+	storage := &pausedRepository{CompaniesRepository: memory.NewCompaniesRepository(), read: make(chan struct{}), resume: make(chan struct{})}
+	repo := cache.NewCompaniesRepository(storage, cache.NewLRU(100, time.Minute))
+
+	created, err := repo.Create(context.Background(), repotest.NewCompany("concurrent"))
+	require.NoError(t, err)
+
+	// the company is read before the update and is returned after the update has dropped it from the cache
+	storage.pause.Store(true)
+	done := make(chan repositories.Company)
+	go func() {
+		company, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		done <- company
+	}()
+
+	<-storage.read
+	storage.pause.Store(false)
+	updated, err := repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit"})
+	require.NoError(t, err)
+	close(storage.resume)
+	require.Equal(t, created, <-done)
+
+	company, err := repo.Get(context.Background(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, updated, company)
+}
+
+// pausedRepository stops Get after the company is read until resume is closed, when pause is set
+type pausedRepository struct {
+	services.CompaniesRepository
+	pause  atomic.Bool
+	read   chan struct{}
+	resume chan struct{}
+}
+
+func (r *pausedRepository) Get(ctx context.Context, id string) (repositories.Company, error) {
+	company, err := r.CompaniesRepository.Get(ctx, id)
+	if r.pause.Load() {
+		r.read <- struct{}{}
+		<-r.resume
+	}
+	return company, err
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Get(context.Context, string) (repositories.Company, bool, error) {
+	return repositories.Company{}, false, errors.New("broken")
+}
+
+func (brokenStore) Set(context.Context, repositories.Company) error {
+	return errors.New("broken")
+}
+
+func (brokenStore) Delete(context.Context, string) error {
+	return errors.New("broken")
+}
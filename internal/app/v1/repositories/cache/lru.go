@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+)
+
+// LRU keeps up to size companies in memory for ttl, the least recently used company is evicted
+// when the cache is full. It is safe for concurrent use
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	company   repositories.Company
+	expiresAt time.Time
+}
+
+type LRUOption func(*LRU)
+
+// WithClock sets the source of the current time, it is used in tests
+func WithClock(now func() time.Time) LRUOption {
+	return func(c *LRU) {
+		c.now = now
+	}
+}
+
+func NewLRU(size int, ttl time.Duration, opts ...LRUOption) *LRU {
+	c := &LRU{
+		size:    max(size, 1),
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *LRU) Get(_ context.Context, id string) (repositories.Company, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[id]
+	if !ok {
+		return repositories.Company{}, false, nil
+	}
+
+	entry := element.Value.(lruEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		return repositories.Company{}, false, nil
+	}
+
+	c.order.MoveToFront(element)
+	return entry.company, true, nil
+}
+
+func (c *LRU) Set(_ context.Context, company repositories.Company) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := lruEntry{company: company, expiresAt: c.now().Add(c.ttl)}
+	if element, ok := c.entries[company.ID]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[company.ID] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+func (c *LRU) Delete(_ context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.remove(element)
+	}
+
+	return nil
+}
+
+// Len returns number of cached companies including expired ones which have not been evicted yet
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRU) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(lruEntry).company.ID)
+}
@@ -0,0 +1,75 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	t.Run("least recently used company is evicted", func(t *testing.T) {
+		c := cache.NewLRU(2, time.Minute)
+
+		for _, id := range []string{"1", "2"} {
+			require.NoError(t, c.Set(context.Background(), repositories.Company{ID: id}))
+		}
+
+		// 1 is used, so 2 is evicted
+		_, ok, err := c.Get(context.Background(), "1")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		require.NoError(t, c.Set(context.Background(), repositories.Company{ID: "3"}))
+		require.Equal(t, 2, c.Len())
+
+		_, ok, _ = c.Get(context.Background(), "2")
+		require.False(t, ok)
+
+		for _, id := range []string{"1", "3"} {
+			company, ok, _ := c.Get(context.Background(), id)
+			require.True(t, ok)
+			require.Equal(t, id, company.ID)
+		}
+	})
+
+	t.Run("company expires", func(t *testing.T) {
+		now := time.Now()
+		c := cache.NewLRU(2, time.Minute, cache.WithClock(func() time.Time { return now }))
+
+		require.NoError(t, c.Set(context.Background(), repositories.Company{ID: "1", Name: "first"}))
+
+		now = now.Add(30 * time.Second)
+		_, ok, _ := c.Get(context.Background(), "1")
+		require.True(t, ok)
+
+		// set starts ttl again
+		require.NoError(t, c.Set(context.Background(), repositories.Company{ID: "1", Name: "second"}))
+		require.Equal(t, 1, c.Len())
+
+		now = now.Add(59 * time.Second)
+		company, ok, _ := c.Get(context.Background(), "1")
+		require.True(t, ok)
+		require.Equal(t, "second", company.Name)
+
+		now = now.Add(time.Second)
+		_, ok, _ = c.Get(context.Background(), "1")
+		require.False(t, ok)
+		require.Zero(t, c.Len())
+	})
+
+	t.Run("delete company", func(t *testing.T) {
+		c := cache.NewLRU(2, time.Minute)
+
+		require.NoError(t, c.Set(context.Background(), repositories.Company{ID: "1"}))
+		require.NoError(t, c.Delete(context.Background(), "1"))
+		require.NoError(t, c.Delete(context.Background(), "2"))
+
+		_, ok, _ := c.Get(context.Background(), "1")
+		require.False(t, ok)
+		require.Zero(t, c.Len())
+	})
+}
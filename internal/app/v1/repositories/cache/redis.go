@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "company-handler:company:"
+
+// Redis keeps companies in Redis for ttl as JSON documents, the cache can be shared by several instances
+// of the service. Eviction of the companies is up to Redis configuration
+type Redis struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+func NewRedis(client redis.UniversalClient, ttl time.Duration) *Redis {
+	return &Redis{client: client, ttl: ttl}
+}
+
+func (c *Redis) Get(ctx context.Context, id string) (repositories.Company, bool, error) {
+	data, err := c.client.Get(ctx, redisKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return repositories.Company{}, false, nil
+	}
+	if err != nil {
+		return repositories.Company{}, false, err
+	}
+
+	var company repositories.Company
+	if err := json.Unmarshal(data, &company); err != nil {
+		return repositories.Company{}, false, err
+	}
+
+	return company, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, company repositories.Company) error {
+	data, err := json.Marshal(company)
+	if err != nil {
+		return err
+	}
+
+	return c.client.Set(ctx, redisKeyPrefix+company.ID, data, c.ttl).Err()
+}
+
+func (c *Redis) Delete(ctx context.Context, id string) error {
+	return c.client.Del(ctx, redisKeyPrefix+id).Err()
+}
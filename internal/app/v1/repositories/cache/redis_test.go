@@ -0,0 +1,61 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/cache"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/memory"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	c := cache.NewRedis(client, time.Minute)
+
+	created, err := memory.NewCompaniesRepository().Create(context.Background(), repotest.NewCompany("redis"))
+	require.NoError(t, err)
+
+	t.Run("set and get company", func(t *testing.T) {
+		require.NoError(t, c.Set(context.Background(), created))
+
+		company, ok, err := c.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, created, company)
+	})
+
+	t.Run("company expires", func(t *testing.T) {
+		require.NoError(t, c.Set(context.Background(), created))
+
+		server.FastForward(time.Minute)
+		_, ok, err := c.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("delete company", func(t *testing.T) {
+		require.NoError(t, c.Set(context.Background(), created))
+		require.NoError(t, c.Delete(context.Background(), created.ID))
+
+		_, ok, err := c.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("redis failure", func(t *testing.T) {
+		server.SetError("broken")
+		defer server.SetError("")
+
+		_, ok, err := c.Get(context.Background(), created.ID)
+		require.Error(t, err)
+		require.False(t, ok)
+	})
+}
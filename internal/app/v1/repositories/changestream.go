@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OperationInsert  = "insert"
+	OperationUpdate  = "update"
+	OperationReplace = "replace"
+	OperationDelete  = "delete"
+)
+
+// CompaniesChangeStream reads changes of the companies collection, including the ones made bypassing the repository
+type CompaniesChangeStream struct {
+	collection *mongo.Collection
+}
+
+func NewCompaniesChangeStream(collection *mongo.Collection) *CompaniesChangeStream {
+	return &CompaniesChangeStream{collection: collection}
+}
+
+// changeEvent is the document of the change stream
+type changeEvent struct {
+	ID struct {
+		Data string `bson:"_data"`
+	} `bson:"_id"`
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument             *Company `bson:"fullDocument"`
+	FullDocumentBeforeChange *Company `bson:"fullDocumentBeforeChange"`
+	UpdateDescription        *struct {
+		UpdatedFields bson.Raw `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+	WallTime time.Time `bson:"wallTime"`
+}
+
+// Watch calls handle for every change made after the change with resumeToken, or after the call when resumeToken
+// is nil, until ctx is done or handle returns error. The companies before and after the change are taken from
+// pre- and post-images of the collection. Without post-image the company after update is looked up when
+// the change is read, so it can be newer than the change, and without pre-image the company before the change is not set.
+// Change which can not be decoded is passed with Err, ErrHistoryLost is returned when resumeToken is too old
+func (r CompaniesChangeStream) Watch(ctx context.Context, resumeToken []byte, handle func(CompanyChange) error) error {
+	opts := options.ChangeStream().
+		SetFullDocument(options.WhenAvailable).
+		SetFullDocumentBeforeChange(options.WhenAvailable)
+	if resumeToken != nil {
+		opts.SetResumeAfter(bson.Raw(resumeToken))
+	}
+
+	stream, err := r.collection.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		return handleError(err)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event changeEvent
+		if err := stream.Decode(&event); err != nil {
+			// the change is passed without the company, so the reader can skip it instead of failing on it forever
+			operation, _ := stream.Current.Lookup("operationType").StringValueOK()
+			data, _ := stream.Current.Lookup("_id", "_data").StringValueOK()
+			change := CompanyChange{ID: data, Token: []byte(stream.Current.Lookup("_id").Document()), Operation: operation, Err: err}
+			if err := handle(change); err != nil {
+				return err
+			}
+			continue
+		}
+
+		change := CompanyChange{
+			ID:        event.ID.Data,
+			Token:     []byte(stream.Current.Lookup("_id").Document()),
+			Operation: event.OperationType,
+			CompanyID: event.DocumentKey.ID,
+			Company:   event.FullDocument,
+			Before:    event.FullDocumentBeforeChange,
+			Time:      event.WallTime,
+		}
+		if change.Company == nil && change.Operation == OperationUpdate {
+			if change.Company, err = r.lookup(ctx, change.CompanyID); err != nil {
+				return err
+			}
+		}
+		if event.UpdateDescription != nil {
+			change.RemovedFields = event.UpdateDescription.RemovedFields
+			elements, err := event.UpdateDescription.UpdatedFields.Elements()
+			if err != nil {
+				return err
+			}
+			for _, element := range elements {
+				change.UpdatedFields = append(change.UpdatedFields, element.Key())
+			}
+		}
+
+		if err := handle(change); err != nil {
+			return err
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return handleError(err)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// the stream is invalidated when the collection is dropped or renamed
+	return errors.New("change stream is closed")
+}
+
+// lookup returns the current company, deleted ones included, nil is returned when the company is removed
+func (r CompaniesChangeStream) lookup(ctx context.Context, id string) (*Company, error) {
+	var company Company
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&company)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return &company, nil
+}
+
+// ResumeTokens keeps position of the change stream readers, so they continue after restart where they have stopped
+type ResumeTokens struct {
+	collection *mongo.Collection
+}
+
+func NewResumeTokensRepository(collection *mongo.Collection) *ResumeTokens {
+	return &ResumeTokens{collection: collection}
+}
+
+// Load returns resume token saved by the reader, ErrNotFound is returned if nothing is saved yet
+func (r ResumeTokens) Load(ctx context.Context, name string) ([]byte, error) {
+	var token ResumeToken
+	if err := r.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&token); err != nil {
+		return nil, handleError(err)
+	}
+
+	return []byte(token.Token), nil
+}
+
+func (r ResumeTokens) Save(ctx context.Context, name string, token []byte) error {
+	update := bson.M{"$set": bson.M{"token": bson.Raw(token), "updated_at": now()}}
+
+	_, err := r.collection.UpdateByID(ctx, name, update, options.Update().SetUpsert(true))
+	return handleError(err)
+}
@@ -0,0 +1,149 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCompaniesChangeStream(t *testing.T) {
+	database := testCompaniesCollection.Database()
+	// pre- and post-images let the stream return companies before and after updates and deletes
+	require.NoError(t, database.CreateCollection(context.Background(), "companies_changes"))
+	require.NoError(t, database.RunCommand(context.Background(), primitive.D{
+		{Key: "collMod", Value: "companies_changes"},
+		{Key: "changeStreamPreAndPostImages", Value: primitive.M{"enabled": true}},
+	}).Err())
+
+	collection := database.Collection("companies_changes")
+	repo := repositories.NewCompaniesRepository(collection)
+	stream := repositories.NewCompaniesChangeStream(collection)
+
+	// the changes are watched from the position before they are made
+	opened, err := collection.Watch(context.Background(), mongo.Pipeline{})
+	require.NoError(t, err)
+	start := []byte(opened.ResumeToken())
+	require.NoError(t, opened.Close(context.Background()))
+
+	errStop := errors.New("stop")
+	watch := func(t *testing.T, resumeToken []byte, n int) []repositories.CompanyChange {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var changes []repositories.CompanyChange
+		err := stream.Watch(ctx, resumeToken, func(change repositories.CompanyChange) error {
+			changes = append(changes, change)
+			if len(changes) == n {
+				return errStop
+			}
+			return nil
+		})
+		require.ErrorIs(t, err, errStop)
+		return changes
+	}
+
+	created, err := repo.Create(context.Background(), repotest.NewCompany("changes"))
+	require.NoError(t, err)
+	_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit"})
+	require.NoError(t, err)
+	require.NoError(t, repo.Delete(context.Background(), created.ID, 0))
+	_, err = collection.DeleteOne(context.Background(), bson.M{"_id": created.ID})
+	require.NoError(t, err)
+
+	changes := watch(t, start, 4)
+
+	require.Equal(t, repositories.OperationInsert, changes[0].Operation)
+	require.Equal(t, created.ID, changes[0].CompanyID)
+	require.Equal(t, created, *changes[0].Company)
+	require.Nil(t, changes[0].Before)
+	require.False(t, changes[0].Time.IsZero())
+
+	require.Equal(t, repositories.OperationUpdate, changes[1].Operation)
+	require.Equal(t, created, *changes[1].Before)
+	require.Contains(t, changes[1].UpdatedFields, "type")
+	// post-image is the company right after the update, not the deleted one
+	require.Equal(t, "NonProfit", changes[1].Company.Type)
+	require.Equal(t, int64(2), changes[1].Company.Version)
+	require.Nil(t, changes[1].Company.DeletedAt)
+
+	require.Equal(t, repositories.OperationUpdate, changes[2].Operation)
+	require.Contains(t, changes[2].UpdatedFields, "deleted_at")
+	require.NotNil(t, changes[2].Company.DeletedAt)
+	require.Nil(t, changes[2].Before.DeletedAt)
+
+	require.Equal(t, repositories.OperationDelete, changes[3].Operation)
+	require.Equal(t, created.ID, changes[3].CompanyID)
+	require.NotNil(t, changes[3].Before.DeletedAt)
+
+	// changes read again after the token of the first one are the same
+	again := watch(t, changes[0].Token, 3)
+	for i, change := range again {
+		require.Equal(t, changes[i+1].ID, change.ID)
+		require.Equal(t, changes[i+1].Token, change.Token)
+	}
+}
+
+func TestCompaniesChangeStreamUnreadableChange(t *testing.T) {
+	collection := testCompaniesCollection.Database().Collection("companies_unreadable_changes")
+	repo := repositories.NewCompaniesRepository(collection)
+	stream := repositories.NewCompaniesChangeStream(collection)
+
+	opened, err := collection.Watch(context.Background(), mongo.Pipeline{})
+	require.NoError(t, err)
+	start := []byte(opened.ResumeToken())
+	require.NoError(t, opened.Close(context.Background()))
+
+	// scripts insert documents with ObjectId ids which are not decoded into companies
+	_, err = collection.InsertOne(context.Background(), bson.M{"name": "script"})
+	require.NoError(t, err)
+	created, err := repo.Create(context.Background(), repotest.NewCompany("readable"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	errStop := errors.New("stop")
+	var changes []repositories.CompanyChange
+	err = stream.Watch(ctx, start, func(change repositories.CompanyChange) error {
+		changes = append(changes, change)
+		if len(changes) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errStop)
+
+	require.Error(t, changes[0].Err)
+	require.Equal(t, repositories.OperationInsert, changes[0].Operation)
+	require.NotEmpty(t, changes[0].ID)
+	require.NotEmpty(t, changes[0].Token)
+	require.Nil(t, changes[0].Company)
+
+	require.NoError(t, changes[1].Err)
+	require.Equal(t, created, *changes[1].Company)
+}
+
+func TestResumeTokens(t *testing.T) {
+	tokens := repositories.NewResumeTokensRepository(testCompaniesCollection.Database().Collection("change_stream_tokens"))
+
+	_, err := tokens.Load(context.Background(), "tokens")
+	require.ErrorIs(t, err, repositories.ErrNotFound{})
+
+	for _, data := range []string{"first", "second"} {
+		token, err := bson.Marshal(bson.M{"_data": data})
+		require.NoError(t, err)
+		require.NoError(t, tokens.Save(context.Background(), "tokens", token))
+
+		loaded, err := tokens.Load(context.Background(), "tokens")
+		require.NoError(t, err)
+		require.Equal(t, token, loaded)
+	}
+}
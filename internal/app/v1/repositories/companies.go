@@ -2,36 +2,253 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"time"
 
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Companies struct {
 	collection *mongo.Collection
+	outbox     *mongo.Collection
 }
 
-func NewCompaniesRepository(collection *mongo.Collection) *Companies {
-	return &Companies{collection: collection}
+type CompaniesOption func(*Companies)
+
+// WithOutbox makes every change of a company write its event to the outbox collection in the same transaction,
+// so the event is stored if and only if the change is. Transactions require MongoDB running as a replica set
+func WithOutbox(outbox *mongo.Collection) CompaniesOption {
+	return func(r *Companies) {
+		r.outbox = outbox
+	}
+}
+
+func NewCompaniesRepository(collection *mongo.Collection, opts ...CompaniesOption) *Companies {
+	r := &Companies{collection: collection}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
 }
 
 func (r Companies) Create(ctx context.Context, company Company) (Company, error) {
-	company.ID = bson.NewObjectId().Hex()
-	_, err := r.collection.InsertOne(ctx, company)
+	company.ID = primitive.NewObjectID().Hex()
+	company.Version = 1
+	company.CreatedAt = now()
+	company.CreatedBy = reqctx.Actor(ctx)
+	company.UpdatedAt = company.CreatedAt
+	company.UpdatedBy = company.CreatedBy
+	err := r.transaction(ctx, func(ctx context.Context) (*OutboxEvent, error) {
+		if _, err := r.collection.InsertOne(ctx, company); err != nil {
+			return nil, handleError(err)
+		}
+
+		event := newOutboxEvent(EventCompanyCreated, company.ID, &company)
+		return &event, nil
+	})
 	if err != nil {
-		return Company{}, handleError(err)
+		return Company{}, err
 	}
 	return company, nil
 }
 
+// CreateMany inserts companies in one unordered batch, so failure of one company does not stop the others.
+// Result is returned for every company in the same order, nil error means the company has been created.
+// With outbox every company is created in its own transaction, failed write aborts the whole transaction
+func (r Companies) CreateMany(ctx context.Context, companies []Company) ([]Company, []error) {
+	created := make([]Company, len(companies))
+	errs := make([]error, len(companies))
+	if len(companies) == 0 {
+		return created, errs
+	}
+
+	if r.outbox != nil {
+		for i, company := range companies {
+			created[i], errs[i] = r.Create(ctx, company)
+		}
+		return created, errs
+	}
+
+	createdAt, actor := now(), reqctx.Actor(ctx)
+	docs := make([]any, 0, len(companies))
+	for i, company := range companies {
+		company.ID = primitive.NewObjectID().Hex()
+		company.Version = 1
+		company.CreatedAt = createdAt
+		company.CreatedBy = actor
+		company.UpdatedAt = createdAt
+		company.UpdatedBy = actor
+
+		created[i] = company
+		docs = append(docs, company)
+	}
+
+	_, err := r.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return created, errs
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+		// the whole batch has failed
+		for i := range errs {
+			created[i], errs[i] = Company{}, handleError(err)
+		}
+		return created, errs
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		created[writeErr.Index], errs[writeErr.Index] = Company{}, handleError(writeErr.WriteError)
+	}
+
+	return created, errs
+}
+
+// UpsertByName creates the company or replaces fields of not deleted company with the same name.
+// Previous state of the company is returned if it has been updated, nil means the company has been created
+func (m Companies) UpsertByName(ctx context.Context, company Company) (Company, *Company, error) {
+	at, actor := now(), reqctx.Actor(ctx)
+	id := primitive.NewObjectID().Hex()
+	update := bson.M{
+		"$set": bson.M{
+			"name":                company.Name,
+			"description":         company.Description,
+			"amount_of_employees": company.AmountOfEmployees,
+			"registered":          company.Registered,
+			"type":                company.Type,
+			"updated_at":          at,
+			"updated_by":          actor,
+		},
+		"$setOnInsert": bson.M{"_id": id, "created_at": at, "created_by": actor},
+		"$inc":         bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+
+	var upserted Company
+	var previous *Company
+	err := m.transaction(ctx, func(ctx context.Context) (*OutboxEvent, error) {
+		upserted, previous = company, nil
+
+		var found Company
+		err := m.collection.FindOneAndUpdate(ctx, bson.M{"name": company.Name, "deleted_at": nil}, update, opts).Decode(&found)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			upserted.ID, upserted.Version = id, 1
+			upserted.CreatedAt, upserted.CreatedBy = at, actor
+			upserted.UpdatedAt, upserted.UpdatedBy = at, actor
+			event := newOutboxEvent(EventCompanyCreated, upserted.ID, &upserted)
+			return &event, nil
+		case err != nil:
+			return nil, handleError(err)
+		}
+
+		upserted.ID, upserted.Version = found.ID, found.Version+1
+		upserted.CreatedAt, upserted.CreatedBy = found.CreatedAt, found.CreatedBy
+		upserted.UpdatedAt, upserted.UpdatedBy = at, actor
+		previous = &found
+		event := newOutboxEvent(EventCompanyUpdated, upserted.ID, &upserted)
+		event.Changes = DiffCompanies(previous, upserted)
+		return &event, nil
+	})
+	if err != nil {
+		return Company{}, nil, err
+	}
+
+	return upserted, previous, nil
+}
+
 func (m Companies) Get(ctx context.Context, id string) (Company, error) {
 	var company Company
 	err := m.collection.FindOne(ctx, getIdFilter(id)).Decode(&company)
 	return company, handleError(err)
 }
 
-func (m Companies) Update(ctx context.Context, company CompanyUpdate) error {
-	set := bson.M{}
+func (m Companies) List(ctx context.Context, query ListQuery) (CompaniesPage, error) {
+	filter := getListFilter(query.Filter)
+	if query.Cursor != "" {
+		c, err := DecodeCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return CompaniesPage{}, err
+		}
+
+		after, err := getAfterCursorFilter(c, query.Sort)
+		if err != nil {
+			return CompaniesPage{}, err
+		}
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+
+	// fetch one extra document to find out if there is a next page
+	opts := options.Find().SetSort(getSort(query.Sort)).SetLimit(int64(query.Limit) + 1)
+	cur, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return CompaniesPage{}, handleError(err)
+	}
+
+	companies := make([]Company, 0, query.Limit+1)
+	if err := cur.All(ctx, &companies); err != nil {
+		return CompaniesPage{}, handleError(err)
+	}
+
+	page := CompaniesPage{Companies: companies}
+	if len(companies) > query.Limit {
+		page.Companies = companies[:query.Limit]
+		page.NextCursor = EncodeCursor(NewCursor(page.Companies[query.Limit-1], query.Sort))
+	}
+
+	return page, nil
+}
+
+// Export iterates over all companies matching the filter in id order without loading them into memory,
+// iteration stops on the first error returned by fn
+func (m Companies) Export(ctx context.Context, filter CompanyFilter, fn func(Company) error) error {
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	cur, err := m.collection.Find(ctx, getListFilter(filter), opts)
+	if err != nil {
+		return handleError(err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var company Company
+		if err := cur.Decode(&company); err != nil {
+			return handleError(err)
+		}
+
+		if err := fn(company); err != nil {
+			return err
+		}
+	}
+
+	return handleError(cur.Err())
+}
+
+func (m Companies) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	score := bson.M{"score": bson.M{"$meta": "textScore"}}
+	opts := options.Find().SetProjection(score).SetSort(score).SetLimit(int64(query.Limit))
+	filter := bson.M{"$text": bson.M{"$search": query.Text}, "deleted_at": nil}
+	cur, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	results := make([]SearchResult, 0, query.Limit)
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, handleError(err)
+	}
+
+	return results, nil
+}
+
+// Update applies non empty fields of the update and returns updated company
+func (m Companies) Update(ctx context.Context, company CompanyUpdate) (Company, error) {
+	set := bson.M{"updated_at": now(), "updated_by": reqctx.Actor(ctx)}
 	if company.Name != "" {
 		set["name"] = company.Name
 	}
@@ -48,15 +265,283 @@ func (m Companies) Update(ctx context.Context, company CompanyUpdate) error {
 		set["type"] = company.Type
 	}
 
-	_, err := m.collection.UpdateOne(ctx, getIdFilter(company.ID), bson.M{"$set": set})
-	return handleError(err)
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated Company
+	err := m.transaction(ctx, func(ctx context.Context) (*OutboxEvent, error) {
+		// previous state is read in the same transaction only to find out changed fields for the event
+		var before *Company
+		if m.outbox != nil {
+			var found Company
+			err := m.collection.FindOne(ctx, getVersionFilter(company.ID, company.Version)).Decode(&found)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, handleError(err)
+			}
+			before = &found
+		}
+
+		err := m.collection.FindOneAndUpdate(ctx, getVersionFilter(company.ID, company.Version), update, opts).Decode(&updated)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, m.notMatchedError(ctx, company.ID, company.Version)
+		}
+		if err != nil {
+			return nil, handleError(err)
+		}
+
+		event := newOutboxEvent(EventCompanyUpdated, updated.ID, &updated)
+		if before != nil {
+			event.Changes = DiffCompanies(before, updated)
+		}
+		return &event, nil
+	})
+	if err != nil {
+		return Company{}, err
+	}
+
+	return updated, nil
 }
 
-func (m Companies) Delete(ctx context.Context, id string) error {
-	_, err := m.collection.DeleteOne(ctx, getIdFilter(id))
+// Delete marks the company as deleted, it is hidden from reads until it is restored or purged
+func (m Companies) Delete(ctx context.Context, id string, version int64) error {
+	update := bson.M{
+		"$set": bson.M{"deleted_at": now(), "deleted_by": reqctx.Actor(ctx)},
+		"$inc": bson.M{"version": 1},
+	}
+
+	return m.transaction(ctx, func(ctx context.Context) (*OutboxEvent, error) {
+		res, err := m.collection.UpdateOne(ctx, getVersionFilter(id, version), update)
+		if err != nil {
+			return nil, handleError(err)
+		}
+
+		if res.MatchedCount == 0 {
+			return nil, m.notMatchedError(ctx, id, version)
+		}
+
+		event := newOutboxEvent(EventCompanyDeleted, id, nil)
+		return &event, nil
+	})
+}
+
+// Restore brings back deleted company, ErrDuplicatedKey is returned if the name has been taken since deletion
+func (m Companies) Restore(ctx context.Context, id string) (Company, error) {
+	update := bson.M{
+		"$set":   bson.M{"updated_at": now(), "updated_by": reqctx.Actor(ctx)},
+		"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+		"$inc":   bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var company Company
+	err := m.transaction(ctx, func(ctx context.Context) (*OutboxEvent, error) {
+		err := m.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "deleted_at": bson.M{"$ne": nil}}, update, opts).Decode(&company)
+		if err != nil {
+			return nil, handleError(err)
+		}
+
+		// restored company is available again, so it is published as created
+		event := newOutboxEvent(EventCompanyCreated, company.ID, &company)
+		return &event, nil
+	})
+	if err != nil {
+		return Company{}, err
+	}
+
+	return company, nil
+}
+
+// Purge permanently removes companies deleted before the given time
+func (m Companies) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	res, err := m.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return 0, handleError(err)
+	}
+
+	return res.DeletedCount, nil
+}
+
+// transaction runs fn and writes the event it returns to the outbox in one transaction, the transaction is
+// retried by the driver on transient errors, so fn should not have side effects out of the database.
+// Without outbox fn is just called and the event is dropped
+func (m Companies) transaction(ctx context.Context, fn func(ctx context.Context) (*OutboxEvent, error)) error {
+	if m.outbox == nil {
+		_, err := fn(ctx)
+		return err
+	}
+
+	session, err := m.collection.Database().Client().StartSession()
+	if err != nil {
+		return handleError(err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		event, err := fn(ctx)
+		if err != nil || event == nil {
+			return nil, err
+		}
+
+		_, err = m.outbox.InsertOne(ctx, event)
+		return nil, handleError(err)
+	})
 	return err
 }
 
+// notMatchedError is called when write matched nothing, for conditional write it finds out
+// if the company has another version or does not exist at all
+func (m Companies) notMatchedError(ctx context.Context, id string, version int64) error {
+	if version == 0 {
+		return ErrNotFound{}
+	}
+
+	count, err := m.collection.CountDocuments(ctx, getIdFilter(id))
+	if err != nil {
+		return handleError(err)
+	}
+
+	if count == 0 {
+		return ErrNotFound{}
+	}
+
+	return ErrVersionMismatch{}
+}
+
+// FillMissingMetadata sets zero values of the metadata fields missing in companies created before the fields were added.
+// List cursor does not match missing fields, so such companies would be skipped when the list is sorted by them
+func FillMissingMetadata(ctx context.Context, collection *mongo.Collection) error {
+	for field, value := range map[string]any{"created_at": time.Time{}, "created_by": "", "updated_at": time.Time{}, "updated_by": ""} {
+		_, err := collection.UpdateMany(ctx, bson.M{field: bson.M{"$exists": false}}, bson.M{"$set": bson.M{field: value}})
+		if err != nil {
+			return handleError(err)
+		}
+	}
+
+	return nil
+}
+
+// getIdFilter matches the company if it is not deleted
 func getIdFilter(id string) bson.M {
-	return bson.M{"_id": id}
+	return bson.M{"_id": id, "deleted_at": nil}
+}
+
+// getVersionFilter matches the company only if it has expected version, zero version matches any
+func getVersionFilter(id string, version int64) bson.M {
+	filter := getIdFilter(id)
+	switch version {
+	case 0:
+	case VersionUnset:
+		// companies created before versioning have no version field
+		filter["version"] = nil
+	default:
+		filter["version"] = version
+	}
+	return filter
+}
+
+func getListFilter(filter CompanyFilter) bson.M {
+	res := bson.M{"deleted_at": nil}
+	if filter.Type != "" {
+		res["type"] = filter.Type
+	}
+	if filter.Registered != nil {
+		res["registered"] = *filter.Registered
+	}
+
+	employees := bson.M{}
+	if filter.MinEmployees != nil {
+		employees["$gte"] = *filter.MinEmployees
+	}
+	if filter.MaxEmployees != nil {
+		employees["$lte"] = *filter.MaxEmployees
+	}
+	if len(employees) > 0 {
+		res["amount_of_employees"] = employees
+	}
+
+	if created := timeRange(filter.CreatedAfter, filter.CreatedBefore); len(created) > 0 {
+		res["created_at"] = created
+	}
+	if filter.CreatedBy != "" {
+		res["created_by"] = filter.CreatedBy
+	}
+	if updated := timeRange(filter.UpdatedAfter, filter.UpdatedBefore); len(updated) > 0 {
+		res["updated_at"] = updated
+	}
+	if filter.UpdatedBy != "" {
+		res["updated_by"] = filter.UpdatedBy
+	}
+
+	return res
+}
+
+// timeRange returns condition matching time not earlier than after and earlier than before
+func timeRange(after, before *time.Time) bson.M {
+	res := bson.M{}
+	if after != nil {
+		res["$gte"] = *after
+	}
+	if before != nil {
+		res["$lt"] = *before
+	}
+	return res
+}
+
+// getSort returns requested sorting, id is always the last key to make the order stable
+func getSort(sort []SortField) bson.D {
+	res := make(bson.D, 0, len(sort)+1)
+	for _, s := range sort {
+		res = append(res, bson.E{Key: s.Field, Value: sortDirection(s.Desc)})
+	}
+
+	return append(res, bson.E{Key: "_id", Value: 1})
+}
+
+// getAfterCursorFilter matches companies placed after the cursor in the requested sort order:
+// (s1 > v1) or (s1 = v1 and s2 > v2) or ... or (s1 = v1 and ... and sN = vN and _id > id)
+func getAfterCursorFilter(c Cursor, sort []SortField) (bson.M, error) {
+	conditions := make(bson.A, 0, len(sort)+1)
+	equal := bson.M{}
+	for _, s := range sort {
+		value, err := c.Value(s.Field)
+		if err != nil {
+			return nil, err
+		}
+
+		condition := maps.Clone(equal)
+		condition[s.Field] = bson.M{afterOperator(s.Desc): value}
+		conditions = append(conditions, condition)
+
+		equal[s.Field] = value
+	}
+
+	condition := maps.Clone(equal)
+	condition["_id"] = bson.M{"$gt": c.ID}
+	conditions = append(conditions, condition)
+
+	if len(conditions) == 1 {
+		return condition, nil
+	}
+
+	return bson.M{"$or": conditions}, nil
+}
+
+func sortDirection(desc bool) int {
+	if desc {
+		return -1
+	}
+	return 1
+}
+
+func afterOperator(desc bool) string {
+	if desc {
+		return "$lt"
+	}
+	return "$gt"
+}
+
+// now returns current time with the precision MongoDB stores it with
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
 }
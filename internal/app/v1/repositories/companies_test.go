@@ -2,14 +2,19 @@ package repositories_test
 
 import (
 	"context"
+	"errors"
 	"log"
 	"testing"
 	"time"
 
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/mgo.v2/bson"
@@ -18,6 +23,25 @@ import (
 var testCompaniesCollection *mongo.Collection
 var brokenMongoCollection *mongo.Collection
 
+func TestCompaniesContract(t *testing.T) {
+	collection := testCompaniesCollection.Database().Collection("companies_contract")
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    primitive.D{{Key: "name", Value: 1}, {Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"name": "text", "description": "text"},
+			Options: options.Index().SetWeights(bson.M{"name": 10, "description": 1}),
+		},
+	})
+	require.NoError(t, err)
+
+	repotest.RunCompaniesRepository(t, func(t *testing.T) services.CompaniesRepository {
+		return repositories.NewCompaniesRepository(collection)
+	})
+}
+
 func TestCreate(t *testing.T) {
 	t.Run("create company successfully", func(t *testing.T) {
 		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
@@ -32,6 +56,17 @@ func TestCreate(t *testing.T) {
 		require.Equal(t, createdCompany, cmp)
 	})
 
+	t.Run("create company with metadata", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		createdCompany, err := repo.Create(reqctx.WithActor(context.Background(), "user"), createTestCompany("TestCreateMetadata"))
+		require.NoError(t, err)
+		require.False(t, createdCompany.CreatedAt.IsZero())
+		require.Equal(t, createdCompany.CreatedAt, createdCompany.UpdatedAt)
+		require.Equal(t, "user", createdCompany.CreatedBy)
+		require.Equal(t, "user", createdCompany.UpdatedBy)
+	})
+
 	t.Run("create company failed", func(t *testing.T) {
 		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
 		company := createTestCompany("name")
@@ -41,6 +76,112 @@ func TestCreate(t *testing.T) {
 	})
 }
 
+func TestCreateMany(t *testing.T) {
+	collection := testCompaniesCollection.Database().Collection("companies_create_many")
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    primitive.D{{Key: "name", Value: 1}, {Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	require.NoError(t, err)
+
+	t.Run("create companies successfully, duplicates are skipped", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(collection)
+
+		_, err := repo.Create(context.Background(), createTestCompany("TestCreateManyExisting"))
+		require.NoError(t, err)
+
+		companies := []repositories.Company{
+			createTestCompany("TestCreateMany1"),
+			createTestCompany("TestCreateManyExisting"),
+			createTestCompany("TestCreateMany2"),
+			createTestCompany("TestCreateMany1"),
+		}
+		created, errs := repo.CreateMany(reqctx.WithActor(context.Background(), "user"), companies)
+		require.Len(t, created, 4)
+		require.Len(t, errs, 4)
+
+		require.NoError(t, errs[0])
+		require.ErrorAs(t, errs[1], &repositories.ErrDuplicatedKey{})
+		require.NoError(t, errs[2])
+		require.ErrorAs(t, errs[3], &repositories.ErrDuplicatedKey{})
+		require.Empty(t, created[1])
+		require.Empty(t, created[3])
+
+		for _, i := range []int{0, 2} {
+			require.Equal(t, int64(1), created[i].Version)
+			require.Equal(t, "user", created[i].CreatedBy)
+
+			resCompany, err := repo.Get(context.Background(), created[i].ID)
+			require.NoError(t, err)
+			require.Equal(t, created[i], resCompany)
+		}
+	})
+
+	t.Run("create companies failed", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
+
+		created, errs := repo.CreateMany(context.Background(), []repositories.Company{createTestCompany("a"), createTestCompany("b")})
+		require.Len(t, created, 2)
+		require.Error(t, errs[0])
+		require.Error(t, errs[1])
+		require.Empty(t, created[0])
+	})
+}
+
+func TestUpsertByName(t *testing.T) {
+	t.Run("create and update company by name", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		company := createTestCompany("TestUpsertByName")
+		created, previous, err := repo.UpsertByName(reqctx.WithActor(context.Background(), "creator"), company)
+		require.NoError(t, err)
+		require.Nil(t, previous)
+		require.NotEqual(t, company.ID, created.ID)
+		require.Equal(t, int64(1), created.Version)
+		require.Equal(t, "creator", created.CreatedBy)
+
+		resCompany, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, created, resCompany)
+
+		company.AmountOfEmployees = 5
+		company.Description = ""
+		updated, previous, err := repo.UpsertByName(reqctx.WithActor(context.Background(), "editor"), company)
+		require.NoError(t, err)
+		require.Equal(t, &created, previous)
+		require.Equal(t, created.ID, updated.ID)
+		require.Equal(t, int64(2), updated.Version)
+		require.Equal(t, 5, updated.AmountOfEmployees)
+		require.Equal(t, "", updated.Description)
+		require.Equal(t, "creator", updated.CreatedBy)
+		require.Equal(t, "editor", updated.UpdatedBy)
+
+		resCompany, err = repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, updated, resCompany)
+	})
+
+	t.Run("deleted company is not updated", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		deleted, err := repo.Create(context.Background(), createTestCompany("TestUpsertByNameDeleted"))
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(context.Background(), deleted.ID, 0))
+
+		created, previous, err := repo.UpsertByName(context.Background(), createTestCompany("TestUpsertByNameDeleted"))
+		require.NoError(t, err)
+		require.Nil(t, previous)
+		require.NotEqual(t, deleted.ID, created.ID)
+	})
+
+	t.Run("upsert company failed", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
+
+		_, _, err := repo.UpsertByName(context.Background(), createTestCompany("TestUpsertByNameFailed"))
+		require.Error(t, err)
+	})
+}
+
 func TestGet(t *testing.T) {
 	t.Run("getting company successfully", func(t *testing.T) {
 		company := createTestCompany("TestGet")
@@ -72,6 +213,254 @@ func TestGet(t *testing.T) {
 	})
 }
 
+func TestList(t *testing.T) {
+	t.Run("list companies page by page", func(t *testing.T) {
+		collection := testCompaniesCollection.Database().Collection("companies_list")
+		repo := repositories.NewCompaniesRepository(collection)
+
+		var created []repositories.Company
+		for _, name := range []string{"TestList1", "TestList2", "TestList3"} {
+			company, err := repo.Create(context.Background(), createTestCompany(name))
+			require.NoError(t, err)
+			created = append(created, company)
+		}
+
+		page, err := repo.List(context.Background(), repositories.ListQuery{Limit: 2})
+		require.NoError(t, err)
+		require.Equal(t, created[:2], page.Companies)
+		require.NotEmpty(t, page.NextCursor)
+
+		page, err = repo.List(context.Background(), repositories.ListQuery{Cursor: page.NextCursor, Limit: 2})
+		require.NoError(t, err)
+		require.Equal(t, created[2:], page.Companies)
+		require.Empty(t, page.NextCursor)
+	})
+
+	t.Run("list companies with filters and sorting", func(t *testing.T) {
+		collection := testCompaniesCollection.Database().Collection("companies_list_sorted")
+		repo := repositories.NewCompaniesRepository(collection)
+
+		create := func(name string, employees int, registered bool, companyType string) repositories.Company {
+			company := createTestCompany(name)
+			company.AmountOfEmployees = employees
+			company.Registered = registered
+			company.Type = companyType
+
+			created, err := repo.Create(context.Background(), company)
+			require.NoError(t, err)
+			return created
+		}
+
+		c1 := create("TestSorted1", 10, true, "NonProfit")
+		c2 := create("TestSorted2", 50, true, "NonProfit")
+		c3 := create("TestSorted3", 50, true, "NonProfit")
+		create("TestSorted4", 500, true, "NonProfit")
+		create("TestSorted5", 50, false, "NonProfit")
+		create("TestSorted6", 50, true, "Corporations")
+
+		registered := true
+		maxEmployees := 100
+		query := repositories.ListQuery{
+			Limit: 2,
+			Filter: repositories.CompanyFilter{
+				Type:         "NonProfit",
+				Registered:   &registered,
+				MaxEmployees: &maxEmployees,
+			},
+			Sort: []repositories.SortField{{Field: "amount_of_employees", Desc: true}, {Field: "name"}},
+		}
+
+		page, err := repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, []repositories.Company{c2, c3}, page.Companies)
+		require.NotEmpty(t, page.NextCursor)
+
+		query.Cursor = page.NextCursor
+		page, err = repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, []repositories.Company{c1}, page.Companies)
+		require.Empty(t, page.NextCursor)
+
+		// cursor can not be used with another sorting
+		query.Sort = []repositories.SortField{{Field: "name"}}
+		_, err = repo.List(context.Background(), query)
+		require.ErrorAs(t, err, &repositories.ErrInvalidCursor{})
+	})
+
+	t.Run("list companies filtered and sorted by metadata", func(t *testing.T) {
+		collection := testCompaniesCollection.Database().Collection("companies_list_metadata")
+		repo := repositories.NewCompaniesRepository(collection)
+
+		create := func(name, actor string) repositories.Company {
+			created, err := repo.Create(reqctx.WithActor(context.Background(), actor), createTestCompany(name))
+			require.NoError(t, err)
+			// creation time is stored with milliseconds precision
+			time.Sleep(2 * time.Millisecond)
+			return created
+		}
+
+		c1 := create("TestMetadata1", "alice")
+		create("TestMetadata2", "bob")
+		c3 := create("TestMetadata3", "alice")
+		c4 := create("TestMetadata4", "alice")
+
+		query := repositories.ListQuery{
+			Limit:  2,
+			Filter: repositories.CompanyFilter{CreatedBy: "alice"},
+			Sort:   []repositories.SortField{{Field: "created_at", Desc: true}},
+		}
+
+		page, err := repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, []repositories.Company{c4, c3}, page.Companies)
+
+		query.Cursor = page.NextCursor
+		page, err = repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, []repositories.Company{c1}, page.Companies)
+
+		createdAfter := c1.CreatedAt.Add(time.Millisecond)
+		createdBefore := c4.CreatedAt
+		page, err = repo.List(context.Background(), repositories.ListQuery{
+			Limit:  10,
+			Filter: repositories.CompanyFilter{CreatedBy: "alice", CreatedAfter: &createdAfter, CreatedBefore: &createdBefore},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []repositories.Company{c3}, page.Companies)
+	})
+
+	t.Run("list companies created before metadata sorted by it", func(t *testing.T) {
+		collection := testCompaniesCollection.Database().Collection("companies_list_legacy")
+		repo := repositories.NewCompaniesRepository(collection)
+
+		var ids []string
+		for _, name := range []string{"TestLegacy1", "TestLegacy2", "TestLegacy3"} {
+			id := bson.NewObjectId().Hex()
+			_, err := collection.InsertOne(context.Background(), primitive.M{"_id": id, "name": name, "type": "Corporations"})
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		require.NoError(t, repositories.FillMissingMetadata(context.Background(), collection))
+
+		for _, field := range []string{"created_at", "created_by", "updated_at", "updated_by"} {
+			query := repositories.ListQuery{Limit: 1, Sort: []repositories.SortField{{Field: field}}}
+
+			var listed []string
+			for {
+				page, err := repo.List(context.Background(), query)
+				require.NoError(t, err)
+				for _, company := range page.Companies {
+					listed = append(listed, company.ID)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			require.Equal(t, ids, listed, field)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		page, err := repo.List(context.Background(), repositories.ListQuery{Cursor: "not a cursor", Limit: 2})
+		require.ErrorAs(t, err, &repositories.ErrInvalidCursor{})
+		require.Empty(t, page)
+	})
+
+	t.Run("list companies failed", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
+
+		page, err := repo.List(context.Background(), repositories.ListQuery{Limit: 2})
+		require.Error(t, err)
+		require.Empty(t, page)
+	})
+}
+
+func TestExport(t *testing.T) {
+	t.Run("export companies", func(t *testing.T) {
+		collection := testCompaniesCollection.Database().Collection("companies_export")
+		repo := repositories.NewCompaniesRepository(collection)
+
+		c1, err := repo.Create(context.Background(), createTestCompany("TestExport1"))
+		require.NoError(t, err)
+		nonProfit := createTestCompany("TestExport2")
+		nonProfit.Type = "NonProfit"
+		_, err = repo.Create(context.Background(), nonProfit)
+		require.NoError(t, err)
+		c3, err := repo.Create(context.Background(), createTestCompany("TestExport3"))
+		require.NoError(t, err)
+		deleted, err := repo.Create(context.Background(), createTestCompany("TestExport4"))
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(context.Background(), deleted.ID, 0))
+
+		var exported []repositories.Company
+		err = repo.Export(context.Background(), repositories.CompanyFilter{Type: c1.Type}, func(company repositories.Company) error {
+			exported = append(exported, company)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []repositories.Company{c1, c3}, exported)
+
+		// iteration stops on the first error
+		count := 0
+		err = repo.Export(context.Background(), repositories.CompanyFilter{}, func(repositories.Company) error {
+			count++
+			return errors.New("stop")
+		})
+		require.EqualError(t, err, "stop")
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("export companies failed", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
+
+		err := repo.Export(context.Background(), repositories.CompanyFilter{}, func(repositories.Company) error { return nil })
+		require.Error(t, err)
+	})
+}
+
+func TestSearch(t *testing.T) {
+	t.Run("search companies by relevance", func(t *testing.T) {
+		collection := testCompaniesCollection.Database().Collection("companies_search")
+		_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys:    bson.M{"name": "text", "description": "text"},
+			Options: options.Index().SetWeights(bson.M{"name": 10, "description": 1}),
+		})
+		require.NoError(t, err)
+
+		repo := repositories.NewCompaniesRepository(collection)
+
+		byDescription := createTestCompany("Sunny")
+		byDescription.Description = "we produce solar energy"
+		byDescription, err = repo.Create(context.Background(), byDescription)
+		require.NoError(t, err)
+
+		byName := createTestCompany("Solar Power")
+		byName, err = repo.Create(context.Background(), byName)
+		require.NoError(t, err)
+
+		_, err = repo.Create(context.Background(), createTestCompany("Windy"))
+		require.NoError(t, err)
+
+		results, err := repo.Search(context.Background(), repositories.SearchQuery{Text: "solar", Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, byName, results[0].Company)
+		require.Equal(t, byDescription, results[1].Company)
+		require.Greater(t, results[0].Score, results[1].Score)
+	})
+
+	t.Run("search companies failed", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
+
+		results, err := repo.Search(context.Background(), repositories.SearchQuery{Text: "solar", Limit: 10})
+		require.Error(t, err)
+		require.Empty(t, results)
+	})
+}
+
 func TestUpdate(t *testing.T) {
 	t.Run("update company successfully, full update", func(t *testing.T) {
 		company := createTestCompany("TestUpdate")
@@ -91,7 +480,7 @@ func TestUpdate(t *testing.T) {
 			Type:              "CompanyTypeNonProfit",
 		}
 
-		err = repo.Update(context.Background(), updateCompany)
+		_, err = repo.Update(context.Background(), updateCompany)
 		require.NoError(t, err)
 
 		var updatedCompany repositories.Company
@@ -119,7 +508,7 @@ func TestUpdate(t *testing.T) {
 			Type:              "CompanyTypeNonProfit",
 		}
 
-		err = repo.Update(context.Background(), updateCompany)
+		_, err = repo.Update(context.Background(), updateCompany)
 		require.NoError(t, err)
 
 		var updatedCompany repositories.Company
@@ -131,6 +520,59 @@ func TestUpdate(t *testing.T) {
 		require.Equal(t, "CompanyTypeNonProfit", updatedCompany.Type)
 	})
 
+	t.Run("update company with expected version", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		company, err := repo.Create(context.Background(), createTestCompany("TestUpdateVersion"))
+		require.NoError(t, err)
+		require.Equal(t, int64(1), company.Version)
+
+		ctx := reqctx.WithActor(context.Background(), "editor")
+		updated, err := repo.Update(ctx, repositories.CompanyUpdate{ID: company.ID, Name: "TestUpdateVersion2", Version: 1})
+		require.NoError(t, err)
+		require.Equal(t, "TestUpdateVersion2", updated.Name)
+		require.Equal(t, company.Description, updated.Description)
+		require.Equal(t, int64(2), updated.Version)
+		require.Equal(t, company.CreatedAt, updated.CreatedAt)
+		require.False(t, updated.UpdatedAt.Before(company.UpdatedAt))
+		require.Equal(t, "editor", updated.UpdatedBy)
+
+		updatedCompany, err := repo.Get(context.Background(), company.ID)
+		require.NoError(t, err)
+		require.Equal(t, "TestUpdateVersion2", updatedCompany.Name)
+		require.Equal(t, int64(2), updatedCompany.Version)
+
+		// version has moved on
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: company.ID, Name: "TestUpdateVersion3", Version: 1})
+		require.ErrorAs(t, err, &repositories.ErrVersionMismatch{})
+
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: bson.NewObjectId().Hex(), Name: "TestUpdateVersion3", Version: 1})
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
+	t.Run("update company created before versioning", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		id := bson.NewObjectId().Hex()
+		_, err := testCompaniesCollection.InsertOne(context.Background(), primitive.M{"_id": id, "name": "TestUpdateUnset", "type": "Corporations"})
+		require.NoError(t, err)
+
+		updated, err := repo.Update(context.Background(), repositories.CompanyUpdate{ID: id, Name: "TestUpdateUnset2", Version: repositories.VersionUnset})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), updated.Version)
+
+		// the company has version now
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: id, Name: "TestUpdateUnset3", Version: repositories.VersionUnset})
+		require.ErrorAs(t, err, &repositories.ErrVersionMismatch{})
+	})
+
+	t.Run("company not found", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		_, err := repo.Update(context.Background(), repositories.CompanyUpdate{ID: bson.NewObjectId().Hex(), Name: "TestUpdateNotFound"})
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
 	t.Run("update company failed", func(t *testing.T) {
 		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
 
@@ -143,7 +585,7 @@ func TestUpdate(t *testing.T) {
 			Type:              "CompanyTypeNonProfit",
 		}
 
-		err := repo.Update(context.Background(), updateCompany)
+		_, err := repo.Update(context.Background(), updateCompany)
 		require.Error(t, err)
 	})
 }
@@ -156,18 +598,152 @@ func TestDelete(t *testing.T) {
 
 		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
 
-		err = repo.Delete(context.Background(), company.ID)
+		err = repo.Delete(reqctx.WithActor(context.Background(), "user"), company.ID, 0)
 		require.NoError(t, err)
 
+		// company is kept but marked as deleted
 		var deletedCompany repositories.Company
 		err = testCompaniesCollection.FindOne(context.Background(), bson.M{"_id": company.ID}).Decode(&deletedCompany)
-		require.ErrorIs(t, err, mongo.ErrNoDocuments)
+		require.NoError(t, err)
+		require.NotNil(t, deletedCompany.DeletedAt)
+		require.Equal(t, "user", deletedCompany.DeletedBy)
+
+		_, err = repo.Get(context.Background(), company.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		err = repo.Delete(context.Background(), company.ID, 0)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
+	t.Run("delete company with expected version", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		company, err := repo.Create(context.Background(), createTestCompany("TestDeleteVersion"))
+		require.NoError(t, err)
+
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: company.ID, Type: "CompanyTypeNonProfit"})
+		require.NoError(t, err)
+
+		err = repo.Delete(context.Background(), company.ID, 1)
+		require.ErrorAs(t, err, &repositories.ErrVersionMismatch{})
+
+		err = repo.Delete(context.Background(), company.ID, 2)
+		require.NoError(t, err)
+
+		_, err = repo.Get(context.Background(), company.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
+	t.Run("company not found", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(testCompaniesCollection)
+
+		err := repo.Delete(context.Background(), bson.NewObjectId().Hex(), 0)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
 	})
 
 	t.Run("delete company failed", func(t *testing.T) {
 		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
 
-		err := repo.Delete(context.Background(), "id")
+		err := repo.Delete(context.Background(), "id", 0)
+		require.Error(t, err)
+	})
+}
+
+func TestRestore(t *testing.T) {
+	collection := testCompaniesCollection.Database().Collection("companies_restore")
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    primitive.D{{Key: "name", Value: 1}, {Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	require.NoError(t, err)
+
+	t.Run("restore company successfully", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(collection)
+
+		company, err := repo.Create(context.Background(), createTestCompany("TestRestore"))
+		require.NoError(t, err)
+
+		err = repo.Delete(context.Background(), company.ID, 0)
+		require.NoError(t, err)
+
+		// name of the deleted company can be used again
+		_, err = repo.Create(context.Background(), createTestCompany("TestRestore"))
+		require.NoError(t, err)
+
+		// but the company can not be restored while the name is taken
+		_, err = repo.Restore(context.Background(), company.ID)
+		require.ErrorAs(t, err, &repositories.ErrDuplicatedKey{})
+
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: company.ID, Name: "TestRestore2"})
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		_, err = collection.UpdateOne(context.Background(), bson.M{"_id": company.ID}, bson.M{"$set": bson.M{"name": "TestRestore2"}})
+		require.NoError(t, err)
+
+		restored, err := repo.Restore(context.Background(), company.ID)
+		require.NoError(t, err)
+		require.Equal(t, "TestRestore2", restored.Name)
+		require.Equal(t, int64(3), restored.Version)
+		require.Nil(t, restored.DeletedAt)
+
+		resCompany, err := repo.Get(context.Background(), company.ID)
+		require.NoError(t, err)
+		require.Equal(t, restored, resCompany)
+	})
+
+	t.Run("company not found", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(collection)
+
+		company, err := repo.Create(context.Background(), createTestCompany("TestRestoreNotDeleted"))
+		require.NoError(t, err)
+
+		_, err = repo.Restore(context.Background(), company.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		_, err = repo.Restore(context.Background(), bson.NewObjectId().Hex())
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
+	t.Run("restore company failed", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
+
+		_, err := repo.Restore(context.Background(), "id")
+		require.Error(t, err)
+	})
+}
+
+func TestPurge(t *testing.T) {
+	t.Run("purge deleted companies", func(t *testing.T) {
+		collection := testCompaniesCollection.Database().Collection("companies_purge")
+		repo := repositories.NewCompaniesRepository(collection)
+
+		active, err := repo.Create(context.Background(), createTestCompany("TestPurgeActive"))
+		require.NoError(t, err)
+
+		deleted, err := repo.Create(context.Background(), createTestCompany("TestPurgeDeleted"))
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(context.Background(), deleted.ID, 0))
+
+		purged, err := repo.Purge(context.Background(), time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		require.Zero(t, purged)
+
+		purged, err = repo.Purge(context.Background(), time.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.Equal(t, int64(1), purged)
+
+		count, err := collection.CountDocuments(context.Background(), bson.M{})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), count)
+
+		_, err = repo.Get(context.Background(), active.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("purge deleted companies failed", func(t *testing.T) {
+		repo := repositories.NewCompaniesRepository(brokenMongoCollection)
+
+		_, err := repo.Purge(context.Background(), time.Now())
 		require.Error(t, err)
 	})
 }
@@ -209,9 +785,11 @@ func startMongoContainer() (*dockertest.Pool, *dockertest.Resource) {
 		log.Fatalf("could not connect to Docker: %s", err)
 	}
 
+	// single node replica set, transactions are not supported by standalone server
 	runOpts := &dockertest.RunOptions{
 		Repository: "mongo",
 		Tag:        "latest",
+		Cmd:        []string{"--replSet", "rs0"},
 		PortBindings: map[docker.Port][]docker.PortBinding{
 			"27017/tcp": {{HostIP: "", HostPort: "37017"}},
 		},
@@ -225,7 +803,7 @@ func startMongoContainer() (*dockertest.Pool, *dockertest.Resource) {
 }
 
 func connectToMongoCollection() *mongo.Collection {
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:37017")
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:37017/?directConnection=true")
 	clientOptions.SetConnectTimeout(time.Duration(2) * time.Second)
 	client, err := mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
@@ -236,9 +814,34 @@ func connectToMongoCollection() *mongo.Collection {
 		log.Fatalf("failed to ping mongo: %v", err)
 	}
 
+	initReplicaSet(client)
+
 	return client.Database("test_companies").Collection("companies")
 }
 
+// initReplicaSet initiates the replica set of the server and waits until the server becomes primary
+func initReplicaSet(client *mongo.Client) {
+	config := primitive.M{"_id": "rs0", "members": primitive.A{primitive.M{"_id": 0, "host": "localhost:27017"}}}
+	err := client.Database("admin").RunCommand(context.Background(), primitive.D{{Key: "replSetInitiate", Value: config}}).Err()
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == 23) { // AlreadyInitialized
+		log.Fatalf("failed to initiate replica set: %v", err)
+	}
+
+	for range 60 {
+		var hello struct {
+			IsWritablePrimary bool `bson:"isWritablePrimary"`
+		}
+		err := client.Database("admin").RunCommand(context.Background(), primitive.D{{Key: "hello", Value: 1}}).Decode(&hello)
+		if err == nil && hello.IsWritablePrimary {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	log.Fatalf("mongo has not become primary")
+}
+
 func createBrokenMongoCollection() *mongo.Collection {
 	clientOptions := options.Client()
 	clientOptions.SetServerSelectionTimeout(time.Second)
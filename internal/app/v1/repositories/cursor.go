@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+)
+
+// sortFields returns values of the fields companies can be sorted by, the zero company gives the value types
+var sortFields = map[string]func(Company) any{
+	"name":                func(c Company) any { return c.Name },
+	"amount_of_employees": func(c Company) any { return c.AmountOfEmployees },
+	"registered":          func(c Company) any { return c.Registered },
+	"type":                func(c Company) any { return c.Type },
+	"created_at":          func(c Company) any { return c.CreatedAt },
+	"created_by":          func(c Company) any { return c.CreatedBy },
+	"updated_at":          func(c Company) any { return c.UpdatedAt },
+	"updated_by":          func(c Company) any { return c.UpdatedBy },
+}
+
+// SortValue returns value of the field the company is sorted by, ok is false if companies can not be sorted by the field
+func SortValue(company Company, field string) (any, bool) {
+	value, ok := sortFields[field]
+	if !ok {
+		return nil, false
+	}
+	return value(company), true
+}
+
+// Cursor is the decoded form of the opaque paging token handed out to clients,
+// it keeps id and sort values of the last company on the page
+type Cursor struct {
+	ID     string                     `json:"id"`
+	Values map[string]json.RawMessage `json:"v,omitempty"`
+}
+
+// NewCursor returns cursor pointing to the company in the list with the given sorting
+func NewCursor(company Company, sort []SortField) Cursor {
+	c := Cursor{ID: company.ID}
+	if len(sort) == 0 {
+		return c
+	}
+
+	c.Values = make(map[string]json.RawMessage, len(sort))
+	for _, s := range sort {
+		c.Values[s.Field], _ = json.Marshal(sortFields[s.Field](company)) //nolint errcheck
+	}
+
+	return c
+}
+
+// Value returns typed sort value of the field stored in the cursor
+func (c Cursor) Value(field string) (any, error) {
+	raw, ok := c.Values[field]
+	if !ok {
+		return nil, ErrInvalidCursor{}
+	}
+
+	value := reflect.New(reflect.TypeOf(sortFields[field](Company{})))
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		return nil, ErrInvalidCursor{}
+	}
+
+	return value.Elem().Interface(), nil
+}
+
+// EncodeCursor returns opaque paging token
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c) //nolint errcheck
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes paging token, ErrInvalidCursor is returned if the token is broken
+// or it was created for another sorting
+func DecodeCursor(token string, sort []SortField) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor{}
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return Cursor{}, ErrInvalidCursor{}
+	}
+
+	// cursor is valid only for the same sorting it was created with
+	if len(c.Values) != len(sort) {
+		return Cursor{}, ErrInvalidCursor{}
+	}
+
+	for _, s := range sort {
+		if _, ok := c.Values[s.Field]; !ok {
+			return Cursor{}, ErrInvalidCursor{}
+		}
+	}
+
+	return c, nil
+}
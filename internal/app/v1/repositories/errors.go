@@ -18,11 +18,39 @@ func (ErrDuplicatedKey) Error() string {
 	return "duplicated key"
 }
 
+type ErrVersionMismatch struct{}
+
+func (ErrVersionMismatch) Error() string {
+	return "version mismatch"
+}
+
+type ErrInvalidCursor struct{}
+
+func (ErrInvalidCursor) Error() string {
+	return "invalid cursor"
+}
+
+// ErrHistoryLost is returned when the change stream can not be resumed, because the changes after the resume token
+// are not kept anymore
+type ErrHistoryLost struct{}
+
+func (ErrHistoryLost) Error() string {
+	return "change stream history is lost"
+}
+
+// codeChangeStreamHistoryLost is the server error code of the resume token which is not in the oplog anymore
+const codeChangeStreamHistoryLost = 286
+
 func handleError(err error) error {
 	if mongo.IsDuplicateKeyError(err) {
 		return ErrDuplicatedKey{}
 	}
 
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(codeChangeStreamHistoryLost) {
+		return errors.Join(ErrHistoryLost{}, err)
+	}
+
 	switch err {
 	case mongo.ErrNoDocuments:
 		return errors.Join(ErrNotFound{}, err)
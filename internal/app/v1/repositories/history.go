@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type History struct {
+	collection *mongo.Collection
+}
+
+func NewHistoryRepository(collection *mongo.Collection) *History {
+	return &History{collection: collection}
+}
+
+func (r History) Add(ctx context.Context, entry HistoryEntry) error {
+	entry.ID = primitive.NewObjectID().Hex()
+	_, err := r.collection.InsertOne(ctx, entry)
+	return handleError(err)
+}
+
+// List returns history of the company from the oldest entry to the newest one
+func (r History) List(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+	filter := bson.M{"company_id": query.CompanyID}
+	if query.Cursor != "" {
+		c, err := DecodeCursor(query.Cursor, nil)
+		if err != nil {
+			return HistoryPage{}, err
+		}
+		filter["_id"] = bson.M{"$gt": c.ID}
+	}
+
+	// fetch one extra entry to find out if there is a next page
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(query.Limit) + 1)
+	cur, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return HistoryPage{}, handleError(err)
+	}
+
+	entries := make([]HistoryEntry, 0, query.Limit+1)
+	if err := cur.All(ctx, &entries); err != nil {
+		return HistoryPage{}, handleError(err)
+	}
+
+	page := HistoryPage{Entries: entries}
+	if len(entries) > query.Limit {
+		page.Entries = entries[:query.Limit]
+		page.NextCursor = EncodeCursor(Cursor{ID: page.Entries[query.Limit-1].ID})
+	}
+
+	return page, nil
+}
+
+// Last returns the latest entry of the company history recorded not later than the given time
+func (r History) Last(ctx context.Context, companyID string, at time.Time) (HistoryEntry, error) {
+	filter := bson.M{"company_id": companyID, "timestamp": bson.M{"$lte": at}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+
+	var entry HistoryEntry
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&entry)
+	return entry, handleError(err)
+}
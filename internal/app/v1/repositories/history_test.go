@@ -0,0 +1,89 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	collection := testCompaniesCollection.Database().Collection("companies_history")
+
+	t.Run("add and list history", func(t *testing.T) {
+		repo := repositories.NewHistoryRepository(collection)
+
+		for _, action := range []string{"create", "update", "delete"} {
+			err := repo.Add(context.Background(), repositories.HistoryEntry{
+				CompanyID: "TestHistory",
+				Action:    action,
+				Actor:     "user",
+				RequestID: "request",
+				Timestamp: time.Now().UTC().Truncate(time.Millisecond),
+				Changes:   []repositories.FieldChange{{Field: "name", Before: "old", After: "new"}},
+			})
+			require.NoError(t, err)
+		}
+
+		err := repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "TestHistoryOther", Action: "create"})
+		require.NoError(t, err)
+
+		page, err := repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "TestHistory", Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 2)
+		require.NotEmpty(t, page.NextCursor)
+		require.Equal(t, "create", page.Entries[0].Action)
+		require.Equal(t, "update", page.Entries[1].Action)
+		require.Equal(t, "user", page.Entries[0].Actor)
+		require.Equal(t, "request", page.Entries[0].RequestID)
+		require.Equal(t, []repositories.FieldChange{{Field: "name", Before: "old", After: "new"}}, page.Entries[0].Changes)
+
+		page, err = repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "TestHistory", Cursor: page.NextCursor, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 1)
+		require.Empty(t, page.NextCursor)
+		require.Equal(t, "delete", page.Entries[0].Action)
+	})
+
+	t.Run("last entry", func(t *testing.T) {
+		repo := repositories.NewHistoryRepository(collection)
+
+		created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		snapshot := createTestCompany("TestHistoryLast")
+		err := repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "TestHistoryLast", Action: "create", Timestamp: created, Snapshot: &snapshot})
+		require.NoError(t, err)
+
+		updatedSnapshot := createTestCompany("TestHistoryLast2")
+		err = repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "TestHistoryLast", Action: "update", Timestamp: created.Add(time.Hour), Snapshot: &updatedSnapshot})
+		require.NoError(t, err)
+
+		entry, err := repo.Last(context.Background(), "TestHistoryLast", created.Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, "create", entry.Action)
+		require.Equal(t, snapshot, *entry.Snapshot)
+
+		entry, err = repo.Last(context.Background(), "TestHistoryLast", created.Add(time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, "update", entry.Action)
+		require.Equal(t, updatedSnapshot, *entry.Snapshot)
+
+		_, err = repo.Last(context.Background(), "TestHistoryLast", created.Add(-time.Minute))
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		repo := repositories.NewHistoryRepository(collection)
+
+		_, err := repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "TestHistory", Cursor: "broken", Limit: 2})
+		require.ErrorAs(t, err, &repositories.ErrInvalidCursor{})
+	})
+
+	t.Run("list history failed", func(t *testing.T) {
+		repo := repositories.NewHistoryRepository(brokenMongoCollection)
+
+		_, err := repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "TestHistory", Limit: 2})
+		require.Error(t, err)
+	})
+}
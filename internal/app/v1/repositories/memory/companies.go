@@ -0,0 +1,478 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// search weights are the same as weights of MongoDB text index
+	nameSearchWeight        = 10
+	descriptionSearchWeight = 1
+)
+
+// Companies keeps companies in memory, it behaves the same way as MongoDB repository
+// and is safe for concurrent use
+type Companies struct {
+	mu        sync.RWMutex
+	companies map[string]repositories.Company
+	// names maps names of not deleted companies to their ids to keep the names unique
+	names map[string]string
+}
+
+func NewCompaniesRepository() *Companies {
+	return &Companies{
+		companies: make(map[string]repositories.Company),
+		names:     make(map[string]string),
+	}
+}
+
+func (r *Companies) Create(ctx context.Context, company repositories.Company) (repositories.Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.create(company, now(), strings.Clone(reqctx.Actor(ctx)))
+}
+
+// CreateMany creates every company independently, result is returned for every company in the same order,
+// nil error means the company has been created
+func (r *Companies) CreateMany(ctx context.Context, companies []repositories.Company) ([]repositories.Company, []error) {
+	created := make([]repositories.Company, len(companies))
+	errs := make([]error, len(companies))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	createdAt, actor := now(), strings.Clone(reqctx.Actor(ctx))
+	for i, company := range companies {
+		created[i], errs[i] = r.create(company, createdAt, actor)
+	}
+
+	return created, errs
+}
+
+// UpsertByName creates the company or replaces fields of not deleted company with the same name.
+// Previous state of the company is returned if it has been updated, nil means the company has been created
+func (r *Companies) UpsertByName(ctx context.Context, company repositories.Company) (repositories.Company, *repositories.Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at, actor := now(), strings.Clone(reqctx.Actor(ctx))
+	id, ok := r.names[company.Name]
+	if !ok {
+		created, err := r.create(company, at, actor)
+		return created, nil, err
+	}
+
+	company = cloneCompany(company)
+	previous := r.companies[id]
+	updated := previous
+	updated.Description = company.Description
+	updated.AmountOfEmployees = company.AmountOfEmployees
+	updated.Registered = company.Registered
+	updated.Type = company.Type
+	updated.Version++
+	updated.UpdatedAt, updated.UpdatedBy = at, actor
+	r.companies[id] = updated
+
+	return updated, &previous, nil
+}
+
+func (r *Companies) Get(_ context.Context, id string) (repositories.Company, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	company, ok := r.companies[id]
+	if !ok || company.DeletedAt != nil {
+		return repositories.Company{}, repositories.ErrNotFound{}
+	}
+
+	return company, nil
+}
+
+func (r *Companies) List(_ context.Context, query repositories.ListQuery) (repositories.CompaniesPage, error) {
+	var after *repositories.Cursor
+	if query.Cursor != "" {
+		c, err := repositories.DecodeCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return repositories.CompaniesPage{}, err
+		}
+		after = &c
+	}
+
+	companies := r.find(query.Filter)
+	slices.SortFunc(companies, func(a, b repositories.Company) int {
+		return compareCompanies(a, b, query.Sort)
+	})
+
+	if after != nil {
+		start, err := afterCursor(companies, *after, query.Sort)
+		if err != nil {
+			return repositories.CompaniesPage{}, err
+		}
+		companies = companies[start:]
+	}
+
+	page := repositories.CompaniesPage{Companies: companies}
+	if len(companies) > query.Limit {
+		page.Companies = companies[:query.Limit:query.Limit]
+		page.NextCursor = repositories.EncodeCursor(repositories.NewCursor(page.Companies[query.Limit-1], query.Sort))
+	}
+
+	return page, nil
+}
+
+// Export calls fn for every company matching the filter in id order, companies are taken at the moment of the call,
+// so fn can use the repository. Iteration stops on the first error returned by fn
+func (r *Companies) Export(ctx context.Context, filter repositories.CompanyFilter, fn func(repositories.Company) error) error {
+	companies := r.find(filter)
+	slices.SortFunc(companies, func(a, b repositories.Company) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	for _, company := range companies {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(company); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Search matches words of the query with beginnings of name and description words, the same way as
+// highlighting does. Name matches are more relevant than description ones, excluded terms ('-' prefixed) filter results out
+func (r *Companies) Search(_ context.Context, query repositories.SearchQuery) ([]repositories.SearchResult, error) {
+	include, exclude := searchTerms(query.Text)
+
+	r.mu.RLock()
+	results := make([]repositories.SearchResult, 0)
+	for _, company := range r.companies {
+		if company.DeletedAt != nil {
+			continue
+		}
+
+		name, description := words(company.Name), words(company.Description)
+		if matches(name, exclude)+matches(description, exclude) > 0 {
+			continue
+		}
+
+		score := float64(nameSearchWeight*matches(name, include) + descriptionSearchWeight*matches(description, include))
+		if score > 0 {
+			results = append(results, repositories.SearchResult{Company: company, Score: score})
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(results, func(a, b repositories.SearchResult) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), strings.Compare(a.ID, b.ID))
+	})
+
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	return results, nil
+}
+
+// Update applies non empty fields of the update and returns updated company
+func (r *Companies) Update(ctx context.Context, update repositories.CompanyUpdate) (repositories.Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	company, err := r.getVersion(update.ID, update.Version)
+	if err != nil {
+		return repositories.Company{}, err
+	}
+
+	if update.Name != "" && update.Name != company.Name {
+		if _, ok := r.names[update.Name]; ok {
+			return repositories.Company{}, repositories.ErrDuplicatedKey{}
+		}
+
+		delete(r.names, company.Name)
+		company.Name = strings.Clone(update.Name)
+		r.names[company.Name] = company.ID
+	}
+	if update.Description != nil {
+		company.Description = strings.Clone(*update.Description)
+	}
+	if update.AmountOfEmployees != 0 {
+		company.AmountOfEmployees = update.AmountOfEmployees
+	}
+	if update.Registered != nil {
+		company.Registered = *update.Registered
+	}
+	if update.Type != "" {
+		company.Type = strings.Clone(update.Type)
+	}
+
+	company.Version++
+	company.UpdatedAt, company.UpdatedBy = now(), strings.Clone(reqctx.Actor(ctx))
+	r.companies[company.ID] = company
+
+	return company, nil
+}
+
+// Delete marks the company as deleted, it is hidden from reads until it is restored or purged
+func (r *Companies) Delete(ctx context.Context, id string, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	company, err := r.getVersion(id, version)
+	if err != nil {
+		return err
+	}
+
+	deletedAt := now()
+	company.DeletedAt, company.DeletedBy = &deletedAt, strings.Clone(reqctx.Actor(ctx))
+	company.Version++
+	r.companies[company.ID] = company
+	delete(r.names, company.Name)
+
+	return nil
+}
+
+// Restore brings back deleted company, ErrDuplicatedKey is returned if the name has been taken since deletion
+func (r *Companies) Restore(ctx context.Context, id string) (repositories.Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	company, ok := r.companies[id]
+	if !ok || company.DeletedAt == nil {
+		return repositories.Company{}, repositories.ErrNotFound{}
+	}
+
+	if _, ok := r.names[company.Name]; ok {
+		return repositories.Company{}, repositories.ErrDuplicatedKey{}
+	}
+
+	company.DeletedAt, company.DeletedBy = nil, ""
+	company.Version++
+	company.UpdatedAt, company.UpdatedBy = now(), strings.Clone(reqctx.Actor(ctx))
+	r.companies[company.ID] = company
+	r.names[company.Name] = company.ID
+
+	return company, nil
+}
+
+// Purge permanently removes companies deleted before the given time
+func (r *Companies) Purge(_ context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, company := range r.companies {
+		if company.DeletedAt != nil && company.DeletedAt.Before(deletedBefore) {
+			delete(r.companies, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// create stores new company, the caller should hold the write lock
+func (r *Companies) create(company repositories.Company, at time.Time, actor string) (repositories.Company, error) {
+	if _, ok := r.names[company.Name]; ok {
+		return repositories.Company{}, repositories.ErrDuplicatedKey{}
+	}
+
+	company = cloneCompany(company)
+	company.ID = primitive.NewObjectID().Hex()
+	company.Version = 1
+	company.CreatedAt, company.CreatedBy = at, actor
+	company.UpdatedAt, company.UpdatedBy = at, actor
+	company.DeletedAt, company.DeletedBy = nil, ""
+
+	r.companies[company.ID] = company
+	r.names[company.Name] = company.ID
+
+	return company, nil
+}
+
+// cloneCompany copies strings of the company, they can be backed by buffers reused by the caller
+// (e.g. fiber reuses request buffers), so the repository owns stored data the same way as database does
+func cloneCompany(company repositories.Company) repositories.Company {
+	company.Name = strings.Clone(company.Name)
+	company.Description = strings.Clone(company.Description)
+	company.Type = strings.Clone(company.Type)
+	return company
+}
+
+// getVersion returns not deleted company if it has expected version, zero version matches any.
+// The caller should hold the lock
+func (r *Companies) getVersion(id string, version int64) (repositories.Company, error) {
+	company, ok := r.companies[id]
+	if !ok || company.DeletedAt != nil {
+		return repositories.Company{}, repositories.ErrNotFound{}
+	}
+
+	if version != 0 && company.Version != version {
+		return repositories.Company{}, repositories.ErrVersionMismatch{}
+	}
+
+	return company, nil
+}
+
+// find returns not deleted companies matching the filter in no particular order
+func (r *Companies) find(filter repositories.CompanyFilter) []repositories.Company {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	companies := make([]repositories.Company, 0)
+	for _, company := range r.companies {
+		if company.DeletedAt == nil && matchFilter(company, filter) {
+			companies = append(companies, company)
+		}
+	}
+
+	return companies
+}
+
+func matchFilter(company repositories.Company, filter repositories.CompanyFilter) bool {
+	switch {
+	case filter.Type != "" && company.Type != filter.Type:
+		return false
+	case filter.Registered != nil && company.Registered != *filter.Registered:
+		return false
+	case filter.MinEmployees != nil && company.AmountOfEmployees < *filter.MinEmployees:
+		return false
+	case filter.MaxEmployees != nil && company.AmountOfEmployees > *filter.MaxEmployees:
+		return false
+	case !inTimeRange(company.CreatedAt, filter.CreatedAfter, filter.CreatedBefore):
+		return false
+	case filter.CreatedBy != "" && company.CreatedBy != filter.CreatedBy:
+		return false
+	case !inTimeRange(company.UpdatedAt, filter.UpdatedAfter, filter.UpdatedBefore):
+		return false
+	case filter.UpdatedBy != "" && company.UpdatedBy != filter.UpdatedBy:
+		return false
+	}
+
+	return true
+}
+
+// inTimeRange reports if t is not earlier than after and earlier than before
+func inTimeRange(t time.Time, after, before *time.Time) bool {
+	return (after == nil || !t.Before(*after)) && (before == nil || t.Before(*before))
+}
+
+// compareCompanies orders companies by the requested sorting, id is always the last key to make the order stable
+func compareCompanies(a, b repositories.Company, sort []repositories.SortField) int {
+	for _, s := range sort {
+		av, _ := repositories.SortValue(a, s.Field)
+		bv, _ := repositories.SortValue(b, s.Field)
+		if c := sortDirection(compareValues(av, bv), s.Desc); c != 0 {
+			return c
+		}
+	}
+
+	return strings.Compare(a.ID, b.ID)
+}
+
+// afterCursor returns index of the first company placed after the cursor in the sorted companies
+func afterCursor(companies []repositories.Company, c repositories.Cursor, sort []repositories.SortField) (int, error) {
+	values := make([]any, 0, len(sort))
+	for _, s := range sort {
+		value, err := c.Value(s.Field)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, value)
+	}
+
+	start, found := slices.BinarySearchFunc(companies, c, func(company repositories.Company, c repositories.Cursor) int {
+		for i, s := range sort {
+			value, _ := repositories.SortValue(company, s.Field)
+			if res := sortDirection(compareValues(value, values[i]), s.Desc); res != 0 {
+				return res
+			}
+		}
+		return strings.Compare(company.ID, c.ID)
+	})
+
+	// the cursor company itself is not included in the next page
+	if found {
+		start++
+	}
+
+	return start, nil
+}
+
+// compareValues compares values of the same sortable field
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int:
+		return cmp.Compare(a, b.(int))
+	case bool:
+		return cmp.Compare(boolToInt(a), boolToInt(b.(bool)))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	default:
+		return 0
+	}
+}
+
+func sortDirection(res int, desc bool) int {
+	if desc {
+		return -res
+	}
+	return res
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// searchTerms returns lower cased words of the search query and words excluded with '-' prefix
+func searchTerms(query string) (include, exclude []string) {
+	for _, field := range strings.Fields(query) {
+		if excluded, ok := strings.CutPrefix(field, "-"); ok {
+			exclude = append(exclude, words(excluded)...)
+			continue
+		}
+		include = append(include, words(field)...)
+	}
+
+	return include, exclude
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// matches returns number of the words starting with one of the terms
+func matches(words, terms []string) int {
+	count := 0
+	for _, word := range words {
+		if slices.ContainsFunc(terms, func(term string) bool { return strings.HasPrefix(word, term) }) {
+			count++
+		}
+	}
+	return count
+}
+
+// now returns current time with the same precision MongoDB repository uses
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
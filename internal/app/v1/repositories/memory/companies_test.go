@@ -0,0 +1,176 @@
+package memory_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/memory"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompaniesContract(t *testing.T) {
+	repotest.RunCompaniesRepository(t, func(t *testing.T) services.CompaniesRepository {
+		return memory.NewCompaniesRepository()
+	})
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	repo := memory.NewCompaniesRepository()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 50)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = repo.Create(context.Background(), createTestCompany("TestCreate"))
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		require.ErrorAs(t, err, &repositories.ErrDuplicatedKey{})
+	}
+	require.Equal(t, 1, created)
+}
+
+func TestGet(t *testing.T) {
+	repo := memory.NewCompaniesRepository()
+
+	_, err := repo.Get(context.Background(), "unknown")
+	require.ErrorAs(t, err, &repositories.ErrNotFound{})
+}
+
+func TestList(t *testing.T) {
+	repo := memory.NewCompaniesRepository()
+
+	for _, c := range []struct {
+		name      string
+		employees int
+		typ       string
+	}{
+		{"A", 30, "NonProfit"},
+		{"B", 10, "Corporations"},
+		{"C", 20, "NonProfit"},
+		{"D", 20, "NonProfit"},
+	} {
+		company := createTestCompany(c.name)
+		company.AmountOfEmployees = c.employees
+		company.Type = c.typ
+		_, err := repo.Create(context.Background(), company)
+		require.NoError(t, err)
+	}
+
+	t.Run("list pages with sorting", func(t *testing.T) {
+		query := repositories.ListQuery{Limit: 2, Sort: []repositories.SortField{{Field: "amount_of_employees", Desc: true}, {Field: "name"}}}
+		page, err := repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, []string{"A", "C"}, names(page.Companies))
+		require.NotEmpty(t, page.NextCursor)
+
+		query.Cursor = page.NextCursor
+		page, err = repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, []string{"D", "B"}, names(page.Companies))
+		require.Empty(t, page.NextCursor)
+
+		// cursor can not be used with another sorting
+		_, err = repo.List(context.Background(), repositories.ListQuery{Cursor: query.Cursor, Limit: 2})
+		require.ErrorAs(t, err, &repositories.ErrInvalidCursor{})
+	})
+
+	t.Run("list with filter", func(t *testing.T) {
+		minEmployees := 15
+		query := repositories.ListQuery{
+			Limit:  10,
+			Filter: repositories.CompanyFilter{Type: "NonProfit", MinEmployees: &minEmployees},
+			Sort:   []repositories.SortField{{Field: "name", Desc: true}},
+		}
+		page, err := repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, []string{"D", "C", "A"}, names(page.Companies))
+		require.Empty(t, page.NextCursor)
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := repo.List(context.Background(), repositories.ListQuery{Cursor: "not a cursor", Limit: 2})
+		require.ErrorAs(t, err, &repositories.ErrInvalidCursor{})
+	})
+}
+
+func TestExport(t *testing.T) {
+	repo := memory.NewCompaniesRepository()
+	for _, name := range []string{"A", "B", "C"} {
+		_, err := repo.Create(context.Background(), createTestCompany(name))
+		require.NoError(t, err)
+	}
+
+	var exported []repositories.Company
+	err := repo.Export(context.Background(), repositories.CompanyFilter{}, func(company repositories.Company) error {
+		exported = append(exported, company)
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"A", "B", "C"}, names(exported))
+	require.IsIncreasing(t, ids(exported))
+}
+
+func TestSearch(t *testing.T) {
+	repo := memory.NewCompaniesRepository()
+
+	solar := createTestCompany("Solar")
+	solar.Description = "Energy company"
+	_, err := repo.Create(context.Background(), solar)
+	require.NoError(t, err)
+
+	energy := createTestCompany("Energy")
+	energy.Description = "Solar panels"
+	_, err = repo.Create(context.Background(), energy)
+	require.NoError(t, err)
+
+	results, err := repo.Search(context.Background(), repositories.SearchQuery{Text: "solar", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "Solar", results[0].Name)
+	require.Greater(t, results[0].Score, results[1].Score)
+
+	results, err = repo.Search(context.Background(), repositories.SearchQuery{Text: "solar -panels", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "Solar", results[0].Name)
+}
+
+func createTestCompany(name string) repositories.Company {
+	return repositories.Company{
+		Name:              name,
+		Description:       "description",
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              "Corporations",
+	}
+}
+
+func names(companies []repositories.Company) []string {
+	res := make([]string, 0, len(companies))
+	for _, company := range companies {
+		res = append(res, company.Name)
+	}
+	return res
+}
+
+func ids(companies []repositories.Company) []string {
+	res := make([]string, 0, len(companies))
+	for _, company := range companies {
+		res = append(res, company.ID)
+	}
+	return res
+}
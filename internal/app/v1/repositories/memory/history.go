@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// History keeps companies history in memory, entries are kept in the order they have been added
+type History struct {
+	mu      sync.RWMutex
+	entries []repositories.HistoryEntry
+}
+
+func NewHistoryRepository() *History {
+	return &History{}
+}
+
+func (r *History) Add(_ context.Context, entry repositories.HistoryEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.ID = primitive.NewObjectID().Hex()
+	// strings can be backed by buffers reused by the caller, so they are copied the same way as database does
+	entry.CompanyID = strings.Clone(entry.CompanyID)
+	entry.Actor = strings.Clone(entry.Actor)
+	entry.RequestID = strings.Clone(entry.RequestID)
+	if entry.Snapshot != nil {
+		snapshot := cloneCompany(*entry.Snapshot)
+		entry.Snapshot = &snapshot
+	}
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+// List returns history of the company from the oldest entry to the newest one
+func (r *History) List(_ context.Context, query repositories.HistoryQuery) (repositories.HistoryPage, error) {
+	var after string
+	if query.Cursor != "" {
+		c, err := repositories.DecodeCursor(query.Cursor, nil)
+		if err != nil {
+			return repositories.HistoryPage{}, err
+		}
+		after = c.ID
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// collect one extra entry to find out if there is a next page
+	entries := make([]repositories.HistoryEntry, 0, query.Limit+1)
+	for _, entry := range r.entries {
+		if entry.CompanyID != query.CompanyID || entry.ID <= after {
+			continue
+		}
+
+		entries = append(entries, entry)
+		if len(entries) > query.Limit {
+			break
+		}
+	}
+
+	page := repositories.HistoryPage{Entries: entries}
+	if len(entries) > query.Limit {
+		page.Entries = entries[:query.Limit]
+		page.NextCursor = repositories.EncodeCursor(repositories.Cursor{ID: page.Entries[query.Limit-1].ID})
+	}
+
+	return page, nil
+}
+
+// Last returns the latest entry of the company history recorded not later than the given time
+func (r *History) Last(_ context.Context, companyID string, at time.Time) (repositories.HistoryEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var last *repositories.HistoryEntry
+	for i, entry := range r.entries {
+		if entry.CompanyID != companyID || entry.Timestamp.After(at) {
+			continue
+		}
+
+		if last == nil || !entry.Timestamp.Before(last.Timestamp) {
+			last = &r.entries[i]
+		}
+	}
+
+	if last == nil {
+		return repositories.HistoryEntry{}, repositories.ErrNotFound{}
+	}
+
+	return *last, nil
+}
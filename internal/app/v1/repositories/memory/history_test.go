@@ -0,0 +1,62 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	t.Run("add and list history", func(t *testing.T) {
+		repo := memory.NewHistoryRepository()
+
+		for _, action := range []string{"create", "update", "delete"} {
+			err := repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "company", Action: action})
+			require.NoError(t, err)
+		}
+		require.NoError(t, repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "other", Action: "create"}))
+
+		page, err := repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "company", Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 2)
+		require.NotEmpty(t, page.NextCursor)
+		require.Equal(t, "create", page.Entries[0].Action)
+		require.Equal(t, "update", page.Entries[1].Action)
+
+		page, err = repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "company", Cursor: page.NextCursor, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 1)
+		require.Empty(t, page.NextCursor)
+		require.Equal(t, "delete", page.Entries[0].Action)
+	})
+
+	t.Run("last entry", func(t *testing.T) {
+		repo := memory.NewHistoryRepository()
+
+		created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "company", Action: "create", Timestamp: created}))
+		require.NoError(t, repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "company", Action: "update", Timestamp: created.Add(time.Hour)}))
+
+		entry, err := repo.Last(context.Background(), "company", created.Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, "create", entry.Action)
+
+		entry, err = repo.Last(context.Background(), "company", created.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, "update", entry.Action)
+
+		_, err = repo.Last(context.Background(), "company", created.Add(-time.Minute))
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		repo := memory.NewHistoryRepository()
+
+		_, err := repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "company", Cursor: "not a cursor", Limit: 2})
+		require.ErrorAs(t, err, &repositories.ErrInvalidCursor{})
+	})
+}
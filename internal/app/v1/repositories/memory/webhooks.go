@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhooks keeps webhook subscriptions and their deliveries in memory in the order they have been added
+type Webhooks struct {
+	mu            sync.RWMutex
+	subscriptions []repositories.WebhookSubscription
+	deliveries    []repositories.WebhookDelivery
+}
+
+func NewWebhooksRepository() *Webhooks {
+	return &Webhooks{}
+}
+
+func (r *Webhooks) AddSubscription(ctx context.Context, subscription repositories.WebhookSubscription) (repositories.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscription.ID = primitive.NewObjectID().Hex()
+	subscription.URL = strings.Clone(subscription.URL)
+	subscription.Secret = strings.Clone(subscription.Secret)
+	subscription.CreatedAt = now()
+	subscription.CreatedBy = strings.Clone(reqctx.Actor(ctx))
+	r.subscriptions = append(r.subscriptions, subscription)
+	return subscription, nil
+}
+
+func (r *Webhooks) GetSubscription(_ context.Context, id string) (repositories.WebhookSubscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := slices.IndexFunc(r.subscriptions, func(s repositories.WebhookSubscription) bool { return s.ID == id })
+	if i < 0 {
+		return repositories.WebhookSubscription{}, repositories.ErrNotFound{}
+	}
+
+	return r.subscriptions[i], nil
+}
+
+// ListSubscriptions returns all subscriptions from the oldest one to the newest one
+func (r *Webhooks) ListSubscriptions(context.Context) ([]repositories.WebhookSubscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.subscriptions), nil
+}
+
+// DeleteSubscription removes the subscription together with its deliveries
+func (r *Webhooks) DeleteSubscription(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.subscriptions, func(s repositories.WebhookSubscription) bool { return s.ID == id })
+	if i < 0 {
+		return repositories.ErrNotFound{}
+	}
+
+	r.subscriptions = slices.Delete(r.subscriptions, i, i+1)
+	r.deliveries = slices.DeleteFunc(r.deliveries, func(d repositories.WebhookDelivery) bool { return d.SubscriptionID == id })
+	return nil
+}
+
+func (r *Webhooks) AddDelivery(_ context.Context, delivery repositories.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery.ID = primitive.NewObjectID().Hex()
+	delivery.SubscriptionID = strings.Clone(delivery.SubscriptionID)
+	delivery.EventID = strings.Clone(delivery.EventID)
+	delivery.EventType = strings.Clone(delivery.EventType)
+	delivery.Error = strings.Clone(delivery.Error)
+	r.deliveries = append(r.deliveries, delivery)
+	return nil
+}
+
+// ListDeliveries returns up to limit latest deliveries of the subscription from the newest one to the oldest one
+func (r *Webhooks) ListDeliveries(_ context.Context, subscriptionID string, limit int) ([]repositories.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deliveries := make([]repositories.WebhookDelivery, 0, limit)
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if r.deliveries[i].SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, r.deliveries[i])
+		}
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/memory"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
+)
+
+func TestWebhooksContract(t *testing.T) {
+	repotest.RunWebhooksRepository(t, func(t *testing.T) webhook.Store {
+		return memory.NewWebhooksRepository()
+	})
+}
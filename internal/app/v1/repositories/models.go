@@ -1,14 +1,30 @@
 package repositories
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
 type Company struct {
-	ID                string `bson:"_id"`
-	Name              string `bson:"name"`
-	Description       string `bson:"description"`
-	AmountOfEmployees int    `bson:"amount_of_employees"`
-	Registered        bool   `bson:"registered"`
-	Type              string `bson:"type"`
+	ID                string     `bson:"_id"`
+	Name              string     `bson:"name"`
+	Description       string     `bson:"description"`
+	AmountOfEmployees int        `bson:"amount_of_employees"`
+	Registered        bool       `bson:"registered"`
+	Type              string     `bson:"type"`
+	Version           int64      `bson:"version"`
+	CreatedAt         time.Time  `bson:"created_at"`
+	CreatedBy         string     `bson:"created_by"`
+	UpdatedAt         time.Time  `bson:"updated_at"`
+	UpdatedBy         string     `bson:"updated_by"`
+	DeletedAt         *time.Time `bson:"deleted_at,omitempty"`
+	DeletedBy         string     `bson:"deleted_by,omitempty"`
 }
 
+// VersionUnset is expected version of the company which has no version yet, as the ones created before versioning
+const VersionUnset int64 = -1
+
 type CompanyUpdate struct {
 	ID                string
 	Name              string
@@ -16,4 +32,165 @@ type CompanyUpdate struct {
 	AmountOfEmployees int
 	Registered        *bool
 	Type              string
+	// Version is expected current version of the company, zero means the update is unconditional
+	// and VersionUnset means the company should have no version
+	Version int64
+}
+
+type CompanyFilter struct {
+	Type          string
+	Registered    *bool
+	MinEmployees  *int
+	MaxEmployees  *int
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	CreatedBy     string
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	UpdatedBy     string
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+type ListQuery struct {
+	Cursor string
+	Limit  int
+	Filter CompanyFilter
+	Sort   []SortField
+}
+
+type CompaniesPage struct {
+	Companies  []Company
+	NextCursor string
+}
+
+type SearchQuery struct {
+	Text  string
+	Limit int
+}
+
+type SearchResult struct {
+	Company `bson:",inline"`
+	Score   float64 `bson:"score"`
+}
+
+type HistoryEntry struct {
+	ID        string        `bson:"_id"`
+	CompanyID string        `bson:"company_id"`
+	Action    string        `bson:"action"`
+	Actor     string        `bson:"actor,omitempty"`
+	RequestID string        `bson:"request_id,omitempty"`
+	Timestamp time.Time     `bson:"timestamp"`
+	Changes   []FieldChange `bson:"changes,omitempty"`
+	Snapshot  *Company      `bson:"snapshot,omitempty"`
+}
+
+type FieldChange struct {
+	Field  string `bson:"field"`
+	Before any    `bson:"before"`
+	After  any    `bson:"after"`
+}
+
+// DiffCompanies returns fields which values differ, nil before means the company has been created
+func DiffCompanies(before *Company, after Company) []FieldChange {
+	var changes []FieldChange
+	add := func(field string, before, after any, changed bool) {
+		if changed {
+			changes = append(changes, FieldChange{Field: field, Before: before, After: after})
+		}
+	}
+
+	if before == nil {
+		add("name", nil, after.Name, true)
+		add("description", nil, after.Description, true)
+		add("amount_of_employees", nil, after.AmountOfEmployees, true)
+		add("registered", nil, after.Registered, true)
+		add("type", nil, after.Type, true)
+		return changes
+	}
+
+	add("name", before.Name, after.Name, before.Name != after.Name)
+	add("description", before.Description, after.Description, before.Description != after.Description)
+	add("amount_of_employees", before.AmountOfEmployees, after.AmountOfEmployees, before.AmountOfEmployees != after.AmountOfEmployees)
+	add("registered", before.Registered, after.Registered, before.Registered != after.Registered)
+	add("type", before.Type, after.Type, before.Type != after.Type)
+	return changes
+}
+
+type HistoryQuery struct {
+	CompanyID string
+	Cursor    string
+	Limit     int
+}
+
+type HistoryPage struct {
+	Entries    []HistoryEntry
+	NextCursor string
+}
+
+type OutboxEvent struct {
+	ID        string `bson:"_id"`
+	Type      string `bson:"type"`
+	CompanyID string `bson:"company_id"`
+	// Company is the state of the company after the change, it is not set for deleted companies
+	Company *Company `bson:"company,omitempty"`
+	// Changes are the fields modified by the update, they are set for updated companies only
+	Changes   []FieldChange `bson:"changes,omitempty"`
+	CreatedAt time.Time     `bson:"created_at"`
+	// Attempts is number of times the event has been claimed for delivery
+	Attempts      int        `bson:"attempts"`
+	NextAttemptAt time.Time  `bson:"next_attempt_at"`
+	LastError     string     `bson:"last_error,omitempty"`
+	DeliveredAt   *time.Time `bson:"delivered_at,omitempty"`
+}
+
+type WebhookSubscription struct {
+	ID        string    `bson:"_id"`
+	URL       string    `bson:"url"`
+	Secret    string    `bson:"secret"`
+	CreatedAt time.Time `bson:"created_at"`
+	CreatedBy string    `bson:"created_by,omitempty"`
+}
+
+// WebhookDelivery is one attempt to deliver an event to the subscriber
+type WebhookDelivery struct {
+	ID             string        `bson:"_id"`
+	SubscriptionID string        `bson:"subscription_id"`
+	EventID        string        `bson:"event_id"`
+	EventType      string        `bson:"event_type"`
+	Attempt        int           `bson:"attempt"`
+	StatusCode     int           `bson:"status_code,omitempty"`
+	Error          string        `bson:"error,omitempty"`
+	Timestamp      time.Time     `bson:"timestamp"`
+	Duration       time.Duration `bson:"duration"`
+}
+
+// CompanyChange is a change of the companies collection
+type CompanyChange struct {
+	// ID is unique for the change, the change read again after resuming has the same ID
+	ID string
+	// Token is the resume token of the change stream after the change
+	Token     []byte
+	Operation string
+	CompanyID string
+	// Company is the state of the company after the change, it is not set for deleted companies
+	Company *Company
+	// Before is the state of the company before the change, it is set only when the collection has pre-images enabled
+	Before *Company
+	// UpdatedFields and RemovedFields are the fields modified by the update operation
+	UpdatedFields []string
+	RemovedFields []string
+	Time          time.Time
+	// Err is set for the change which can not be read, for example a company inserted with id of another type,
+	// only ID, Token and Operation are set then
+	Err error
+}
+
+type ResumeToken struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updated_at"`
 }
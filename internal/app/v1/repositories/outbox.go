@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	EventCompanyCreated = "company.created"
+	EventCompanyUpdated = "company.updated"
+	EventCompanyDeleted = "company.deleted"
+)
+
+// Outbox keeps company events written together with the changes until they are delivered
+type Outbox struct {
+	collection *mongo.Collection
+}
+
+func NewOutboxRepository(collection *mongo.Collection) *Outbox {
+	return &Outbox{collection: collection}
+}
+
+// Claim returns event which is not delivered and is due for the next attempt, the event is hidden from other
+// claims for lease time. Event is not claimed while an older event of the same company is not delivered,
+// so events of every company are delivered in order. ErrNotFound is returned if there are no such events
+func (r Outbox) Claim(ctx context.Context, at time.Time, lease time.Duration) (OutboxEvent, error) {
+	filter := bson.M{"delivered_at": nil, "next_attempt_at": bson.M{"$lte": at}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"company_id": 1})
+	cur, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return OutboxEvent{}, handleError(err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var due OutboxEvent
+		if err := cur.Decode(&due); err != nil {
+			return OutboxEvent{}, handleError(err)
+		}
+
+		head, err := r.head(ctx, due.CompanyID)
+		if errors.As(err, &ErrNotFound{}) {
+			continue
+		}
+		if err != nil {
+			return OutboxEvent{}, err
+		}
+
+		// only the oldest pending event of the company can be claimed, the later ones are postponed
+		// until its next attempt, so they are not read by every claim while it is failing
+		if head.ID != due.ID {
+			if head.NextAttemptAt.After(at) {
+				if err := r.postpone(ctx, due.ID, head.NextAttemptAt); err != nil {
+					return OutboxEvent{}, err
+				}
+			}
+			continue
+		}
+
+		event, err := r.claim(ctx, due.ID, at, lease)
+		if errors.As(err, &ErrNotFound{}) {
+			// the event has been claimed or delivered by another relay
+			continue
+		}
+		return event, err
+	}
+
+	if err := cur.Err(); err != nil {
+		return OutboxEvent{}, handleError(err)
+	}
+
+	return OutboxEvent{}, ErrNotFound{}
+}
+
+// head returns the oldest event of the company which is not delivered
+func (r Outbox) head(ctx context.Context, companyID string) (OutboxEvent, error) {
+	opts := options.FindOne().SetSort(bson.M{"_id": 1}).SetProjection(bson.M{"next_attempt_at": 1})
+
+	var event OutboxEvent
+	err := r.collection.FindOne(ctx, bson.M{"company_id": companyID, "delivered_at": nil}, opts).Decode(&event)
+	return event, handleError(err)
+}
+
+func (r Outbox) postpone(ctx context.Context, id string, nextAttemptAt time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "delivered_at": nil}, bson.M{"$max": bson.M{"next_attempt_at": nextAttemptAt}})
+	return handleError(err)
+}
+
+func (r Outbox) claim(ctx context.Context, id string, at time.Time, lease time.Duration) (OutboxEvent, error) {
+	filter := bson.M{"_id": id, "delivered_at": nil, "next_attempt_at": bson.M{"$lte": at}}
+	update := bson.M{
+		"$set": bson.M{"next_attempt_at": at.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var event OutboxEvent
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&event)
+	return event, handleError(err)
+}
+
+func (r Outbox) MarkDelivered(ctx context.Context, id string, at time.Time) error {
+	update := bson.M{
+		"$set":   bson.M{"delivered_at": at},
+		"$unset": bson.M{"last_error": ""},
+	}
+
+	_, err := r.collection.UpdateByID(ctx, id, update)
+	return handleError(err)
+}
+
+// MarkFailed records the delivery error, the event is claimed again not earlier than nextAttemptAt
+func (r Outbox) MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	update := bson.M{"$set": bson.M{"last_error": lastError, "next_attempt_at": nextAttemptAt}}
+
+	_, err := r.collection.UpdateByID(ctx, id, update)
+	return handleError(err)
+}
+
+func newOutboxEvent(eventType, companyID string, company *Company) OutboxEvent {
+	at := now()
+	return OutboxEvent{
+		ID:            primitive.NewObjectID().Hex(),
+		Type:          eventType,
+		CompanyID:     companyID,
+		Company:       company,
+		CreatedAt:     at,
+		NextAttemptAt: at,
+	}
+}
@@ -0,0 +1,195 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCompaniesWithOutbox(t *testing.T) {
+	collection := testCompaniesCollection.Database().Collection("companies_with_outbox")
+	outboxCollection := testCompaniesCollection.Database().Collection("companies_outbox")
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    primitive.D{{Key: "name", Value: 1}, {Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	require.NoError(t, err)
+
+	repo := repositories.NewCompaniesRepository(collection, repositories.WithOutbox(outboxCollection))
+
+	events := func(t *testing.T, companyID string) []repositories.OutboxEvent {
+		cur, err := outboxCollection.Find(context.Background(), primitive.M{"company_id": companyID}, options.Find().SetSort(primitive.M{"_id": 1}))
+		require.NoError(t, err)
+
+		var res []repositories.OutboxEvent
+		require.NoError(t, cur.All(context.Background(), &res))
+		return res
+	}
+
+	t.Run("events are written with the changes", func(t *testing.T) {
+		created, err := repo.Create(context.Background(), repotest.NewCompany("outbox"))
+		require.NoError(t, err)
+
+		updated, err := repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit"})
+		require.NoError(t, err)
+
+		upsert := repotest.NewCompany("outbox")
+		upsert.Name = created.Name
+		upserted, _, err := repo.UpsertByName(context.Background(), upsert)
+		require.NoError(t, err)
+
+		require.NoError(t, repo.Delete(context.Background(), created.ID, 0))
+
+		restored, err := repo.Restore(context.Background(), created.ID)
+		require.NoError(t, err)
+
+		res := events(t, created.ID)
+		require.Len(t, res, 5)
+		require.Equal(t, repositories.EventCompanyCreated, res[0].Type)
+		require.Equal(t, created, *res[0].Company)
+		require.Equal(t, repositories.EventCompanyUpdated, res[1].Type)
+		require.Equal(t, updated, *res[1].Company)
+		require.Equal(t, []repositories.FieldChange{{Field: "type", Before: "Corporations", After: "NonProfit"}}, res[1].Changes)
+		require.Equal(t, repositories.EventCompanyUpdated, res[2].Type)
+		require.Equal(t, upserted, *res[2].Company)
+		require.Equal(t, []repositories.FieldChange{{Field: "type", Before: "NonProfit", After: "Corporations"}}, res[2].Changes)
+		require.Equal(t, repositories.EventCompanyDeleted, res[3].Type)
+		require.Nil(t, res[3].Company)
+		require.Equal(t, repositories.EventCompanyCreated, res[4].Type)
+		require.Equal(t, restored, *res[4].Company)
+		for _, event := range res {
+			require.Equal(t, created.ID, event.CompanyID)
+			require.Nil(t, event.DeliveredAt)
+			require.Zero(t, event.Attempts)
+		}
+	})
+
+	t.Run("failed changes write no events", func(t *testing.T) {
+		created, err := repo.Create(context.Background(), repotest.NewCompany("outbox"))
+		require.NoError(t, err)
+
+		_, err = repo.Create(context.Background(), repositories.Company{Name: created.Name})
+		require.ErrorAs(t, err, &repositories.ErrDuplicatedKey{})
+
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit", Version: 5})
+		require.ErrorAs(t, err, &repositories.ErrVersionMismatch{})
+
+		err = repo.Delete(context.Background(), created.ID, 5)
+		require.ErrorAs(t, err, &repositories.ErrVersionMismatch{})
+
+		require.Len(t, events(t, created.ID), 1)
+
+		count, err := outboxCollection.CountDocuments(context.Background(), primitive.M{"company.name": created.Name})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), count)
+	})
+
+	t.Run("create many", func(t *testing.T) {
+		first := repotest.NewCompany("outbox")
+		created, errs := repo.CreateMany(context.Background(), []repositories.Company{first, first})
+		require.NoError(t, errs[0])
+		require.ErrorAs(t, errs[1], &repositories.ErrDuplicatedKey{})
+
+		res := events(t, created[0].ID)
+		require.Len(t, res, 1)
+		require.Equal(t, repositories.EventCompanyCreated, res[0].Type)
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	collection := testCompaniesCollection.Database().Collection("outbox")
+	repo := repositories.NewOutboxRepository(collection)
+	companies := repositories.NewCompaniesRepository(testCompaniesCollection.Database().Collection("companies_outbox_claim"), repositories.WithOutbox(collection))
+
+	first, err := companies.Create(context.Background(), repotest.NewCompany("claim"))
+	require.NoError(t, err)
+	second, err := companies.Create(context.Background(), repotest.NewCompany("claim"))
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Millisecond).Add(time.Second)
+
+	// events are claimed in the order they have been written and are hidden while they are claimed
+	event, err := repo.Claim(context.Background(), now, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, event.CompanyID)
+	require.Equal(t, 1, event.Attempts)
+	require.Equal(t, now.Add(time.Minute), event.NextAttemptAt)
+
+	event, err = repo.Claim(context.Background(), now, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, second.ID, event.CompanyID)
+
+	_, err = repo.Claim(context.Background(), now, time.Minute)
+	require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+	// failed event is claimed again when its next attempt is due
+	require.NoError(t, repo.MarkFailed(context.Background(), event.ID, "broken", now.Add(time.Second)))
+	require.NoError(t, repo.MarkDelivered(context.Background(), event.ID, now))
+
+	// delivered event is not claimed again, the other one is claimed when its lease is over
+	event, err = repo.Claim(context.Background(), now.Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, event.CompanyID)
+	require.Equal(t, 2, event.Attempts)
+
+	require.NoError(t, repo.MarkFailed(context.Background(), event.ID, "broken", now.Add(2*time.Hour)))
+	_, err = repo.Claim(context.Background(), now.Add(time.Hour), time.Minute)
+	require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+	event, err = repo.Claim(context.Background(), now.Add(2*time.Hour), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, event.CompanyID)
+	require.Equal(t, "broken", event.LastError)
+	require.Equal(t, 3, event.Attempts)
+}
+
+func TestOutboxCompanyOrder(t *testing.T) {
+	collection := testCompaniesCollection.Database().Collection("outbox_order")
+	repo := repositories.NewOutboxRepository(collection)
+	companies := repositories.NewCompaniesRepository(testCompaniesCollection.Database().Collection("companies_outbox_order"), repositories.WithOutbox(collection))
+
+	first, err := companies.Create(context.Background(), repotest.NewCompany("order"))
+	require.NoError(t, err)
+	second, err := companies.Create(context.Background(), repotest.NewCompany("order"))
+	require.NoError(t, err)
+	_, err = companies.Update(context.Background(), repositories.CompanyUpdate{ID: first.ID, Type: "NonProfit"})
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Millisecond).Add(time.Second)
+
+	created, err := repo.Claim(context.Background(), now, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, created.CompanyID)
+	require.NoError(t, repo.MarkFailed(context.Background(), created.ID, "broken", now.Add(time.Hour)))
+
+	// update of the first company waits for its failed event, events of other companies are not blocked
+	event, err := repo.Claim(context.Background(), now, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, second.ID, event.CompanyID)
+	require.NoError(t, repo.MarkDelivered(context.Background(), event.ID, now))
+
+	_, err = repo.Claim(context.Background(), now, time.Minute)
+	require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+	// the blocked update is postponed until the next attempt of the failed event, so it is not read again before
+	var postponed repositories.OutboxEvent
+	require.NoError(t, collection.FindOne(context.Background(), primitive.M{"company_id": first.ID, "type": repositories.EventCompanyUpdated}).Decode(&postponed))
+	require.Equal(t, now.Add(time.Hour), postponed.NextAttemptAt)
+
+	event, err = repo.Claim(context.Background(), now.Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, created.ID, event.ID)
+	require.NoError(t, repo.MarkDelivered(context.Background(), event.ID, now.Add(time.Hour)))
+
+	event, err = repo.Claim(context.Background(), now.Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, event.CompanyID)
+	require.Equal(t, repositories.EventCompanyUpdated, event.Type)
+}
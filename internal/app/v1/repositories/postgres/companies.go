@@ -0,0 +1,538 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const companyColumns = `id, name, description, amount_of_employees, registered, type, version,
+	created_at, created_by, updated_at, updated_by, deleted_at, deleted_by`
+
+// sortColumns are columns companies can be sorted by, sort fields are named after them
+var sortColumns = map[string]bool{
+	"name":                true,
+	"amount_of_employees": true,
+	"registered":          true,
+	"type":                true,
+	"created_at":          true,
+	"created_by":          true,
+	"updated_at":          true,
+	"updated_by":          true,
+}
+
+type Companies struct {
+	pool *pgxpool.Pool
+}
+
+func NewCompaniesRepository(pool *pgxpool.Pool) *Companies {
+	return &Companies{pool: pool}
+}
+
+func (r Companies) Create(ctx context.Context, company repositories.Company) (repositories.Company, error) {
+	company, err := insertCompany(ctx, r.pool, company)
+	if err != nil {
+		return repositories.Company{}, handleError(err)
+	}
+	return company, nil
+}
+
+// CreateMany inserts companies with one statement skipping the ones with taken names, so failure of one company
+// does not stop the others. Result is returned for every company in the same order, nil error means the company has been created
+func (r Companies) CreateMany(ctx context.Context, companies []repositories.Company) ([]repositories.Company, []error) {
+	created := make([]repositories.Company, len(companies))
+	errs := make([]error, len(companies))
+	if len(companies) == 0 {
+		return created, errs
+	}
+
+	createdAt, actor := now(), reqctx.Actor(ctx)
+	ids := make([]string, 0, len(companies))
+	names := make([]string, 0, len(companies))
+	descriptions := make([]string, 0, len(companies))
+	employees := make([]int, 0, len(companies))
+	registered := make([]bool, 0, len(companies))
+	types := make([]string, 0, len(companies))
+	for i, company := range companies {
+		company.ID = newID()
+		company.Version = 1
+		company.CreatedAt = createdAt
+		company.CreatedBy = actor
+		company.UpdatedAt = createdAt
+		company.UpdatedBy = actor
+		created[i] = company
+
+		ids = append(ids, company.ID)
+		names = append(names, company.Name)
+		descriptions = append(descriptions, company.Description)
+		employees = append(employees, company.AmountOfEmployees)
+		registered = append(registered, company.Registered)
+		types = append(types, company.Type)
+	}
+
+	// rows are inserted in the order of the arrays, so the first company wins if names are duplicated in the batch
+	rows, err := r.pool.Query(ctx, `INSERT INTO companies
+		(id, name, description, amount_of_employees, registered, type, version, created_at, created_by, updated_at, updated_by)
+		SELECT c.id, c.name, c.description, c.amount_of_employees, c.registered, c.type, 1, $7, $8, $7, $8
+		FROM unnest($1::uuid[], $2::text[], $3::text[], $4::integer[], $5::boolean[], $6::text[])
+			WITH ORDINALITY AS c(id, name, description, amount_of_employees, registered, type, n)
+		ORDER BY c.n
+		ON CONFLICT (name) WHERE deleted_at IS NULL DO NOTHING
+		RETURNING id::text`,
+		ids, names, descriptions, employees, registered, types, createdAt, actor)
+	if err == nil {
+		var inserted []string
+		inserted, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err == nil {
+			for i, company := range created {
+				if !slices.Contains(inserted, company.ID) {
+					created[i], errs[i] = repositories.Company{}, repositories.ErrDuplicatedKey{}
+				}
+			}
+			return created, errs
+		}
+	}
+
+	// the whole batch has failed
+	for i := range errs {
+		created[i], errs[i] = repositories.Company{}, handleError(err)
+	}
+	return created, errs
+}
+
+// UpsertByName creates the company or replaces fields of not deleted company with the same name.
+// Previous state of the company is returned if it has been updated, nil means the company has been created
+func (r Companies) UpsertByName(ctx context.Context, company repositories.Company) (repositories.Company, *repositories.Company, error) {
+	var res repositories.Company
+	var previous *repositories.Company
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		row := tx.QueryRow(ctx, `SELECT `+companyColumns+` FROM companies WHERE name = $1 AND deleted_at IS NULL FOR UPDATE`, company.Name)
+		existing, err := scanCompany(row)
+		if errors.Is(err, pgx.ErrNoRows) {
+			res, err = insertCompany(ctx, tx, company)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		previous = &existing
+		row = tx.QueryRow(ctx, `UPDATE companies
+			SET description = $2, amount_of_employees = $3, registered = $4, type = $5,
+				updated_at = $6, updated_by = $7, version = version + 1
+			WHERE id = $1
+			RETURNING `+companyColumns,
+			existing.ID, company.Description, company.AmountOfEmployees, company.Registered, company.Type,
+			now(), reqctx.Actor(ctx))
+		res, err = scanCompany(row)
+		return err
+	})
+	if err != nil {
+		return repositories.Company{}, nil, handleError(err)
+	}
+
+	return res, previous, nil
+}
+
+func (r Companies) Get(ctx context.Context, id string) (repositories.Company, error) {
+	if !validID(id) {
+		return repositories.Company{}, repositories.ErrNotFound{}
+	}
+
+	row := r.pool.QueryRow(ctx, `SELECT `+companyColumns+` FROM companies WHERE id = $1 AND deleted_at IS NULL`, id)
+	company, err := scanCompany(row)
+	return company, handleError(err)
+}
+
+func (r Companies) List(ctx context.Context, query repositories.ListQuery) (repositories.CompaniesPage, error) {
+	var q sqlBuilder
+	where := getListFilter(&q, query.Filter)
+	if query.Cursor != "" {
+		c, err := repositories.DecodeCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return repositories.CompaniesPage{}, err
+		}
+
+		after, err := getAfterCursorFilter(&q, c, query.Sort)
+		if err != nil {
+			return repositories.CompaniesPage{}, err
+		}
+		where = append(where, after)
+	}
+
+	orderBy, err := getOrderBy(query.Sort)
+	if err != nil {
+		return repositories.CompaniesPage{}, err
+	}
+
+	// fetch one extra row to find out if there is a next page
+	sql := `SELECT ` + companyColumns + ` FROM companies WHERE ` + strings.Join(where, " AND ") +
+		` ORDER BY ` + orderBy + ` LIMIT ` + q.arg(query.Limit+1)
+	rows, err := r.pool.Query(ctx, sql, q.args...)
+	if err != nil {
+		return repositories.CompaniesPage{}, handleError(err)
+	}
+
+	companies, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repositories.Company, error) {
+		return scanCompany(row)
+	})
+	if err != nil {
+		return repositories.CompaniesPage{}, handleError(err)
+	}
+
+	page := repositories.CompaniesPage{Companies: companies}
+	if len(companies) > query.Limit {
+		page.Companies = companies[:query.Limit]
+		page.NextCursor = repositories.EncodeCursor(repositories.NewCursor(page.Companies[query.Limit-1], query.Sort))
+	}
+
+	return page, nil
+}
+
+// Export iterates over all companies matching the filter in id order without loading them into memory,
+// iteration stops on the first error returned by fn
+func (r Companies) Export(ctx context.Context, filter repositories.CompanyFilter, fn func(repositories.Company) error) error {
+	var q sqlBuilder
+	where := getListFilter(&q, filter)
+	rows, err := r.pool.Query(ctx, `SELECT `+companyColumns+` FROM companies WHERE `+strings.Join(where, " AND ")+` ORDER BY id`, q.args...)
+	if err != nil {
+		return handleError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		company, err := scanCompany(rows)
+		if err != nil {
+			return handleError(err)
+		}
+
+		if err := fn(company); err != nil {
+			return err
+		}
+	}
+
+	return handleError(rows.Err())
+}
+
+// Search uses full text search, ranks are weighted the same way as MongoDB text index: name matches are
+// ten times more relevant than description ones
+func (r Companies) Search(ctx context.Context, query repositories.SearchQuery) ([]repositories.SearchResult, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+companyColumns+`, ts_rank(search, query) AS score
+		FROM companies, websearch_to_tsquery('english', $1) AS query
+		WHERE deleted_at IS NULL AND search @@ query
+		ORDER BY score DESC, id
+		LIMIT $2`, query.Text, query.Limit)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	results, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repositories.SearchResult, error) {
+		var result repositories.SearchResult
+		var score float32
+		if err := row.Scan(append(companyFields(&result.Company), &score)...); err != nil {
+			return repositories.SearchResult{}, err
+		}
+
+		normalizeTimes(&result.Company)
+		result.Score = float64(score)
+		return result, nil
+	})
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return results, nil
+}
+
+// Update applies non empty fields of the update and returns updated company
+func (r Companies) Update(ctx context.Context, company repositories.CompanyUpdate) (repositories.Company, error) {
+	if !validID(company.ID) {
+		return repositories.Company{}, repositories.ErrNotFound{}
+	}
+
+	var q sqlBuilder
+	set := []string{
+		"updated_at = " + q.arg(now()),
+		"updated_by = " + q.arg(reqctx.Actor(ctx)),
+		"version = version + 1",
+	}
+	if company.Name != "" {
+		set = append(set, "name = "+q.arg(company.Name))
+	}
+	if company.Description != nil {
+		set = append(set, "description = "+q.arg(*company.Description))
+	}
+	if company.AmountOfEmployees != 0 {
+		set = append(set, "amount_of_employees = "+q.arg(company.AmountOfEmployees))
+	}
+	if company.Registered != nil {
+		set = append(set, "registered = "+q.arg(*company.Registered))
+	}
+	if company.Type != "" {
+		set = append(set, "type = "+q.arg(company.Type))
+	}
+
+	sql := `UPDATE companies SET ` + strings.Join(set, ", ") +
+		` WHERE ` + getVersionFilter(&q, company.ID, company.Version) + ` RETURNING ` + companyColumns
+	updated, err := scanCompany(r.pool.QueryRow(ctx, sql, q.args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repositories.Company{}, r.notMatchedError(ctx, company.ID, company.Version)
+	}
+
+	return updated, handleError(err)
+}
+
+// Delete marks the company as deleted, it is hidden from reads until it is restored or purged
+func (r Companies) Delete(ctx context.Context, id string, version int64) error {
+	if !validID(id) {
+		return repositories.ErrNotFound{}
+	}
+
+	var q sqlBuilder
+	sql := `UPDATE companies SET deleted_at = ` + q.arg(now()) + `, deleted_by = ` + q.arg(reqctx.Actor(ctx)) +
+		`, version = version + 1 WHERE ` + getVersionFilter(&q, id, version)
+	res, err := r.pool.Exec(ctx, sql, q.args...)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return r.notMatchedError(ctx, id, version)
+	}
+
+	return nil
+}
+
+// Restore brings back deleted company, ErrDuplicatedKey is returned if the name has been taken since deletion
+func (r Companies) Restore(ctx context.Context, id string) (repositories.Company, error) {
+	if !validID(id) {
+		return repositories.Company{}, repositories.ErrNotFound{}
+	}
+
+	row := r.pool.QueryRow(ctx, `UPDATE companies
+		SET deleted_at = NULL, deleted_by = '', updated_at = $2, updated_by = $3, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING `+companyColumns,
+		id, now(), reqctx.Actor(ctx))
+	company, err := scanCompany(row)
+	return company, handleError(err)
+}
+
+// Purge permanently removes companies deleted before the given time
+func (r Companies) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	res, err := r.pool.Exec(ctx, `DELETE FROM companies WHERE deleted_at < $1`, deletedBefore)
+	if err != nil {
+		return 0, handleError(err)
+	}
+
+	return res.RowsAffected(), nil
+}
+
+// notMatchedError is called when write matched nothing, for conditional write it finds out
+// if the company has another version or does not exist at all
+func (r Companies) notMatchedError(ctx context.Context, id string, version int64) error {
+	if version == 0 {
+		return repositories.ErrNotFound{}
+	}
+
+	var exists bool
+	err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM companies WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if !exists {
+		return repositories.ErrNotFound{}
+	}
+
+	return repositories.ErrVersionMismatch{}
+}
+
+// sqlBuilder collects arguments of the query and returns their placeholders
+type sqlBuilder struct {
+	args []any
+}
+
+func (b *sqlBuilder) arg(value any) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// getVersionFilter matches the company only if it is not deleted and has expected version, zero version matches any
+func getVersionFilter(q *sqlBuilder, id string, version int64) string {
+	filter := "id = " + q.arg(id) + " AND deleted_at IS NULL"
+	if version != 0 {
+		filter += " AND version = " + q.arg(version)
+	}
+	return filter
+}
+
+// getListFilter returns conditions matching not deleted companies by the filter
+func getListFilter(q *sqlBuilder, filter repositories.CompanyFilter) []string {
+	where := []string{"deleted_at IS NULL"}
+	if filter.Type != "" {
+		where = append(where, "type = "+q.arg(filter.Type))
+	}
+	if filter.Registered != nil {
+		where = append(where, "registered = "+q.arg(*filter.Registered))
+	}
+	if filter.MinEmployees != nil {
+		where = append(where, "amount_of_employees >= "+q.arg(*filter.MinEmployees))
+	}
+	if filter.MaxEmployees != nil {
+		where = append(where, "amount_of_employees <= "+q.arg(*filter.MaxEmployees))
+	}
+	if filter.CreatedAfter != nil {
+		where = append(where, "created_at >= "+q.arg(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		where = append(where, "created_at < "+q.arg(*filter.CreatedBefore))
+	}
+	if filter.CreatedBy != "" {
+		where = append(where, "created_by = "+q.arg(filter.CreatedBy))
+	}
+	if filter.UpdatedAfter != nil {
+		where = append(where, "updated_at >= "+q.arg(*filter.UpdatedAfter))
+	}
+	if filter.UpdatedBefore != nil {
+		where = append(where, "updated_at < "+q.arg(*filter.UpdatedBefore))
+	}
+	if filter.UpdatedBy != "" {
+		where = append(where, "updated_by = "+q.arg(filter.UpdatedBy))
+	}
+
+	return where
+}
+
+// getOrderBy returns requested sorting, id is always the last key to make the order stable
+func getOrderBy(sort []repositories.SortField) (string, error) {
+	orderBy := make([]string, 0, len(sort)+1)
+	for _, s := range sort {
+		if !sortColumns[s.Field] {
+			return "", fmt.Errorf("companies can not be sorted by %s", s.Field)
+		}
+		orderBy = append(orderBy, s.Field+" "+sortDirection(s.Desc))
+	}
+
+	return strings.Join(append(orderBy, "id"), ", "), nil
+}
+
+// getAfterCursorFilter matches companies placed after the cursor in the requested sort order:
+// (s1 > v1) or (s1 = v1 and s2 > v2) or ... or (s1 = v1 and ... and sN = vN and id > id)
+func getAfterCursorFilter(q *sqlBuilder, c repositories.Cursor, sort []repositories.SortField) (string, error) {
+	conditions := make([]string, 0, len(sort)+1)
+	equal := make([]string, 0, len(sort))
+	for _, s := range sort {
+		if !sortColumns[s.Field] {
+			return "", fmt.Errorf("companies can not be sorted by %s", s.Field)
+		}
+
+		value, err := c.Value(s.Field)
+		if err != nil {
+			return "", err
+		}
+
+		placeholder := q.arg(value)
+		conditions = append(conditions, strings.Join(append(equal, s.Field+afterOperator(s.Desc)+placeholder), " AND "))
+		equal = append(equal, s.Field+" = "+placeholder)
+	}
+
+	if !validID(c.ID) {
+		return "", repositories.ErrInvalidCursor{}
+	}
+	conditions = append(conditions, strings.Join(append(equal, "id > "+q.arg(c.ID)), " AND "))
+
+	return "(" + strings.Join(conditions, ") OR (") + ")", nil
+}
+
+func sortDirection(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func afterOperator(desc bool) string {
+	if desc {
+		return " < "
+	}
+	return " > "
+}
+
+// querier is implemented by both pool and transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertCompany(ctx context.Context, q querier, company repositories.Company) (repositories.Company, error) {
+	company.ID = newID()
+	company.Version = 1
+	company.CreatedAt = now()
+	company.CreatedBy = reqctx.Actor(ctx)
+	company.UpdatedAt = company.CreatedAt
+	company.UpdatedBy = company.CreatedBy
+
+	_, err := q.Exec(ctx, `INSERT INTO companies
+		(id, name, description, amount_of_employees, registered, type, version, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		company.ID, company.Name, company.Description, company.AmountOfEmployees, company.Registered, company.Type,
+		company.Version, company.CreatedAt, company.CreatedBy, company.UpdatedAt, company.UpdatedBy)
+	return company, err
+}
+
+// companyFields returns scan destinations in the order of companyColumns
+func companyFields(company *repositories.Company) []any {
+	return []any{
+		&company.ID, &company.Name, &company.Description, &company.AmountOfEmployees, &company.Registered,
+		&company.Type, &company.Version, &company.CreatedAt, &company.CreatedBy, &company.UpdatedAt,
+		&company.UpdatedBy, &company.DeletedAt, &company.DeletedBy,
+	}
+}
+
+func scanCompany(row pgx.Row) (repositories.Company, error) {
+	var company repositories.Company
+	if err := row.Scan(companyFields(&company)...); err != nil {
+		return repositories.Company{}, err
+	}
+
+	normalizeTimes(&company)
+	return company, nil
+}
+
+// normalizeTimes converts times to UTC the same way as other repositories return them
+func normalizeTimes(company *repositories.Company) {
+	company.CreatedAt = company.CreatedAt.UTC()
+	company.UpdatedAt = company.UpdatedAt.UTC()
+	if company.DeletedAt != nil {
+		deletedAt := company.DeletedAt.UTC()
+		company.DeletedAt = &deletedAt
+	}
+}
+
+// newID returns time ordered UUID, so companies and history entries are sorted by creation time the same way
+// as MongoDB ObjectID sorts them
+func newID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// validID reports if id can be stored in uuid column, other ids can not match any row
+func validID(id string) bool {
+	return uuid.Validate(id) == nil
+}
+
+// now returns current time with the precision other repositories store it with
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the PostgreSQL error code of unique constraint violation
+const uniqueViolation = "23505"
+
+func handleError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return repositories.ErrDuplicatedKey{}
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.Join(repositories.ErrNotFound{}, err)
+	}
+
+	return err
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const historyColumns = `id, company_id, action, actor, request_id, recorded_at, changes, snapshot`
+
+type History struct {
+	pool *pgxpool.Pool
+}
+
+func NewHistoryRepository(pool *pgxpool.Pool) *History {
+	return &History{pool: pool}
+}
+
+func (r History) Add(ctx context.Context, entry repositories.HistoryEntry) error {
+	_, err := r.pool.Exec(ctx, `INSERT INTO companies_history (`+historyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		newID(), entry.CompanyID, entry.Action, entry.Actor, entry.RequestID, entry.Timestamp, entry.Changes, entry.Snapshot)
+	return handleError(err)
+}
+
+// List returns history of the company from the oldest entry to the newest one
+func (r History) List(ctx context.Context, query repositories.HistoryQuery) (repositories.HistoryPage, error) {
+	var q sqlBuilder
+	where := "company_id = " + q.arg(query.CompanyID)
+	if query.Cursor != "" {
+		c, err := repositories.DecodeCursor(query.Cursor, nil)
+		if err != nil {
+			return repositories.HistoryPage{}, err
+		}
+
+		if !validID(c.ID) {
+			return repositories.HistoryPage{}, repositories.ErrInvalidCursor{}
+		}
+		where += " AND id > " + q.arg(c.ID)
+	}
+
+	// fetch one extra entry to find out if there is a next page
+	rows, err := r.pool.Query(ctx, `SELECT `+historyColumns+` FROM companies_history WHERE `+where+
+		` ORDER BY id LIMIT `+q.arg(query.Limit+1), q.args...)
+	if err != nil {
+		return repositories.HistoryPage{}, handleError(err)
+	}
+
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repositories.HistoryEntry, error) {
+		return scanHistoryEntry(row)
+	})
+	if err != nil {
+		return repositories.HistoryPage{}, handleError(err)
+	}
+
+	page := repositories.HistoryPage{Entries: entries}
+	if len(entries) > query.Limit {
+		page.Entries = entries[:query.Limit]
+		page.NextCursor = repositories.EncodeCursor(repositories.Cursor{ID: page.Entries[query.Limit-1].ID})
+	}
+
+	return page, nil
+}
+
+// Last returns the latest entry of the company history recorded not later than the given time
+func (r History) Last(ctx context.Context, companyID string, at time.Time) (repositories.HistoryEntry, error) {
+	row := r.pool.QueryRow(ctx, `SELECT `+historyColumns+` FROM companies_history
+		WHERE company_id = $1 AND recorded_at <= $2
+		ORDER BY recorded_at DESC, id DESC
+		LIMIT 1`, companyID, at)
+	entry, err := scanHistoryEntry(row)
+	return entry, handleError(err)
+}
+
+// scanHistoryEntry reads entry, changes and snapshot are stored as JSON documents
+func scanHistoryEntry(row pgx.Row) (repositories.HistoryEntry, error) {
+	var entry repositories.HistoryEntry
+	err := row.Scan(&entry.ID, &entry.CompanyID, &entry.Action, &entry.Actor, &entry.RequestID, &entry.Timestamp, &entry.Changes, &entry.Snapshot)
+	if err != nil {
+		return repositories.HistoryEntry{}, err
+	}
+
+	entry.Timestamp = entry.Timestamp.UTC()
+	if entry.Snapshot != nil {
+		normalizeTimes(entry.Snapshot)
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,56 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/postgres"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	repo := postgres.NewHistoryRepository(testPool)
+
+	t.Run("add and list history", func(t *testing.T) {
+		for _, action := range []string{"create", "update", "delete"} {
+			err := repo.Add(context.Background(), repositories.HistoryEntry{
+				CompanyID: "TestHistory",
+				Action:    action,
+				Actor:     "user",
+				Timestamp: time.Now().UTC().Truncate(time.Millisecond),
+				Changes:   []repositories.FieldChange{{Field: "name", Before: "old", After: "new"}},
+			})
+			require.NoError(t, err)
+		}
+
+		page, err := repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "TestHistory", Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 2)
+		require.Equal(t, "create", page.Entries[0].Action)
+		require.Equal(t, []repositories.FieldChange{{Field: "name", Before: "old", After: "new"}}, page.Entries[0].Changes)
+
+		page, err = repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "TestHistory", Cursor: page.NextCursor, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 1)
+		require.Equal(t, "delete", page.Entries[0].Action)
+	})
+
+	t.Run("last entry", func(t *testing.T) {
+		created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		snapshot := createTestCompany("TestHistoryLast")
+		snapshot.CreatedAt = created
+		err := repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "TestHistoryLast", Action: "create", Timestamp: created, Snapshot: &snapshot})
+		require.NoError(t, err)
+
+		entry, err := repo.Last(context.Background(), "TestHistoryLast", created.Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, "create", entry.Action)
+		require.Equal(t, created, entry.Timestamp)
+		require.Equal(t, snapshot, *entry.Snapshot)
+
+		_, err = repo.Last(context.Background(), "TestHistoryLast", created.Add(-time.Minute))
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+}
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationsLockKey is the advisory lock key which keeps several instances from migrating at the same time
+const migrationsLockKey = 7311286534
+
+// Migrate applies migrations which have not been applied yet, all of them are applied in one transaction
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	slices.Sort(names)
+
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLockKey); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			name       text PRIMARY KEY,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, "SELECT name FROM schema_migrations")
+		if err != nil {
+			return err
+		}
+		applied, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			if slices.Contains(applied, name) {
+				continue
+			}
+
+			sql, err := migrations.ReadFile(name)
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec(ctx, string(sql)); err != nil {
+				return fmt.Errorf("failed to apply migration %s: %w", name, err)
+			}
+
+			if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (name) VALUES ($1)", name); err != nil {
+				return err
+			}
+
+			slog.Info("migration applied", "name", name)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,32 @@
+CREATE TABLE companies (
+    id                  uuid PRIMARY KEY,
+    name                text NOT NULL,
+    description         text NOT NULL DEFAULT '',
+    amount_of_employees integer NOT NULL,
+    registered          boolean NOT NULL,
+    type                text NOT NULL,
+    version             bigint NOT NULL,
+    created_at          timestamptz NOT NULL,
+    created_by          text NOT NULL DEFAULT '',
+    updated_at          timestamptz NOT NULL,
+    updated_by          text NOT NULL DEFAULT '',
+    deleted_at          timestamptz,
+    deleted_by          text NOT NULL DEFAULT '',
+    -- name matches are more relevant than description ones
+    search              tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', name), 'A') || setweight(to_tsvector('english', description), 'D')
+    ) STORED
+);
+
+-- name is unique among not deleted companies, deleted company can be restored only if its name is free
+CREATE UNIQUE INDEX companies_name_key ON companies (name) WHERE deleted_at IS NULL;
+
+CREATE INDEX companies_type_idx ON companies (type);
+CREATE INDEX companies_registered_idx ON companies (registered);
+CREATE INDEX companies_amount_of_employees_idx ON companies (amount_of_employees);
+CREATE INDEX companies_created_at_idx ON companies (created_at);
+CREATE INDEX companies_created_by_idx ON companies (created_by);
+CREATE INDEX companies_updated_at_idx ON companies (updated_at);
+CREATE INDEX companies_updated_by_idx ON companies (updated_by);
+CREATE INDEX companies_deleted_at_idx ON companies (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX companies_search_idx ON companies USING gin (search);
@@ -0,0 +1,13 @@
+CREATE TABLE companies_history (
+    id          uuid PRIMARY KEY,
+    company_id  text NOT NULL,
+    action      text NOT NULL,
+    actor       text NOT NULL DEFAULT '',
+    request_id  text NOT NULL DEFAULT '',
+    recorded_at timestamptz NOT NULL,
+    changes     jsonb,
+    snapshot    jsonb
+);
+
+CREATE INDEX companies_history_company_id_idx ON companies_history (company_id, id);
+CREATE INDEX companies_history_recorded_at_idx ON companies_history (company_id, recorded_at DESC);
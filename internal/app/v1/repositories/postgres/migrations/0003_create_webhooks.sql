@@ -0,0 +1,22 @@
+CREATE TABLE webhook_subscriptions (
+    id         uuid PRIMARY KEY,
+    url        text NOT NULL,
+    secret     text NOT NULL,
+    created_at timestamptz NOT NULL,
+    created_by text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE webhook_deliveries (
+    id              uuid PRIMARY KEY,
+    subscription_id uuid NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id        text NOT NULL,
+    event_type      text NOT NULL,
+    attempt         integer NOT NULL,
+    status_code     integer NOT NULL DEFAULT 0,
+    error           text NOT NULL DEFAULT '',
+    "timestamp"     timestamptz NOT NULL,
+    -- duration of the attempt in nanoseconds
+    duration        bigint NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id, "timestamp" DESC, id DESC);
@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	subscriptionColumns = `id, url, secret, created_at, created_by`
+	deliveryColumns     = `id, subscription_id, event_id, event_type, attempt, status_code, error, "timestamp", duration`
+)
+
+// Webhooks keeps webhook subscriptions and attempts to deliver events to them
+type Webhooks struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhooksRepository(pool *pgxpool.Pool) *Webhooks {
+	return &Webhooks{pool: pool}
+}
+
+func (r Webhooks) AddSubscription(ctx context.Context, subscription repositories.WebhookSubscription) (repositories.WebhookSubscription, error) {
+	subscription.ID = newID()
+	subscription.CreatedAt = now()
+	subscription.CreatedBy = reqctx.Actor(ctx)
+	_, err := r.pool.Exec(ctx, `INSERT INTO webhook_subscriptions (`+subscriptionColumns+`) VALUES ($1, $2, $3, $4, $5)`,
+		subscription.ID, subscription.URL, subscription.Secret, subscription.CreatedAt, subscription.CreatedBy)
+	if err != nil {
+		return repositories.WebhookSubscription{}, handleError(err)
+	}
+
+	return subscription, nil
+}
+
+func (r Webhooks) GetSubscription(ctx context.Context, id string) (repositories.WebhookSubscription, error) {
+	if !validID(id) {
+		return repositories.WebhookSubscription{}, repositories.ErrNotFound{}
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return repositories.WebhookSubscription{}, handleError(err)
+	}
+
+	subscription, err := pgx.CollectExactlyOneRow(rows, scanSubscription)
+	return subscription, handleError(err)
+}
+
+// ListSubscriptions returns all subscriptions from the oldest one to the newest one
+func (r Webhooks) ListSubscriptions(ctx context.Context) ([]repositories.WebhookSubscription, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	subscriptions, err := pgx.CollectRows(rows, scanSubscription)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes the subscription together with its deliveries
+func (r Webhooks) DeleteSubscription(ctx context.Context, id string) error {
+	if !validID(id) {
+		return repositories.ErrNotFound{}
+	}
+
+	res, err := r.pool.Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return repositories.ErrNotFound{}
+	}
+
+	return nil
+}
+
+func (r Webhooks) AddDelivery(ctx context.Context, delivery repositories.WebhookDelivery) error {
+	_, err := r.pool.Exec(ctx, `INSERT INTO webhook_deliveries (`+deliveryColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		newID(), delivery.SubscriptionID, delivery.EventID, delivery.EventType, delivery.Attempt, delivery.StatusCode,
+		delivery.Error, delivery.Timestamp, int64(delivery.Duration))
+	return handleError(err)
+}
+
+// ListDeliveries returns up to limit latest deliveries of the subscription from the newest one to the oldest one
+func (r Webhooks) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]repositories.WebhookDelivery, error) {
+	if !validID(subscriptionID) {
+		return []repositories.WebhookDelivery{}, nil
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE subscription_id = $1
+		ORDER BY "timestamp" DESC, id DESC LIMIT $2`, subscriptionID, limit)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	deliveries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repositories.WebhookDelivery, error) {
+		var delivery repositories.WebhookDelivery
+		var duration int64
+		err := row.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Attempt,
+			&delivery.StatusCode, &delivery.Error, &delivery.Timestamp, &duration)
+		delivery.Timestamp, delivery.Duration = delivery.Timestamp.UTC(), time.Duration(duration)
+		return delivery, err
+	})
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	return deliveries, nil
+}
+
+func scanSubscription(row pgx.CollectableRow) (repositories.WebhookSubscription, error) {
+	var subscription repositories.WebhookSubscription
+	err := row.Scan(&subscription.ID, &subscription.URL, &subscription.Secret, &subscription.CreatedAt, &subscription.CreatedBy)
+	subscription.CreatedAt = subscription.CreatedAt.UTC()
+	return subscription, err
+}
@@ -0,0 +1,15 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/postgres"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
+)
+
+func TestWebhooksContract(t *testing.T) {
+	repotest.RunWebhooksRepository(t, func(t *testing.T) webhook.Store {
+		return postgres.NewWebhooksRepository(testPool)
+	})
+}
@@ -0,0 +1,435 @@
+// Package repotest has the conformance tests every companies repository implementation should pass,
+// so all storages behave the same way for the service
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RunCompaniesRepository runs the contract tests against repositories returned by newRepo. Tests do not rely on
+// the storage being empty, so newRepo can return repositories sharing the same storage
+func RunCompaniesRepository(t *testing.T, newRepo func(t *testing.T) services.CompaniesRepository) {
+	t.Run("create and get", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := reqctx.WithActor(context.Background(), "creator")
+
+		company := NewCompany("create")
+		created, err := repo.Create(ctx, company)
+		require.NoError(t, err)
+		require.NotEmpty(t, created.ID)
+		require.Equal(t, company.Name, created.Name)
+		require.Equal(t, int64(1), created.Version)
+		require.False(t, created.CreatedAt.IsZero())
+		require.Equal(t, created.CreatedAt, created.UpdatedAt)
+		require.Equal(t, "creator", created.CreatedBy)
+		require.Equal(t, "creator", created.UpdatedBy)
+		require.Nil(t, created.DeletedAt)
+
+		res, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, created, res)
+	})
+
+	t.Run("unique names", func(t *testing.T) {
+		repo := newRepo(t)
+
+		company := NewCompany("unique")
+		_, err := repo.Create(context.Background(), company)
+		require.NoError(t, err)
+
+		created, err := repo.Create(context.Background(), company)
+		require.ErrorAs(t, err, &repositories.ErrDuplicatedKey{})
+		require.Empty(t, created)
+
+		other, err := repo.Create(context.Background(), NewCompany("unique"))
+		require.NoError(t, err)
+
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: other.ID, Name: company.Name})
+		require.ErrorAs(t, err, &repositories.ErrDuplicatedKey{})
+	})
+
+	t.Run("create many", func(t *testing.T) {
+		repo := newRepo(t)
+
+		existing, err := repo.Create(context.Background(), NewCompany("many"))
+		require.NoError(t, err)
+
+		first, second := NewCompany("many"), NewCompany("many")
+		created, errs := repo.CreateMany(context.Background(), []repositories.Company{first, existing, second, first})
+		require.Len(t, created, 4)
+		require.Len(t, errs, 4)
+		require.NoError(t, errs[0])
+		require.ErrorAs(t, errs[1], &repositories.ErrDuplicatedKey{})
+		require.NoError(t, errs[2])
+		require.ErrorAs(t, errs[3], &repositories.ErrDuplicatedKey{})
+		require.Empty(t, created[1])
+		require.Empty(t, created[3])
+
+		for _, i := range []int{0, 2} {
+			res, err := repo.Get(context.Background(), created[i].ID)
+			require.NoError(t, err)
+			require.Equal(t, created[i], res)
+		}
+	})
+
+	t.Run("upsert by name", func(t *testing.T) {
+		repo := newRepo(t)
+
+		company := NewCompany("upsert")
+		created, previous, err := repo.UpsertByName(reqctx.WithActor(context.Background(), "creator"), company)
+		require.NoError(t, err)
+		require.Nil(t, previous)
+		require.Equal(t, int64(1), created.Version)
+
+		company.AmountOfEmployees = 99
+		updated, previous, err := repo.UpsertByName(reqctx.WithActor(context.Background(), "updater"), company)
+		require.NoError(t, err)
+		require.Equal(t, created, *previous)
+		require.Equal(t, created.ID, updated.ID)
+		require.Equal(t, int64(2), updated.Version)
+		require.Equal(t, 99, updated.AmountOfEmployees)
+		require.Equal(t, "creator", updated.CreatedBy)
+		require.Equal(t, "updater", updated.UpdatedBy)
+
+		res, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, updated, res)
+	})
+
+	t.Run("full update", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(context.Background(), NewCompany("full-update"))
+		require.NoError(t, err)
+
+		name := NewCompany("full-update").Name
+		description := ""
+		registered := false
+		updated, err := repo.Update(reqctx.WithActor(context.Background(), "updater"), repositories.CompanyUpdate{
+			ID:                created.ID,
+			Name:              name,
+			Description:       &description,
+			AmountOfEmployees: 200,
+			Registered:        &registered,
+			Type:              "NonProfit",
+		})
+		require.NoError(t, err)
+		require.Equal(t, name, updated.Name)
+		require.Empty(t, updated.Description)
+		require.Equal(t, 200, updated.AmountOfEmployees)
+		require.False(t, updated.Registered)
+		require.Equal(t, "NonProfit", updated.Type)
+		require.Equal(t, int64(2), updated.Version)
+		require.Equal(t, created.CreatedAt, updated.CreatedAt)
+		require.Equal(t, created.CreatedBy, updated.CreatedBy)
+		require.False(t, updated.UpdatedAt.Before(created.UpdatedAt))
+		require.Equal(t, "updater", updated.UpdatedBy)
+
+		res, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, updated, res)
+	})
+
+	t.Run("partial update", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(context.Background(), NewCompany("partial-update"))
+		require.NoError(t, err)
+
+		// empty values and nil pointers keep the stored values
+		updated, err := repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit"})
+		require.NoError(t, err)
+		require.Equal(t, created.Name, updated.Name)
+		require.Equal(t, created.Description, updated.Description)
+		require.Equal(t, created.AmountOfEmployees, updated.AmountOfEmployees)
+		require.Equal(t, created.Registered, updated.Registered)
+		require.Equal(t, "NonProfit", updated.Type)
+		require.Equal(t, int64(2), updated.Version)
+
+		description := "new description"
+		updated, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Description: &description})
+		require.NoError(t, err)
+		require.Equal(t, created.Name, updated.Name)
+		require.Equal(t, "new description", updated.Description)
+		require.Equal(t, created.Registered, updated.Registered)
+		require.Equal(t, "NonProfit", updated.Type)
+		require.Equal(t, int64(3), updated.Version)
+
+		res, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, updated, res)
+	})
+
+	t.Run("update with expected version", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(context.Background(), NewCompany("update-version"))
+		require.NoError(t, err)
+
+		updated, err := repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit", Version: created.Version})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), updated.Version)
+
+		// version has moved on
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "Cooperative", Version: created.Version})
+		require.ErrorAs(t, err, &repositories.ErrVersionMismatch{})
+
+		res, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, updated, res)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(context.Background(), NewCompany("delete"))
+		require.NoError(t, err)
+
+		err = repo.Delete(context.Background(), created.ID, created.Version+1)
+		require.ErrorAs(t, err, &repositories.ErrVersionMismatch{})
+
+		require.NoError(t, repo.Delete(reqctx.WithActor(context.Background(), "deleter"), created.ID, created.Version))
+
+		// deleted company is not found by any operation but restore
+		_, err = repo.Get(context.Background(), created.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: created.ID, Type: "NonProfit"})
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		err = repo.Delete(context.Background(), created.ID, 0)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		// name of the deleted company can be used again
+		_, err = repo.Create(context.Background(), repositories.Company{
+			Name:              created.Name,
+			AmountOfEmployees: 1,
+			Type:              "Corporations",
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(context.Background(), NewCompany("restore"))
+		require.NoError(t, err)
+
+		_, err = repo.Restore(context.Background(), created.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		require.NoError(t, repo.Delete(context.Background(), created.ID, 0))
+
+		restored, err := repo.Restore(reqctx.WithActor(context.Background(), "restorer"), created.ID)
+		require.NoError(t, err)
+		require.Nil(t, restored.DeletedAt)
+		require.Empty(t, restored.DeletedBy)
+		require.Equal(t, int64(3), restored.Version)
+		require.Equal(t, "restorer", restored.UpdatedBy)
+
+		res, err := repo.Get(context.Background(), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, restored, res)
+
+		// company can not be restored while its name is taken
+		require.NoError(t, repo.Delete(context.Background(), created.ID, 0))
+		taken := NewCompany("restore")
+		taken.Name = created.Name
+		_, err = repo.Create(context.Background(), taken)
+		require.NoError(t, err)
+
+		_, err = repo.Restore(context.Background(), created.ID)
+		require.ErrorAs(t, err, &repositories.ErrDuplicatedKey{})
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		repo := newRepo(t)
+
+		active, err := repo.Create(context.Background(), NewCompany("purge"))
+		require.NoError(t, err)
+
+		deleted, err := repo.Create(context.Background(), NewCompany("purge"))
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(context.Background(), deleted.ID, 0))
+
+		// the storage can have other deleted companies, so only the lower bound is known
+		purged, err := repo.Purge(context.Background(), time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, purged, int64(1))
+
+		_, err = repo.Restore(context.Background(), deleted.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		_, err = repo.Get(context.Background(), active.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		repo := newRepo(t)
+
+		// companies of the test are found by the unique creator, the storage can have other companies
+		actor := NewCompany("actor").Name
+		ctx := reqctx.WithActor(context.Background(), actor)
+		for _, employees := range []int{20, 10, 30} {
+			company := NewCompany("list")
+			company.AmountOfEmployees = employees
+			_, err := repo.Create(ctx, company)
+			require.NoError(t, err)
+		}
+
+		query := repositories.ListQuery{
+			Limit:  2,
+			Filter: repositories.CompanyFilter{CreatedBy: actor},
+			Sort:   []repositories.SortField{{Field: "amount_of_employees", Desc: true}},
+		}
+		page, err := repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Len(t, page.Companies, 2)
+		require.Equal(t, 30, page.Companies[0].AmountOfEmployees)
+		require.Equal(t, 20, page.Companies[1].AmountOfEmployees)
+		require.NotEmpty(t, page.NextCursor)
+
+		query.Cursor = page.NextCursor
+		page, err = repo.List(context.Background(), query)
+		require.NoError(t, err)
+		require.Len(t, page.Companies, 1)
+		require.Equal(t, 10, page.Companies[0].AmountOfEmployees)
+		require.Empty(t, page.NextCursor)
+
+		_, err = repo.List(context.Background(), repositories.ListQuery{Cursor: "not a cursor", Limit: 2})
+		require.ErrorAs(t, err, &repositories.ErrInvalidCursor{})
+	})
+
+	t.Run("list sorted by actor of companies without actor", func(t *testing.T) {
+		repo := newRepo(t)
+
+		// companies of the test are found by the unique type
+		companyType := NewCompany("type").Name
+		var created []string
+		for range 3 {
+			company := NewCompany("no-actor")
+			company.Type = companyType
+			res, err := repo.Create(context.Background(), company)
+			require.NoError(t, err)
+			created = append(created, res.ID)
+		}
+
+		for _, field := range []string{"created_by", "updated_by"} {
+			query := repositories.ListQuery{
+				Limit:  1,
+				Filter: repositories.CompanyFilter{Type: companyType},
+				Sort:   []repositories.SortField{{Field: field}},
+			}
+
+			var listed []string
+			for {
+				page, err := repo.List(context.Background(), query)
+				require.NoError(t, err)
+				for _, company := range page.Companies {
+					listed = append(listed, company.ID)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			require.ElementsMatch(t, created, listed, field)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		repo := newRepo(t)
+
+		word := "zz" + primitive.NewObjectID().Hex()
+		inName := NewCompany(word)
+		_, err := repo.Create(context.Background(), inName)
+		require.NoError(t, err)
+
+		inDescription := NewCompany("search")
+		inDescription.Description = "company " + word
+		_, err = repo.Create(context.Background(), inDescription)
+		require.NoError(t, err)
+
+		results, err := repo.Search(context.Background(), repositories.SearchQuery{Text: word, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, inName.Name, results[0].Name)
+		require.Equal(t, inDescription.Name, results[1].Name)
+		require.Greater(t, results[0].Score, results[1].Score)
+	})
+
+	t.Run("export", func(t *testing.T) {
+		repo := newRepo(t)
+
+		actor := NewCompany("actor").Name
+		ctx := reqctx.WithActor(context.Background(), actor)
+		first, err := repo.Create(ctx, NewCompany("export"))
+		require.NoError(t, err)
+		second, err := repo.Create(ctx, NewCompany("export"))
+		require.NoError(t, err)
+		deleted, err := repo.Create(ctx, NewCompany("export"))
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(context.Background(), deleted.ID, 0))
+
+		var exported []repositories.Company
+		err = repo.Export(context.Background(), repositories.CompanyFilter{CreatedBy: actor}, func(company repositories.Company) error {
+			exported = append(exported, company)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []repositories.Company{first, second}, exported)
+
+		// iteration stops on the first error
+		count := 0
+		err = repo.Export(context.Background(), repositories.CompanyFilter{CreatedBy: actor}, func(repositories.Company) error {
+			count++
+			return errors.New("stop")
+		})
+		require.EqualError(t, err, "stop")
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo := newRepo(t)
+
+		id := primitive.NewObjectID().Hex()
+		_, err := repo.Get(context.Background(), id)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: id, Type: "NonProfit"})
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		// missing company is not found whatever version is expected
+		_, err = repo.Update(context.Background(), repositories.CompanyUpdate{ID: id, Type: "NonProfit", Version: 1})
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		err = repo.Delete(context.Background(), id, 0)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		err = repo.Delete(context.Background(), id, 1)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		_, err = repo.Restore(context.Background(), id)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+}
+
+// NewCompany returns valid company with unique name starting with the prefix
+func NewCompany(prefix string) repositories.Company {
+	return repositories.Company{
+		Name:              prefix + "-" + primitive.NewObjectID().Hex(),
+		Description:       "description",
+		AmountOfEmployees: 10,
+		Registered:        true,
+		Type:              "Corporations",
+	}
+}
@@ -0,0 +1,138 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RunWebhooksRepository runs the contract tests against webhook stores returned by newRepo,
+// the same way as RunCompaniesRepository
+func RunWebhooksRepository(t *testing.T, newRepo func(t *testing.T) webhook.Store) {
+	t.Run("add and get subscription", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := reqctx.WithActor(context.Background(), "subscriber")
+
+		added, err := repo.AddSubscription(ctx, repositories.WebhookSubscription{URL: "http://localhost/hook", Secret: "secret"})
+		require.NoError(t, err)
+		require.NotEmpty(t, added.ID)
+		require.Equal(t, "http://localhost/hook", added.URL)
+		require.Equal(t, "secret", added.Secret)
+		require.False(t, added.CreatedAt.IsZero())
+		require.Equal(t, "subscriber", added.CreatedBy)
+
+		res, err := repo.GetSubscription(context.Background(), added.ID)
+		require.NoError(t, err)
+		require.Equal(t, added, res)
+	})
+
+	t.Run("list subscriptions", func(t *testing.T) {
+		repo := newRepo(t)
+
+		first, err := repo.AddSubscription(context.Background(), repositories.WebhookSubscription{URL: "http://localhost/first"})
+		require.NoError(t, err)
+		second, err := repo.AddSubscription(context.Background(), repositories.WebhookSubscription{URL: "http://localhost/second"})
+		require.NoError(t, err)
+
+		res, err := repo.ListSubscriptions(context.Background())
+		require.NoError(t, err)
+		i, j := slices.Index(res, first), slices.Index(res, second)
+		require.GreaterOrEqual(t, i, 0)
+		require.Greater(t, j, i)
+	})
+
+	t.Run("deliveries", func(t *testing.T) {
+		repo := newRepo(t)
+
+		subscription, err := repo.AddSubscription(context.Background(), repositories.WebhookSubscription{URL: "http://localhost/deliveries"})
+		require.NoError(t, err)
+		other, err := repo.AddSubscription(context.Background(), repositories.WebhookSubscription{URL: "http://localhost/other"})
+		require.NoError(t, err)
+
+		at := time.Now().UTC().Truncate(time.Millisecond)
+		for attempt := 1; attempt <= 3; attempt++ {
+			require.NoError(t, repo.AddDelivery(context.Background(), repositories.WebhookDelivery{
+				SubscriptionID: subscription.ID,
+				EventID:        "event",
+				EventType:      repositories.EventCompanyCreated,
+				Attempt:        attempt,
+				StatusCode:     500,
+				Error:          "unexpected response status: 500 Internal Server Error",
+				Timestamp:      at.Add(time.Duration(attempt) * time.Second),
+				Duration:       time.Duration(attempt) * time.Millisecond,
+			}))
+		}
+		require.NoError(t, repo.AddDelivery(context.Background(), repositories.WebhookDelivery{
+			SubscriptionID: other.ID, EventID: "event", EventType: repositories.EventCompanyCreated, Attempt: 1, StatusCode: 200, Timestamp: at,
+		}))
+
+		// the newest deliveries go first
+		res, err := repo.ListDeliveries(context.Background(), subscription.ID, 2)
+		require.NoError(t, err)
+		require.Len(t, res, 2)
+		require.Equal(t, 3, res[0].Attempt)
+		require.Equal(t, 2, res[1].Attempt)
+		require.NotEmpty(t, res[0].ID)
+		require.Equal(t, subscription.ID, res[0].SubscriptionID)
+		require.Equal(t, "event", res[0].EventID)
+		require.Equal(t, repositories.EventCompanyCreated, res[0].EventType)
+		require.Equal(t, 500, res[0].StatusCode)
+		require.Equal(t, "unexpected response status: 500 Internal Server Error", res[0].Error)
+		require.Equal(t, at.Add(3*time.Second), res[0].Timestamp)
+		require.Equal(t, 3*time.Millisecond, res[0].Duration)
+
+		res, err = repo.ListDeliveries(context.Background(), other.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		require.Empty(t, res[0].Error)
+	})
+
+	t.Run("delete subscription", func(t *testing.T) {
+		repo := newRepo(t)
+
+		subscription, err := repo.AddSubscription(context.Background(), repositories.WebhookSubscription{URL: "http://localhost/delete"})
+		require.NoError(t, err)
+		require.NoError(t, repo.AddDelivery(context.Background(), repositories.WebhookDelivery{
+			SubscriptionID: subscription.ID, EventID: "event", EventType: repositories.EventCompanyDeleted, Attempt: 1, Timestamp: time.Now(),
+		}))
+
+		require.NoError(t, repo.DeleteSubscription(context.Background(), subscription.ID))
+
+		_, err = repo.GetSubscription(context.Background(), subscription.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+		res, err := repo.ListSubscriptions(context.Background())
+		require.NoError(t, err)
+		require.NotContains(t, res, subscription)
+
+		deliveries, err := repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Empty(t, deliveries)
+
+		err = repo.DeleteSubscription(context.Background(), subscription.ID)
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
+	t.Run("subscription not found", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, id := range []string{primitive.NewObjectID().Hex(), "00000000-0000-7000-8000-000000000000", "invalid"} {
+			_, err := repo.GetSubscription(context.Background(), id)
+			require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+			err = repo.DeleteSubscription(context.Background(), id)
+			require.ErrorAs(t, err, &repositories.ErrNotFound{})
+
+			deliveries, err := repo.ListDeliveries(context.Background(), id, 10)
+			require.NoError(t, err)
+			require.Empty(t, deliveries)
+		}
+	})
+}
@@ -0,0 +1,557 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	companyColumns = `id, name, description, amount_of_employees, registered, type, version,
+	created_at, created_by, updated_at, updated_by, deleted_at, deleted_by`
+
+	// search weights are the same as weights of MongoDB text index
+	nameSearchWeight        = 10.0
+	descriptionSearchWeight = 1.0
+)
+
+// sortColumns are columns companies can be sorted by, sort fields are named after them
+var sortColumns = map[string]bool{
+	"name":                true,
+	"amount_of_employees": true,
+	"registered":          true,
+	"type":                true,
+	"created_at":          true,
+	"created_by":          true,
+	"updated_at":          true,
+	"updated_by":          true,
+}
+
+type Companies struct {
+	db *sql.DB
+}
+
+func NewCompaniesRepository(db *sql.DB) *Companies {
+	return &Companies{db: db}
+}
+
+func (r Companies) Create(ctx context.Context, company repositories.Company) (repositories.Company, error) {
+	company, err := insertCompany(ctx, r.db, company, now(), reqctx.Actor(ctx))
+	if err != nil {
+		return repositories.Company{}, handleError(err)
+	}
+	return company, nil
+}
+
+// CreateMany inserts companies in one transaction, failed insert does not stop the others.
+// Result is returned for every company in the same order, nil error means the company has been created
+func (r Companies) CreateMany(ctx context.Context, companies []repositories.Company) ([]repositories.Company, []error) {
+	created := make([]repositories.Company, len(companies))
+	errs := make([]error, len(companies))
+	if len(companies) == 0 {
+		return created, errs
+	}
+
+	failed := func(err error) ([]repositories.Company, []error) {
+		for i := range errs {
+			created[i], errs[i] = repositories.Company{}, handleError(err)
+		}
+		return created, errs
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return failed(err)
+	}
+	defer tx.Rollback() //nolint errcheck
+
+	createdAt, actor := now(), reqctx.Actor(ctx)
+	for i, company := range companies {
+		// constraint violation fails only the statement, not the whole transaction
+		created[i], errs[i] = insertCompany(ctx, tx, company, createdAt, actor)
+		if errs[i] != nil {
+			created[i], errs[i] = repositories.Company{}, handleError(errs[i])
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return failed(err)
+	}
+
+	return created, errs
+}
+
+// UpsertByName creates the company or replaces fields of not deleted company with the same name.
+// Previous state of the company is returned if it has been updated, nil means the company has been created
+func (r Companies) UpsertByName(ctx context.Context, company repositories.Company) (repositories.Company, *repositories.Company, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return repositories.Company{}, nil, handleError(err)
+	}
+	defer tx.Rollback() //nolint errcheck
+
+	at, actor := now(), reqctx.Actor(ctx)
+	var res repositories.Company
+	var previous *repositories.Company
+
+	existing, err := scanCompany(tx.QueryRowContext(ctx, `SELECT `+companyColumns+` FROM companies WHERE name = ? AND deleted_at IS NULL`, company.Name))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		res, err = insertCompany(ctx, tx, company, at, actor)
+	case err == nil:
+		previous = &existing
+		res, err = scanCompany(tx.QueryRowContext(ctx, `UPDATE companies
+			SET description = ?, amount_of_employees = ?, registered = ?, type = ?, updated_at = ?, updated_by = ?, version = version + 1
+			WHERE id = ?
+			RETURNING `+companyColumns,
+			company.Description, company.AmountOfEmployees, company.Registered, company.Type, at.UnixMilli(), actor, existing.ID))
+	}
+	if err != nil {
+		return repositories.Company{}, nil, handleError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return repositories.Company{}, nil, handleError(err)
+	}
+
+	return res, previous, nil
+}
+
+func (r Companies) Get(ctx context.Context, id string) (repositories.Company, error) {
+	company, err := scanCompany(r.db.QueryRowContext(ctx, `SELECT `+companyColumns+` FROM companies WHERE id = ? AND deleted_at IS NULL`, id))
+	return company, handleError(err)
+}
+
+func (r Companies) List(ctx context.Context, query repositories.ListQuery) (repositories.CompaniesPage, error) {
+	where, args := getListFilter(query.Filter)
+	if query.Cursor != "" {
+		c, err := repositories.DecodeCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return repositories.CompaniesPage{}, err
+		}
+
+		after, afterArgs, err := getAfterCursorFilter(c, query.Sort)
+		if err != nil {
+			return repositories.CompaniesPage{}, err
+		}
+		where = append(where, after)
+		args = append(args, afterArgs...)
+	}
+
+	orderBy, err := getOrderBy(query.Sort)
+	if err != nil {
+		return repositories.CompaniesPage{}, err
+	}
+
+	// fetch one extra row to find out if there is a next page
+	rows, err := r.db.QueryContext(ctx, `SELECT `+companyColumns+` FROM companies WHERE `+strings.Join(where, " AND ")+
+		` ORDER BY `+orderBy+` LIMIT ?`, append(args, query.Limit+1)...)
+	if err != nil {
+		return repositories.CompaniesPage{}, handleError(err)
+	}
+	defer rows.Close()
+
+	companies := make([]repositories.Company, 0, query.Limit+1)
+	for rows.Next() {
+		company, err := scanCompany(rows)
+		if err != nil {
+			return repositories.CompaniesPage{}, handleError(err)
+		}
+		companies = append(companies, company)
+	}
+	if err := rows.Err(); err != nil {
+		return repositories.CompaniesPage{}, handleError(err)
+	}
+
+	page := repositories.CompaniesPage{Companies: companies}
+	if len(companies) > query.Limit {
+		page.Companies = companies[:query.Limit]
+		page.NextCursor = repositories.EncodeCursor(repositories.NewCursor(page.Companies[query.Limit-1], query.Sort))
+	}
+
+	return page, nil
+}
+
+// Export iterates over all companies matching the filter in id order without loading them into memory,
+// iteration stops on the first error returned by fn
+func (r Companies) Export(ctx context.Context, filter repositories.CompanyFilter, fn func(repositories.Company) error) error {
+	where, args := getListFilter(filter)
+	rows, err := r.db.QueryContext(ctx, `SELECT `+companyColumns+` FROM companies WHERE `+strings.Join(where, " AND ")+` ORDER BY id`, args...)
+	if err != nil {
+		return handleError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		company, err := scanCompany(rows)
+		if err != nil {
+			return handleError(err)
+		}
+
+		if err := fn(company); err != nil {
+			return err
+		}
+	}
+
+	return handleError(rows.Err())
+}
+
+// Search uses full text index, any word of the query matches and '-' prefixed words exclude companies.
+// Name matches are more relevant than description ones the same way as in MongoDB text index
+func (r Companies) Search(ctx context.Context, query repositories.SearchQuery) ([]repositories.SearchResult, error) {
+	results := make([]repositories.SearchResult, 0, query.Limit)
+	match := matchQuery(query.Text)
+	if match == "" {
+		return results, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+companyColumns+`, score FROM companies
+		JOIN (
+			SELECT rowid, -bm25(companies_fts, ?, ?) AS score FROM companies_fts WHERE companies_fts MATCH ?
+		) AS matched ON companies.seq = matched.rowid
+		WHERE deleted_at IS NULL
+		ORDER BY score DESC, id
+		LIMIT ?`, nameSearchWeight, descriptionSearchWeight, match, query.Limit)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result repositories.SearchResult
+		var scanned scannedCompany
+		if err := rows.Scan(append(scanned.fields(), &result.Score)...); err != nil {
+			return nil, handleError(err)
+		}
+
+		result.Company = scanned.company()
+		results = append(results, result)
+	}
+
+	return results, handleError(rows.Err())
+}
+
+// Update applies non empty fields of the update and returns updated company
+func (r Companies) Update(ctx context.Context, company repositories.CompanyUpdate) (repositories.Company, error) {
+	set := []string{"updated_at = ?", "updated_by = ?", "version = version + 1"}
+	args := []any{now().UnixMilli(), reqctx.Actor(ctx)}
+	if company.Name != "" {
+		set, args = append(set, "name = ?"), append(args, company.Name)
+	}
+	if company.Description != nil {
+		set, args = append(set, "description = ?"), append(args, *company.Description)
+	}
+	if company.AmountOfEmployees != 0 {
+		set, args = append(set, "amount_of_employees = ?"), append(args, company.AmountOfEmployees)
+	}
+	if company.Registered != nil {
+		set, args = append(set, "registered = ?"), append(args, *company.Registered)
+	}
+	if company.Type != "" {
+		set, args = append(set, "type = ?"), append(args, company.Type)
+	}
+
+	where, whereArgs := getVersionFilter(company.ID, company.Version)
+	row := r.db.QueryRowContext(ctx, `UPDATE companies SET `+strings.Join(set, ", ")+` WHERE `+where+` RETURNING `+companyColumns,
+		append(args, whereArgs...)...)
+	updated, err := scanCompany(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repositories.Company{}, r.notMatchedError(ctx, company.ID, company.Version)
+	}
+
+	return updated, handleError(err)
+}
+
+// Delete marks the company as deleted, it is hidden from reads until it is restored or purged
+func (r Companies) Delete(ctx context.Context, id string, version int64) error {
+	where, args := getVersionFilter(id, version)
+	res, err := r.db.ExecContext(ctx, `UPDATE companies SET deleted_at = ?, deleted_by = ?, version = version + 1 WHERE `+where,
+		append([]any{now().UnixMilli(), reqctx.Actor(ctx)}, args...)...)
+	if err != nil {
+		return handleError(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return handleError(err)
+	}
+
+	if affected == 0 {
+		return r.notMatchedError(ctx, id, version)
+	}
+
+	return nil
+}
+
+// Restore brings back deleted company, ErrDuplicatedKey is returned if the name has been taken since deletion
+func (r Companies) Restore(ctx context.Context, id string) (repositories.Company, error) {
+	row := r.db.QueryRowContext(ctx, `UPDATE companies
+		SET deleted_at = NULL, deleted_by = '', updated_at = ?, updated_by = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NOT NULL
+		RETURNING `+companyColumns,
+		now().UnixMilli(), reqctx.Actor(ctx), id)
+	company, err := scanCompany(row)
+	return company, handleError(err)
+}
+
+// Purge permanently removes companies deleted before the given time
+func (r Companies) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM companies WHERE deleted_at < ?`, deletedBefore.UnixMilli())
+	if err != nil {
+		return 0, handleError(err)
+	}
+
+	return res.RowsAffected()
+}
+
+// notMatchedError is called when write matched nothing, for conditional write it finds out
+// if the company has another version or does not exist at all
+func (r Companies) notMatchedError(ctx context.Context, id string, version int64) error {
+	if version == 0 {
+		return repositories.ErrNotFound{}
+	}
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM companies WHERE id = ? AND deleted_at IS NULL)`, id).Scan(&exists)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if !exists {
+		return repositories.ErrNotFound{}
+	}
+
+	return repositories.ErrVersionMismatch{}
+}
+
+// execer is implemented by both database and transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertCompany(ctx context.Context, db execer, company repositories.Company, at time.Time, actor string) (repositories.Company, error) {
+	company.ID = primitive.NewObjectID().Hex()
+	company.Version = 1
+	company.CreatedAt, company.CreatedBy = at, actor
+	company.UpdatedAt, company.UpdatedBy = at, actor
+	company.DeletedAt, company.DeletedBy = nil, ""
+
+	_, err := db.ExecContext(ctx, `INSERT INTO companies
+		(id, name, description, amount_of_employees, registered, type, version, created_at, created_by, updated_at, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		company.ID, company.Name, company.Description, company.AmountOfEmployees, company.Registered, company.Type,
+		company.Version, at.UnixMilli(), actor, at.UnixMilli(), actor)
+	if err != nil {
+		return repositories.Company{}, err
+	}
+
+	return company, nil
+}
+
+// getVersionFilter matches the company only if it is not deleted and has expected version, zero version matches any
+func getVersionFilter(id string, version int64) (string, []any) {
+	if version == 0 {
+		return "id = ? AND deleted_at IS NULL", []any{id}
+	}
+	return "id = ? AND deleted_at IS NULL AND version = ?", []any{id, version}
+}
+
+// getListFilter returns conditions matching not deleted companies by the filter
+func getListFilter(filter repositories.CompanyFilter) ([]string, []any) {
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	add := func(condition string, arg any) {
+		where, args = append(where, condition), append(args, arg)
+	}
+
+	if filter.Type != "" {
+		add("type = ?", filter.Type)
+	}
+	if filter.Registered != nil {
+		add("registered = ?", *filter.Registered)
+	}
+	if filter.MinEmployees != nil {
+		add("amount_of_employees >= ?", *filter.MinEmployees)
+	}
+	if filter.MaxEmployees != nil {
+		add("amount_of_employees <= ?", *filter.MaxEmployees)
+	}
+	if filter.CreatedAfter != nil {
+		add("created_at >= ?", filter.CreatedAfter.UnixMilli())
+	}
+	if filter.CreatedBefore != nil {
+		add("created_at < ?", filter.CreatedBefore.UnixMilli())
+	}
+	if filter.CreatedBy != "" {
+		add("created_by = ?", filter.CreatedBy)
+	}
+	if filter.UpdatedAfter != nil {
+		add("updated_at >= ?", filter.UpdatedAfter.UnixMilli())
+	}
+	if filter.UpdatedBefore != nil {
+		add("updated_at < ?", filter.UpdatedBefore.UnixMilli())
+	}
+	if filter.UpdatedBy != "" {
+		add("updated_by = ?", filter.UpdatedBy)
+	}
+
+	return where, args
+}
+
+// getOrderBy returns requested sorting, id is always the last key to make the order stable
+func getOrderBy(sort []repositories.SortField) (string, error) {
+	orderBy := make([]string, 0, len(sort)+1)
+	for _, s := range sort {
+		if !sortColumns[s.Field] {
+			return "", fmt.Errorf("companies can not be sorted by %s", s.Field)
+		}
+		orderBy = append(orderBy, s.Field+" "+sortDirection(s.Desc))
+	}
+
+	return strings.Join(append(orderBy, "id"), ", "), nil
+}
+
+// getAfterCursorFilter matches companies placed after the cursor in the requested sort order:
+// (s1 > v1) or (s1 = v1 and s2 > v2) or ... or (s1 = v1 and ... and sN = vN and id > id)
+func getAfterCursorFilter(c repositories.Cursor, sort []repositories.SortField) (string, []any, error) {
+	var conditions []string
+	var args, equalArgs []any
+	var equal []string
+	for _, s := range sort {
+		if !sortColumns[s.Field] {
+			return "", nil, fmt.Errorf("companies can not be sorted by %s", s.Field)
+		}
+
+		value, err := c.Value(s.Field)
+		if err != nil {
+			return "", nil, err
+		}
+		value = columnValue(value)
+
+		conditions = append(conditions, strings.Join(append(equal, s.Field+afterOperator(s.Desc)+"?"), " AND "))
+		args = append(append(args, equalArgs...), value)
+
+		equal = append(equal, s.Field+" = ?")
+		equalArgs = append(equalArgs, value)
+	}
+
+	conditions = append(conditions, strings.Join(append(equal, "id > ?"), " AND "))
+	args = append(append(args, equalArgs...), c.ID)
+
+	return "(" + strings.Join(conditions, ") OR (") + ")", args, nil
+}
+
+// columnValue converts sort value to the form it is stored in the column
+func columnValue(value any) any {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UnixMilli()
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	default:
+		return value
+	}
+}
+
+func sortDirection(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func afterOperator(desc bool) string {
+	if desc {
+		return " < "
+	}
+	return " > "
+}
+
+// matchQuery converts search query to full text query: words are quoted so they can not be taken
+// for query syntax, empty query is returned if there is nothing to search
+func matchQuery(text string) string {
+	var include, exclude []string
+	for _, field := range strings.Fields(text) {
+		excluded := strings.HasPrefix(field, "-")
+		for _, word := range strings.FieldsFunc(strings.ToLower(field), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}) {
+			if excluded {
+				exclude = append(exclude, `"`+word+`"`)
+			} else {
+				include = append(include, `"`+word+`"`)
+			}
+		}
+	}
+
+	if len(include) == 0 {
+		return ""
+	}
+
+	match := "(" + strings.Join(include, " OR ") + ")"
+	for _, word := range exclude {
+		match += " NOT " + word
+	}
+	return match
+}
+
+// scannedCompany keeps company columns in the form they are stored
+type scannedCompany struct {
+	values    repositories.Company
+	createdAt int64
+	updatedAt int64
+	deletedAt sql.NullInt64
+}
+
+// fields returns scan destinations in the order of companyColumns
+func (s *scannedCompany) fields() []any {
+	c := &s.values
+	return []any{
+		&c.ID, &c.Name, &c.Description, &c.AmountOfEmployees, &c.Registered, &c.Type, &c.Version,
+		&s.createdAt, &c.CreatedBy, &s.updatedAt, &c.UpdatedBy, &s.deletedAt, &c.DeletedBy,
+	}
+}
+
+func (s *scannedCompany) company() repositories.Company {
+	company := s.values
+	company.CreatedAt = fromUnixMilli(s.createdAt)
+	company.UpdatedAt = fromUnixMilli(s.updatedAt)
+	if s.deletedAt.Valid {
+		deletedAt := fromUnixMilli(s.deletedAt.Int64)
+		company.DeletedAt = &deletedAt
+	}
+	return company
+}
+
+// scanner is implemented by both row and rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCompany(row scanner) (repositories.Company, error) {
+	var scanned scannedCompany
+	if err := row.Scan(scanned.fields()...); err != nil {
+		return repositories.Company{}, err
+	}
+	return scanned.company(), nil
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
+
+// now returns current time with the precision other repositories store it with
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
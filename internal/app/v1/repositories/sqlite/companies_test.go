@@ -0,0 +1,93 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/sqlite"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompaniesContract(t *testing.T) {
+	db := openTestDB(t)
+	repotest.RunCompaniesRepository(t, func(t *testing.T) services.CompaniesRepository {
+		return sqlite.NewCompaniesRepository(db)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+
+	// migrations which have been applied are skipped
+	require.NoError(t, sqlite.Migrate(context.Background(), db))
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	repo := sqlite.NewCompaniesRepository(openTestDB(t))
+	company := repotest.NewCompany("concurrent")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = repo.Create(context.Background(), company)
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		require.ErrorAs(t, err, &repositories.ErrDuplicatedKey{})
+	}
+	require.Equal(t, 1, created)
+}
+
+func TestSearchQuery(t *testing.T) {
+	repo := sqlite.NewCompaniesRepository(openTestDB(t))
+
+	solar := repotest.NewCompany("Solar")
+	solar.Description = "solar energy"
+	_, err := repo.Create(context.Background(), solar)
+	require.NoError(t, err)
+
+	panels := repotest.NewCompany("Panels")
+	panels.Description = `solar "panels" AND NOT`
+	_, err = repo.Create(context.Background(), panels)
+	require.NoError(t, err)
+
+	results, err := repo.Search(context.Background(), repositories.SearchQuery{Text: `solar -"panels"`, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, solar.Name, results[0].Name)
+
+	// full text query syntax is not interpreted
+	results, err = repo.Search(context.Background(), repositories.SearchQuery{Text: `AND NOT (`, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, panels.Name, results[0].Name)
+
+	results, err = repo.Search(context.Background(), repositories.SearchQuery{Text: "-solar", Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "companies.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, sqlite.Migrate(context.Background(), db))
+	return db
+}
@@ -0,0 +1,26 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	driver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func handleError(err error) error {
+	var sqliteErr *driver.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return repositories.ErrDuplicatedKey{}
+		}
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Join(repositories.ErrNotFound{}, err)
+	}
+
+	return err
+}
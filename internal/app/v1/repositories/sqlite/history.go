@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const historyColumns = `id, company_id, action, actor, request_id, recorded_at, changes, snapshot`
+
+type History struct {
+	db *sql.DB
+}
+
+func NewHistoryRepository(db *sql.DB) *History {
+	return &History{db: db}
+}
+
+func (r History) Add(ctx context.Context, entry repositories.HistoryEntry) error {
+	changes, err := marshalJSON(entry.Changes, entry.Changes == nil)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := marshalJSON(entry.Snapshot, entry.Snapshot == nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `INSERT INTO companies_history (`+historyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		primitive.NewObjectID().Hex(), entry.CompanyID, entry.Action, entry.Actor, entry.RequestID, entry.Timestamp.UnixMilli(), changes, snapshot)
+	return handleError(err)
+}
+
+// List returns history of the company from the oldest entry to the newest one
+func (r History) List(ctx context.Context, query repositories.HistoryQuery) (repositories.HistoryPage, error) {
+	where, args := "company_id = ?", []any{query.CompanyID}
+	if query.Cursor != "" {
+		c, err := repositories.DecodeCursor(query.Cursor, nil)
+		if err != nil {
+			return repositories.HistoryPage{}, err
+		}
+		where, args = where+" AND id > ?", append(args, c.ID)
+	}
+
+	// fetch one extra entry to find out if there is a next page
+	rows, err := r.db.QueryContext(ctx, `SELECT `+historyColumns+` FROM companies_history WHERE `+where+` ORDER BY id LIMIT ?`,
+		append(args, query.Limit+1)...)
+	if err != nil {
+		return repositories.HistoryPage{}, handleError(err)
+	}
+	defer rows.Close()
+
+	entries := make([]repositories.HistoryEntry, 0, query.Limit+1)
+	for rows.Next() {
+		entry, err := scanHistoryEntry(rows)
+		if err != nil {
+			return repositories.HistoryPage{}, handleError(err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return repositories.HistoryPage{}, handleError(err)
+	}
+
+	page := repositories.HistoryPage{Entries: entries}
+	if len(entries) > query.Limit {
+		page.Entries = entries[:query.Limit]
+		page.NextCursor = repositories.EncodeCursor(repositories.Cursor{ID: page.Entries[query.Limit-1].ID})
+	}
+
+	return page, nil
+}
+
+// Last returns the latest entry of the company history recorded not later than the given time
+func (r History) Last(ctx context.Context, companyID string, at time.Time) (repositories.HistoryEntry, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+historyColumns+` FROM companies_history
+		WHERE company_id = ? AND recorded_at <= ?
+		ORDER BY recorded_at DESC, id DESC
+		LIMIT 1`, companyID, at.UnixMilli())
+	entry, err := scanHistoryEntry(row)
+	return entry, handleError(err)
+}
+
+// scanHistoryEntry reads entry, changes and snapshot are stored as JSON documents
+func scanHistoryEntry(row scanner) (repositories.HistoryEntry, error) {
+	var entry repositories.HistoryEntry
+	var recordedAt int64
+	var changes, snapshot sql.NullString
+	err := row.Scan(&entry.ID, &entry.CompanyID, &entry.Action, &entry.Actor, &entry.RequestID, &recordedAt, &changes, &snapshot)
+	if err != nil {
+		return repositories.HistoryEntry{}, err
+	}
+
+	entry.Timestamp = fromUnixMilli(recordedAt)
+	if changes.Valid {
+		if err := json.Unmarshal([]byte(changes.String), &entry.Changes); err != nil {
+			return repositories.HistoryEntry{}, err
+		}
+	}
+	if snapshot.Valid {
+		if err := json.Unmarshal([]byte(snapshot.String), &entry.Snapshot); err != nil {
+			return repositories.HistoryEntry{}, err
+		}
+	}
+
+	return entry, nil
+}
+
+// marshalJSON returns JSON document of the value, NULL is stored for empty values
+func marshalJSON(value any, empty bool) (sql.NullString, error) {
+	if empty {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
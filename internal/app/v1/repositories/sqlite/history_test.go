@@ -0,0 +1,76 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	repo := sqlite.NewHistoryRepository(openTestDB(t))
+
+	t.Run("add and list history", func(t *testing.T) {
+		for _, action := range []string{"create", "update", "delete"} {
+			err := repo.Add(context.Background(), repositories.HistoryEntry{
+				CompanyID: "company",
+				Action:    action,
+				Actor:     "user",
+				RequestID: "request",
+				Timestamp: time.Now().UTC().Truncate(time.Millisecond),
+				Changes:   []repositories.FieldChange{{Field: "name", Before: "old", After: "new"}},
+			})
+			require.NoError(t, err)
+		}
+		require.NoError(t, repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "other", Action: "create"}))
+
+		page, err := repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "company", Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 2)
+		require.NotEmpty(t, page.NextCursor)
+		require.Equal(t, "create", page.Entries[0].Action)
+		require.Equal(t, "update", page.Entries[1].Action)
+		require.Equal(t, "user", page.Entries[0].Actor)
+		require.Equal(t, "request", page.Entries[0].RequestID)
+		require.Equal(t, []repositories.FieldChange{{Field: "name", Before: "old", After: "new"}}, page.Entries[0].Changes)
+		require.Nil(t, page.Entries[0].Snapshot)
+
+		page, err = repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "company", Cursor: page.NextCursor, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 1)
+		require.Empty(t, page.NextCursor)
+		require.Equal(t, "delete", page.Entries[0].Action)
+	})
+
+	t.Run("last entry", func(t *testing.T) {
+		created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		snapshot := repotest.NewCompany("snapshot")
+		snapshot.CreatedAt = created
+		err := repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "last", Action: "create", Timestamp: created, Snapshot: &snapshot})
+		require.NoError(t, err)
+		err = repo.Add(context.Background(), repositories.HistoryEntry{CompanyID: "last", Action: "update", Timestamp: created.Add(time.Hour)})
+		require.NoError(t, err)
+
+		entry, err := repo.Last(context.Background(), "last", created.Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, "create", entry.Action)
+		require.Equal(t, created, entry.Timestamp)
+		require.Equal(t, snapshot, *entry.Snapshot)
+
+		entry, err = repo.Last(context.Background(), "last", created.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, "update", entry.Action)
+
+		_, err = repo.Last(context.Background(), "last", created.Add(-time.Minute))
+		require.ErrorAs(t, err, &repositories.ErrNotFound{})
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := repo.List(context.Background(), repositories.HistoryQuery{CompanyID: "company", Cursor: "not a cursor", Limit: 2})
+		require.ErrorAs(t, err, &repositories.ErrInvalidCursor{})
+	})
+}
@@ -0,0 +1,72 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open opens the database file, transactions take the write lock when they begin,
+// so concurrent writers wait for each other instead of failing
+func Open(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	return sql.Open("sqlite", dsn)
+}
+
+// Migrate applies migrations which have not been applied yet, all of them are applied in one transaction
+func Migrate(ctx context.Context, db *sql.DB) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	slices.Sort(names)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint errcheck
+
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		name       TEXT PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		var applied bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE name = ?)", name).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		migration, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, string(migration)); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", name, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (name, applied_at) VALUES (?, ?)", name, now().UnixMilli()); err != nil {
+			return err
+		}
+
+		slog.Info("migration applied", "name", name)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+-- times are stored as unix time in milliseconds, the precision other storages keep
+CREATE TABLE companies (
+    -- seq is stable row id the full text index refers to
+    seq                 INTEGER PRIMARY KEY,
+    id                  TEXT NOT NULL UNIQUE,
+    name                TEXT NOT NULL,
+    description         TEXT NOT NULL DEFAULT '',
+    amount_of_employees INTEGER NOT NULL,
+    registered          INTEGER NOT NULL,
+    type                TEXT NOT NULL,
+    version             INTEGER NOT NULL,
+    created_at          INTEGER NOT NULL,
+    created_by          TEXT NOT NULL DEFAULT '',
+    updated_at          INTEGER NOT NULL,
+    updated_by          TEXT NOT NULL DEFAULT '',
+    deleted_at          INTEGER,
+    deleted_by          TEXT NOT NULL DEFAULT ''
+);
+
+-- name is unique among not deleted companies, deleted company can be restored only if its name is free
+CREATE UNIQUE INDEX companies_name_key ON companies (name) WHERE deleted_at IS NULL;
+
+CREATE INDEX companies_type_idx ON companies (type);
+CREATE INDEX companies_amount_of_employees_idx ON companies (amount_of_employees);
+CREATE INDEX companies_created_at_idx ON companies (created_at);
+CREATE INDEX companies_updated_at_idx ON companies (updated_at);
+CREATE INDEX companies_deleted_at_idx ON companies (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE VIRTUAL TABLE companies_fts USING fts5 (
+    name, description, content = 'companies', content_rowid = 'seq', tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER companies_fts_insert AFTER INSERT ON companies BEGIN
+    INSERT INTO companies_fts (rowid, name, description) VALUES (new.seq, new.name, new.description);
+END;
+
+CREATE TRIGGER companies_fts_delete AFTER DELETE ON companies BEGIN
+    INSERT INTO companies_fts (companies_fts, rowid, name, description) VALUES ('delete', old.seq, old.name, old.description);
+END;
+
+CREATE TRIGGER companies_fts_update AFTER UPDATE OF name, description ON companies BEGIN
+    INSERT INTO companies_fts (companies_fts, rowid, name, description) VALUES ('delete', old.seq, old.name, old.description);
+    INSERT INTO companies_fts (rowid, name, description) VALUES (new.seq, new.name, new.description);
+END;
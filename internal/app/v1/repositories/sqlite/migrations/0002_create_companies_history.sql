@@ -0,0 +1,14 @@
+CREATE TABLE companies_history (
+    id          TEXT PRIMARY KEY,
+    company_id  TEXT NOT NULL,
+    action      TEXT NOT NULL,
+    actor       TEXT NOT NULL DEFAULT '',
+    request_id  TEXT NOT NULL DEFAULT '',
+    recorded_at INTEGER NOT NULL,
+    -- changes and snapshot are JSON documents
+    changes     TEXT,
+    snapshot    TEXT
+);
+
+CREATE INDEX companies_history_company_id_idx ON companies_history (company_id, id);
+CREATE INDEX companies_history_recorded_at_idx ON companies_history (company_id, recorded_at);
@@ -0,0 +1,22 @@
+CREATE TABLE webhook_subscriptions (
+    id         TEXT PRIMARY KEY,
+    url        TEXT NOT NULL,
+    secret     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    created_by TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE webhook_deliveries (
+    id              TEXT PRIMARY KEY,
+    subscription_id TEXT NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id        TEXT NOT NULL,
+    event_type      TEXT NOT NULL,
+    attempt         INTEGER NOT NULL,
+    status_code     INTEGER NOT NULL DEFAULT 0,
+    error           TEXT NOT NULL DEFAULT '',
+    timestamp       INTEGER NOT NULL,
+    -- duration of the attempt in nanoseconds
+    duration        INTEGER NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id, timestamp DESC, id DESC);
@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	subscriptionColumns = `id, url, secret, created_at, created_by`
+	deliveryColumns     = `id, subscription_id, event_id, event_type, attempt, status_code, error, timestamp, duration`
+)
+
+// Webhooks keeps webhook subscriptions and attempts to deliver events to them
+type Webhooks struct {
+	db *sql.DB
+}
+
+func NewWebhooksRepository(db *sql.DB) *Webhooks {
+	return &Webhooks{db: db}
+}
+
+func (r Webhooks) AddSubscription(ctx context.Context, subscription repositories.WebhookSubscription) (repositories.WebhookSubscription, error) {
+	subscription.ID = primitive.NewObjectID().Hex()
+	subscription.CreatedAt = now()
+	subscription.CreatedBy = reqctx.Actor(ctx)
+	_, err := r.db.ExecContext(ctx, `INSERT INTO webhook_subscriptions (`+subscriptionColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		subscription.ID, subscription.URL, subscription.Secret, subscription.CreatedAt.UnixMilli(), subscription.CreatedBy)
+	if err != nil {
+		return repositories.WebhookSubscription{}, handleError(err)
+	}
+
+	return subscription, nil
+}
+
+func (r Webhooks) GetSubscription(ctx context.Context, id string) (repositories.WebhookSubscription, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = ?`, id)
+	subscription, err := scanSubscription(row)
+	return subscription, handleError(err)
+}
+
+// ListSubscriptions returns all subscriptions from the oldest one to the newest one
+func (r Webhooks) ListSubscriptions(ctx context.Context) ([]repositories.WebhookSubscription, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	defer rows.Close()
+
+	subscriptions := make([]repositories.WebhookSubscription, 0)
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, handleError(err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError(err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes the subscription together with its deliveries
+func (r Webhooks) DeleteSubscription(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = ?`, id)
+	if err != nil {
+		return handleError(err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return handleError(err)
+	}
+	if deleted == 0 {
+		return repositories.ErrNotFound{}
+	}
+
+	return nil
+}
+
+func (r Webhooks) AddDelivery(ctx context.Context, delivery repositories.WebhookDelivery) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO webhook_deliveries (`+deliveryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		primitive.NewObjectID().Hex(), delivery.SubscriptionID, delivery.EventID, delivery.EventType, delivery.Attempt,
+		delivery.StatusCode, delivery.Error, delivery.Timestamp.UnixMilli(), int64(delivery.Duration))
+	return handleError(err)
+}
+
+// ListDeliveries returns up to limit latest deliveries of the subscription from the newest one to the oldest one
+func (r Webhooks) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]repositories.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE subscription_id = ?
+		ORDER BY timestamp DESC, id DESC LIMIT ?`, subscriptionID, limit)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]repositories.WebhookDelivery, 0, limit)
+	for rows.Next() {
+		var delivery repositories.WebhookDelivery
+		var timestamp, duration int64
+		err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Attempt,
+			&delivery.StatusCode, &delivery.Error, &timestamp, &duration)
+		if err != nil {
+			return nil, handleError(err)
+		}
+		delivery.Timestamp, delivery.Duration = fromUnixMilli(timestamp), time.Duration(duration)
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError(err)
+	}
+
+	return deliveries, nil
+}
+
+func scanSubscription(row scanner) (repositories.WebhookSubscription, error) {
+	var subscription repositories.WebhookSubscription
+	var createdAt int64
+	err := row.Scan(&subscription.ID, &subscription.URL, &subscription.Secret, &createdAt, &subscription.CreatedBy)
+	subscription.CreatedAt = fromUnixMilli(createdAt)
+	return subscription, err
+}
@@ -0,0 +1,16 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/sqlite"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
+)
+
+func TestWebhooksContract(t *testing.T) {
+	db := openTestDB(t)
+	repotest.RunWebhooksRepository(t, func(t *testing.T) webhook.Store {
+		return sqlite.NewWebhooksRepository(db)
+	})
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Webhooks keeps webhook subscriptions and attempts to deliver events to them
+type Webhooks struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+}
+
+func NewWebhooksRepository(subscriptions, deliveries *mongo.Collection) *Webhooks {
+	return &Webhooks{subscriptions: subscriptions, deliveries: deliveries}
+}
+
+func (r Webhooks) AddSubscription(ctx context.Context, subscription WebhookSubscription) (WebhookSubscription, error) {
+	subscription.ID = primitive.NewObjectID().Hex()
+	subscription.CreatedAt = now()
+	subscription.CreatedBy = reqctx.Actor(ctx)
+	if _, err := r.subscriptions.InsertOne(ctx, subscription); err != nil {
+		return WebhookSubscription{}, handleError(err)
+	}
+
+	return subscription, nil
+}
+
+func (r Webhooks) GetSubscription(ctx context.Context, id string) (WebhookSubscription, error) {
+	var subscription WebhookSubscription
+	err := r.subscriptions.FindOne(ctx, bson.M{"_id": id}).Decode(&subscription)
+	return subscription, handleError(err)
+}
+
+// ListSubscriptions returns all subscriptions from the oldest one to the newest one
+func (r Webhooks) ListSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	cur, err := r.subscriptions.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	subscriptions := make([]WebhookSubscription, 0)
+	if err := cur.All(ctx, &subscriptions); err != nil {
+		return nil, handleError(err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes the subscription together with its deliveries
+func (r Webhooks) DeleteSubscription(ctx context.Context, id string) error {
+	res, err := r.subscriptions.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return handleError(err)
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrNotFound{}
+	}
+
+	_, err = r.deliveries.DeleteMany(ctx, bson.M{"subscription_id": id})
+	return handleError(err)
+}
+
+func (r Webhooks) AddDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	delivery.ID = primitive.NewObjectID().Hex()
+	_, err := r.deliveries.InsertOne(ctx, delivery)
+	return handleError(err)
+}
+
+// ListDeliveries returns up to limit latest deliveries of the subscription from the newest one to the oldest one
+func (r Webhooks) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit))
+	cur, err := r.deliveries.Find(ctx, bson.M{"subscription_id": subscriptionID}, opts)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	deliveries := make([]WebhookDelivery, 0, limit)
+	if err := cur.All(ctx, &deliveries); err != nil {
+		return nil, handleError(err)
+	}
+
+	return deliveries, nil
+}
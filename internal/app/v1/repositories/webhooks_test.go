@@ -0,0 +1,16 @@
+package repositories_test
+
+import (
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/repotest"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
+)
+
+func TestWebhooksContract(t *testing.T) {
+	db := testCompaniesCollection.Database()
+	repotest.RunWebhooksRepository(t, func(t *testing.T) webhook.Store {
+		return repositories.NewWebhooksRepository(db.Collection("webhooks"), db.Collection("webhook_deliveries"))
+	})
+}
@@ -2,28 +2,122 @@ package services
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
 )
 
 type CompaniesRepository interface {
 	Create(ctx context.Context, company repositories.Company) (repositories.Company, error)
+	CreateMany(ctx context.Context, companies []repositories.Company) ([]repositories.Company, []error)
+	UpsertByName(ctx context.Context, company repositories.Company) (repositories.Company, *repositories.Company, error)
 	Get(ctx context.Context, id string) (repositories.Company, error)
-	Update(ctx context.Context, company repositories.CompanyUpdate) error
-	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, query repositories.ListQuery) (repositories.CompaniesPage, error)
+	Search(ctx context.Context, query repositories.SearchQuery) ([]repositories.SearchResult, error)
+	Export(ctx context.Context, filter repositories.CompanyFilter, fn func(repositories.Company) error) error
+	Update(ctx context.Context, company repositories.CompanyUpdate) (repositories.Company, error)
+	Delete(ctx context.Context, id string, version int64) error
+	Restore(ctx context.Context, id string) (repositories.Company, error)
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+
+	// updateAttempts is how many times unconditional update is tried while the company is changed concurrently
+	updateAttempts = 5
+)
+
 type CompaniesService struct {
-	repo CompaniesRepository
+	repo             CompaniesRepository
+	history          HistoryRepository
+	defaultPageLimit int
+	maxPageLimit     int
+}
+
+type Option func(*CompaniesService)
+
+// WithPageLimits sets the page size used when a list request has no limit and the upper bound for it
+func WithPageLimits(defaultLimit, maxLimit int) Option {
+	return func(s *CompaniesService) {
+		if defaultLimit > 0 {
+			s.defaultPageLimit = defaultLimit
+		}
+		if maxLimit > 0 {
+			s.maxPageLimit = maxLimit
+		}
+	}
 }
 
-func NewCompaniesService(repo CompaniesRepository) *CompaniesService {
-	return &CompaniesService{repo: repo}
+func NewCompaniesService(repo CompaniesRepository, opts ...Option) *CompaniesService {
+	s := &CompaniesService{
+		repo:             repo,
+		defaultPageLimit: DefaultPageLimit,
+		maxPageLimit:     MaxPageLimit,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 func (s CompaniesService) Create(ctx context.Context, company Company) (Company, error) {
 	res, err := s.repo.Create(ctx, RepositoryCompany(company))
-	return CompanyFromRepository(res), handleError(err)
+	if err != nil {
+		return Company{}, handleError(err)
+	}
+
+	created := CompanyFromRepository(res)
+	s.record(ctx, ActionCreate, created.ID, diffCompanies(nil, created), &created)
+
+	return created, nil
+}
+
+// CreateMany creates companies independently of each other, result for every company is returned in the same order
+func (s CompaniesService) CreateMany(ctx context.Context, companies []Company) ([]Company, []error) {
+	repoCompanies := make([]repositories.Company, 0, len(companies))
+	for _, company := range companies {
+		repoCompanies = append(repoCompanies, RepositoryCompany(company))
+	}
+
+	res, errs := s.repo.CreateMany(ctx, repoCompanies)
+
+	created := make([]Company, len(res))
+	for i := range res {
+		if errs[i] != nil {
+			errs[i] = handleError(errs[i])
+			continue
+		}
+
+		created[i] = CompanyFromRepository(res[i])
+		s.record(ctx, ActionCreate, created[i].ID, diffCompanies(nil, created[i]), &created[i])
+	}
+
+	return created, errs
+}
+
+// UpsertByName creates the company or updates the existing one with the same name
+func (s CompaniesService) UpsertByName(ctx context.Context, company Company) (CompanyChange, error) {
+	res, previous, err := s.repo.UpsertByName(ctx, RepositoryCompany(company))
+	if err != nil {
+		return CompanyChange{}, handleError(err)
+	}
+
+	upserted := CompanyFromRepository(res)
+	if previous == nil {
+		change := CompanyChange{Company: upserted, Changes: diffCompanies(nil, upserted), Created: true}
+		s.record(ctx, ActionCreate, upserted.ID, change.Changes, &upserted)
+		return change, nil
+	}
+
+	before := CompanyFromRepository(*previous)
+	change := CompanyChange{Company: upserted, Changes: diffCompanies(&before, upserted)}
+	s.record(ctx, ActionUpdate, upserted.ID, change.Changes, &upserted)
+	return change, nil
 }
 
 func (s CompaniesService) Get(ctx context.Context, id string) (Company, error) {
@@ -31,10 +125,128 @@ func (s CompaniesService) Get(ctx context.Context, id string) (Company, error) {
 	return CompanyFromRepository(res), handleError(err)
 }
 
-func (s CompaniesService) Update(ctx context.Context, update CompanyUpdate) error {
-	return handleError(s.repo.Update(ctx, RepositoryCompanyUpdate(update)))
+func (s CompaniesService) List(ctx context.Context, query ListQuery) (CompaniesPage, error) {
+	query.Limit = s.pageLimit(query.Limit)
+	res, err := s.repo.List(ctx, RepositoryListQuery(query))
+	if err != nil {
+		return CompaniesPage{}, handleError(err)
+	}
+
+	return CompaniesPageFromRepository(res), nil
+}
+
+// Export calls fn for every company matching the filter, companies are not loaded into memory all at once
+func (s CompaniesService) Export(ctx context.Context, filter CompanyFilter, fn func(Company) error) error {
+	return handleError(s.repo.Export(ctx, RepositoryCompanyFilter(filter), func(company repositories.Company) error {
+		return fn(CompanyFromRepository(company))
+	}))
+}
+
+func (s CompaniesService) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	res, err := s.repo.Search(ctx, repositories.SearchQuery{Text: query.Text, Limit: s.pageLimit(query.Limit)})
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	terms := searchTerms(query.Text)
+	results := make([]SearchResult, 0, len(res))
+	for _, r := range res {
+		result := SearchResult{
+			Company:    CompanyFromRepository(r.Company),
+			Score:      r.Score,
+			Highlights: make(map[string]string),
+		}
+
+		if name, ok := highlight(r.Name, terms); ok {
+			result.Highlights["name"] = name
+		}
+		if description, ok := snippet(r.Description, terms); ok {
+			result.Highlights["description"] = description
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Update applies the update to the company, non zero version makes it conditional on the current company version.
+// The company is written only if it has not been changed since it was read, so the changes are exactly the ones
+// made by the update. Unconditional update is retried when the company has been changed in between,
+// ErrConcurrentUpdate is returned when it is changed every time
+func (s CompaniesService) Update(ctx context.Context, update CompanyUpdate) (CompanyChange, error) {
+	for attempt := 1; ; attempt++ {
+		before, err := s.repo.Get(ctx, update.ID)
+		if err != nil {
+			return CompanyChange{}, handleError(err)
+		}
+
+		version := before.Version
+		if version == 0 {
+			version = VersionUnset
+		}
+		if update.Version != 0 && update.Version != version {
+			return CompanyChange{}, handleError(repositories.ErrVersionMismatch{})
+		}
+
+		conditional := RepositoryCompanyUpdate(update)
+		conditional.Version = version
+		after, err := s.repo.Update(ctx, conditional)
+		if update.Version == 0 && errors.As(err, &repositories.ErrVersionMismatch{}) {
+			// the client has not asked for the version, so it is not a failed precondition
+			if attempt < updateAttempts {
+				continue
+			}
+			return CompanyChange{}, errors.Join(ErrConcurrentUpdate{}, err)
+		}
+		if err != nil {
+			return CompanyChange{}, handleError(err)
+		}
+
+		beforeCompany, afterCompany := CompanyFromRepository(before), CompanyFromRepository(after)
+		change := CompanyChange{Company: afterCompany, Changes: diffCompanies(&beforeCompany, afterCompany)}
+		s.record(ctx, ActionUpdate, update.ID, change.Changes, &afterCompany)
+
+		return change, nil
+	}
+}
+
+// Delete marks the company as deleted, non zero version makes deletion conditional on the current company version
+func (s CompaniesService) Delete(ctx context.Context, id string, version int64) error {
+	if err := s.repo.Delete(ctx, id, version); err != nil {
+		return handleError(err)
+	}
+
+	s.record(ctx, ActionDelete, id, nil, nil)
+
+	return nil
+}
+
+func (s CompaniesService) Restore(ctx context.Context, id string) (Company, error) {
+	res, err := s.repo.Restore(ctx, id)
+	if err != nil {
+		return Company{}, handleError(err)
+	}
+
+	restored := CompanyFromRepository(res)
+	s.record(ctx, ActionRestore, id, nil, &restored)
+
+	return restored, nil
+}
+
+// Purge permanently removes companies which have been deleted longer than retention period ago
+func (s CompaniesService) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	purged, err := s.repo.Purge(ctx, time.Now().Add(-retention))
+	return purged, handleError(err)
 }
 
-func (s CompaniesService) Delete(ctx context.Context, id string) error {
-	return handleError(s.repo.Delete(ctx, id))
+func (s CompaniesService) pageLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return min(s.defaultPageLimit, s.maxPageLimit)
+	case limit > s.maxPageLimit:
+		return s.maxPageLimit
+	default:
+		return limit
+	}
 }
@@ -3,7 +3,9 @@ package services_test
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
@@ -38,6 +40,121 @@ func TestCompaniesCreate(t *testing.T) {
 	})
 }
 
+func TestCompaniesCreateMany(t *testing.T) {
+	first, second, third := createTestRepoCompany(), createTestRepoCompany(), createTestRepoCompany()
+	second.Name, third.Name = "second", "third"
+
+	repo := mockCompaniesRepository{
+		t:                 t,
+		expectedCompanies: []repositories.Company{first, second, third},
+		returnCompanies:   []repositories.Company{first, {}, {}},
+		returnErrors:      []error{nil, repositories.ErrDuplicatedKey{}, errors.New("error")},
+	}
+	history := &mockHistoryRepository{t: t}
+
+	firstCompany, secondCompany, thirdCompany := createTestCompany(), createTestCompany(), createTestCompany()
+	secondCompany.Name, thirdCompany.Name = "second", "third"
+
+	service := services.NewCompaniesService(repo, services.WithHistory(history))
+	created, errs := service.CreateMany(context.Background(), []services.Company{firstCompany, secondCompany, thirdCompany})
+	require.Equal(t, []services.Company{createTestCompany(), {}, {}}, created)
+	require.Len(t, errs, 3)
+	require.NoError(t, errs[0])
+	require.ErrorAs(t, errs[1], &services.ErrDbDuplicatedKey{})
+	require.ErrorAs(t, errs[2], &services.ErrDb{})
+
+	// only created company gets to the history
+	require.Len(t, history.added, 1)
+	require.Equal(t, "id", history.added[0].CompanyID)
+}
+
+func TestCompaniesUpsertByName(t *testing.T) {
+	t.Run("created", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:               t,
+			expectedCompany: createTestRepoCompany(),
+			returnCompany:   createTestRepoCompany(),
+		}
+		history := &mockHistoryRepository{t: t}
+
+		service := services.NewCompaniesService(repo, services.WithHistory(history))
+		change, err := service.UpsertByName(context.Background(), createTestCompany())
+		require.NoError(t, err)
+		require.True(t, change.Created)
+		require.Equal(t, createTestCompany(), change.Company)
+		require.Len(t, change.Changes, 5)
+
+		require.Len(t, history.added, 1)
+		require.Equal(t, services.ActionCreate, history.added[0].Action)
+	})
+
+	t.Run("updated", func(t *testing.T) {
+		previous := createTestRepoCompany()
+		previous.AmountOfEmployees = 5
+
+		repo := mockCompaniesRepository{
+			t:               t,
+			expectedCompany: createTestRepoCompany(),
+			returnCompany:   createTestRepoCompany(),
+			returnPrevious:  &previous,
+		}
+		history := &mockHistoryRepository{t: t}
+
+		service := services.NewCompaniesService(repo, services.WithHistory(history))
+		change, err := service.UpsertByName(context.Background(), createTestCompany())
+		require.NoError(t, err)
+		require.False(t, change.Created)
+		require.Equal(t, []services.FieldChange{{Field: "amount_of_employees", Before: 5, After: 1}}, change.Changes)
+
+		require.Len(t, history.added, 1)
+		require.Equal(t, services.ActionUpdate, history.added[0].Action)
+		require.Equal(t, []repositories.FieldChange{{Field: "amount_of_employees", Before: 5, After: 1}}, history.added[0].Changes)
+	})
+
+	t.Run("duplicated key error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:               t,
+			expectedCompany: createTestRepoCompany(),
+			returnError:     repositories.ErrDuplicatedKey{},
+		}
+
+		service := services.NewCompaniesService(repo)
+		_, err := service.UpsertByName(context.Background(), createTestCompany())
+		require.ErrorAs(t, err, &services.ErrDbDuplicatedKey{})
+	})
+}
+
+func TestCompaniesExport(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		registered := true
+		repo := mockCompaniesRepository{
+			t:               t,
+			expectedFilter:  repositories.CompanyFilter{Registered: &registered},
+			returnCompanies: []repositories.Company{createTestRepoCompany(), createTestRepoCompany()},
+		}
+
+		var exported []services.Company
+		service := services.NewCompaniesService(repo)
+		err := service.Export(context.Background(), services.CompanyFilter{Registered: &registered}, func(company services.Company) error {
+			exported = append(exported, company)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []services.Company{createTestCompany(), createTestCompany()}, exported)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:           t,
+			returnError: errors.New("error"),
+		}
+
+		service := services.NewCompaniesService(repo)
+		err := service.Export(context.Background(), services.CompanyFilter{}, func(services.Company) error { return nil })
+		require.ErrorAs(t, err, &services.ErrDb{})
+	})
+}
+
 func TestCompaniesGet(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		repo := mockCompaniesRepository{
@@ -79,27 +196,257 @@ func TestCompaniesGet(t *testing.T) {
 	})
 }
 
+func TestCompaniesList(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:                 t,
+			expectedListQuery: repositories.ListQuery{Cursor: "cursor", Limit: 10},
+			returnPage: repositories.CompaniesPage{
+				Companies:  []repositories.Company{createTestRepoCompany()},
+				NextCursor: "next",
+			},
+		}
+
+		service := services.NewCompaniesService(repo)
+		page, err := service.List(context.Background(), services.ListQuery{Cursor: "cursor", Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, services.CompaniesPage{
+			Companies:  []services.Company{createTestCompany()},
+			NextCursor: "next",
+		}, page)
+	})
+
+	t.Run("filters and sorting", func(t *testing.T) {
+		registered := true
+		minEmployees := 10
+		repo := mockCompaniesRepository{
+			t: t,
+			expectedListQuery: repositories.ListQuery{
+				Limit: services.DefaultPageLimit,
+				Filter: repositories.CompanyFilter{
+					Type:         "NonProfit",
+					Registered:   &registered,
+					MinEmployees: &minEmployees,
+				},
+				Sort: []repositories.SortField{{Field: "amount_of_employees", Desc: true}, {Field: "name"}},
+			},
+		}
+
+		service := services.NewCompaniesService(repo)
+		_, err := service.List(context.Background(), services.ListQuery{
+			Filter: services.CompanyFilter{
+				Type:         "NonProfit",
+				Registered:   &registered,
+				MinEmployees: &minEmployees,
+			},
+			Sort: []services.SortField{{Field: "amount_of_employees", Desc: true}, {Field: "name"}},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("page limits", func(t *testing.T) {
+		doTest := func(requested, expected int) {
+			repo := mockCompaniesRepository{
+				t:                 t,
+				expectedListQuery: repositories.ListQuery{Limit: expected},
+			}
+
+			service := services.NewCompaniesService(repo, services.WithPageLimits(5, 50))
+			page, err := service.List(context.Background(), services.ListQuery{Limit: requested})
+			require.NoError(t, err)
+			require.Empty(t, page.Companies)
+		}
+
+		doTest(0, 5)
+		doTest(10, 10)
+		doTest(1000, 50)
+	})
+
+	t.Run("invalid cursor error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:                 t,
+			expectedListQuery: repositories.ListQuery{Cursor: "broken", Limit: services.DefaultPageLimit},
+			returnError:       repositories.ErrInvalidCursor{},
+		}
+
+		service := services.NewCompaniesService(repo)
+		_, err := service.List(context.Background(), services.ListQuery{Cursor: "broken"})
+		require.ErrorAs(t, err, &services.ErrInvalidCursor{})
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:                 t,
+			expectedListQuery: repositories.ListQuery{Limit: services.DefaultPageLimit},
+			returnError:       errors.New("error"),
+		}
+
+		service := services.NewCompaniesService(repo)
+		page, err := service.List(context.Background(), services.ListQuery{})
+		require.ErrorAs(t, err, &services.ErrDb{})
+		require.Empty(t, page)
+	})
+}
+
+func TestCompaniesSearch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		longDescription := strings.Repeat("Lorem ipsum dolor sit amet. ", 5) + "We produce <green> energy. " + strings.Repeat("Lorem ipsum dolor sit amet. ", 5)
+		repo := mockCompaniesRepository{
+			t:                   t,
+			expectedSearchQuery: repositories.SearchQuery{Text: "green -coal", Limit: services.DefaultPageLimit},
+			returnSearchResults: []repositories.SearchResult{
+				{Company: repositories.Company{ID: "1", Name: "Green Power", Description: "Green & clean"}, Score: 2},
+				{Company: repositories.Company{ID: "2", Name: "Sunny", Description: longDescription}, Score: 1},
+				{Company: repositories.Company{ID: "3", Name: "Greenery"}, Score: 0.5},
+			},
+		}
+
+		service := services.NewCompaniesService(repo)
+		results, err := service.Search(context.Background(), services.SearchQuery{Text: "green -coal"})
+		require.NoError(t, err)
+		require.Equal(t, []services.SearchResult{
+			{
+				Company:    services.Company{ID: "1", Name: "Green Power", Description: "Green & clean"},
+				Score:      2,
+				Highlights: map[string]string{"name": "<em>Green</em> Power", "description": "<em>Green</em> &amp; clean"},
+			},
+			{
+				Company:    services.Company{ID: "2", Name: "Sunny", Description: longDescription},
+				Score:      1,
+				Highlights: map[string]string{"description": "…Lorem ipsum dolor sit amet. We produce &lt;<em>green</em>&gt; energy. Lorem ipsum dolor sit amet. Lorem ipsum dolor sit amet. Lorem ipsum dolor sit amet. Lorem ipsum dolor sit…"},
+			},
+			{
+				Company:    services.Company{ID: "3", Name: "Greenery"},
+				Score:      0.5,
+				Highlights: map[string]string{"name": "<em>Greenery</em>"},
+			},
+		}, results)
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:                   t,
+			expectedSearchQuery: repositories.SearchQuery{Text: "green", Limit: 3},
+			returnError:         errors.New("error"),
+		}
+
+		service := services.NewCompaniesService(repo)
+		results, err := service.Search(context.Background(), services.SearchQuery{Text: "green", Limit: 3})
+		require.ErrorAs(t, err, &services.ErrDb{})
+		require.Empty(t, results)
+	})
+}
+
 func TestCompaniesUpdate(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
+		company := createTestRepoCompany()
+		company.Version = 3
+		updated := company
+		updated.Type = "NonProfit"
+		updated.Version = 4
+
+		// the company is written only if it is still the read one
+		expectedCompanyUpdate := createTestRepoCompanyUpdate()
+		expectedCompanyUpdate.Version = 3
+		repo := mockCompaniesRepository{
+			t:                     t,
+			expectedId:            "id",
+			expectedCompanyUpdate: expectedCompanyUpdate,
+			returnCompany:         company,
+			returnUpdated:         updated,
+		}
+
+		service := services.NewCompaniesService(repo)
+		change, err := service.Update(context.Background(), createTestCompanyUpdate())
+		require.NoError(t, err)
+		require.Equal(t, services.CompanyFromRepository(updated), change.Company)
+		require.Equal(t, []services.FieldChange{{Field: "type", Before: "test", After: "NonProfit"}}, change.Changes)
+		require.False(t, change.Created)
+	})
+
+	t.Run("not found error", func(t *testing.T) {
 		repo := mockCompaniesRepository{
 			t:                     t,
+			expectedId:            "id",
 			expectedCompanyUpdate: createTestRepoCompanyUpdate(),
+			returnError:           repositories.ErrNotFound{},
+		}
+
+		service := services.NewCompaniesService(repo)
+		_, err := service.Update(context.Background(), createTestCompanyUpdate())
+		require.ErrorAs(t, err, &services.ErrNotFound{})
+	})
+
+	t.Run("unconditional update keeps conflicting", func(t *testing.T) {
+		// the company has no version, as the ones created before versioning
+		expectedCompanyUpdate := createTestRepoCompanyUpdate()
+		expectedCompanyUpdate.Version = repositories.VersionUnset
+		repo := mockVersionMismatchRepository{
+			mockCompaniesRepository: mockCompaniesRepository{
+				t:                     t,
+				expectedId:            "id",
+				expectedCompanyUpdate: expectedCompanyUpdate,
+				returnCompany:         createTestRepoCompany(),
+			},
 		}
 
 		service := services.NewCompaniesService(repo)
-		err := service.Update(context.Background(), createTestCompanyUpdate())
+		_, err := service.Update(context.Background(), createTestCompanyUpdate())
+		require.ErrorAs(t, err, &services.ErrConcurrentUpdate{})
+		// the client has not sent the version, so the precondition has not failed
+		require.NotErrorIs(t, err, services.ErrVersionMismatch{})
+	})
+
+	t.Run("version mismatch error of conditional update", func(t *testing.T) {
+		company := createTestRepoCompany()
+		company.Version = 3
+
+		// the company is not written
+		repo := mockCompaniesRepository{t: t, expectedId: "id", returnCompany: company}
+
+		update := createTestCompanyUpdate()
+		update.Version = 2
+		service := services.NewCompaniesService(repo)
+		_, err := service.Update(context.Background(), update)
+		require.ErrorAs(t, err, &services.ErrVersionMismatch{})
+	})
+
+	t.Run("company changed concurrently", func(t *testing.T) {
+		company := createTestRepoCompany()
+		company.Version = 1
+		// the company is changed by somebody else after it has been read
+		concurrent := company
+		concurrent.Type = "Cooperative"
+		concurrent.Version = 2
+
+		repo := &mockConcurrentRepository{
+			mockCompaniesRepository: mockCompaniesRepository{t: t, expectedId: "id"},
+			reads:                   []repositories.Company{company, concurrent},
+			current:                 concurrent,
+		}
+		history := &mockHistoryRepository{t: t}
+
+		service := services.NewCompaniesService(repo, services.WithHistory(history))
+		change, err := service.Update(context.Background(), createTestCompanyUpdate())
 		require.NoError(t, err)
+		require.Equal(t, int64(3), change.Company.Version)
+		require.Equal(t, []services.FieldChange{{Field: "type", Before: "Cooperative", After: "test"}}, change.Changes)
+		require.Equal(t, []int64{1, 2}, repo.writtenVersions)
+
+		require.Len(t, history.added, 1)
+		require.Equal(t, []repositories.FieldChange{{Field: "type", Before: "Cooperative", After: "test"}}, history.added[0].Changes)
 	})
 
 	t.Run("error", func(t *testing.T) {
 		repo := mockCompaniesRepository{
 			t:                     t,
+			expectedId:            "id",
 			expectedCompanyUpdate: createTestRepoCompanyUpdate(),
 			returnError:           errors.New("error"),
 		}
 
 		service := services.NewCompaniesService(repo)
-		err := service.Update(context.Background(), createTestCompanyUpdate())
+		_, err := service.Update(context.Background(), createTestCompanyUpdate())
 		require.ErrorAs(t, err, &services.ErrDb{})
 	})
 }
@@ -112,10 +459,35 @@ func TestCompaniesDelete(t *testing.T) {
 		}
 
 		service := services.NewCompaniesService(repo)
-		err := service.Delete(context.Background(), "id")
+		err := service.Delete(context.Background(), "id", 0)
 		require.NoError(t, err)
 	})
 
+	t.Run("not found error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:           t,
+			expectedId:  "id",
+			returnError: repositories.ErrNotFound{},
+		}
+
+		service := services.NewCompaniesService(repo)
+		err := service.Delete(context.Background(), "id", 0)
+		require.ErrorAs(t, err, &services.ErrNotFound{})
+	})
+
+	t.Run("version mismatch error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:               t,
+			expectedId:      "id",
+			expectedVersion: 3,
+			returnError:     repositories.ErrVersionMismatch{},
+		}
+
+		service := services.NewCompaniesService(repo)
+		err := service.Delete(context.Background(), "id", 3)
+		require.ErrorAs(t, err, &services.ErrVersionMismatch{})
+	})
+
 	t.Run("error", func(t *testing.T) {
 		repo := mockCompaniesRepository{
 			t:           t,
@@ -124,7 +496,75 @@ func TestCompaniesDelete(t *testing.T) {
 		}
 
 		service := services.NewCompaniesService(repo)
-		err := service.Delete(context.Background(), "id")
+		err := service.Delete(context.Background(), "id", 0)
+		require.ErrorAs(t, err, &services.ErrDb{})
+	})
+}
+
+func TestCompaniesRestore(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:             t,
+			expectedId:    "id",
+			returnCompany: createTestRepoCompany(),
+		}
+
+		service := services.NewCompaniesService(repo)
+		company, err := service.Restore(context.Background(), "id")
+		require.NoError(t, err)
+		require.Equal(t, createTestCompany(), company)
+	})
+
+	t.Run("duplicated key error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:           t,
+			expectedId:  "id",
+			returnError: repositories.ErrDuplicatedKey{},
+		}
+
+		service := services.NewCompaniesService(repo)
+		company, err := service.Restore(context.Background(), "id")
+		require.ErrorAs(t, err, &services.ErrDbDuplicatedKey{})
+		require.Empty(t, company)
+	})
+
+	t.Run("not found error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:           t,
+			expectedId:  "id",
+			returnError: repositories.ErrNotFound{},
+		}
+
+		service := services.NewCompaniesService(repo)
+		company, err := service.Restore(context.Background(), "id")
+		require.ErrorAs(t, err, &services.ErrNotFound{})
+		require.Empty(t, company)
+	})
+}
+
+func TestCompaniesPurge(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:                     t,
+			expectedDeletedBefore: time.Now().Add(-time.Hour),
+			returnPurged:          3,
+		}
+
+		service := services.NewCompaniesService(repo)
+		purged, err := service.Purge(context.Background(), time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), purged)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:                     t,
+			expectedDeletedBefore: time.Now().Add(-time.Hour),
+			returnError:           errors.New("error"),
+		}
+
+		service := services.NewCompaniesService(repo)
+		_, err := service.Purge(context.Background(), time.Hour)
 		require.ErrorAs(t, err, &services.ErrDb{})
 	})
 }
@@ -184,6 +624,19 @@ type mockCompaniesRepository struct {
 	expectedCompany       repositories.Company
 	expectedCompanyUpdate repositories.CompanyUpdate
 	expectedId            string
+	expectedVersion       int64
+	expectedListQuery     repositories.ListQuery
+	expectedSearchQuery   repositories.SearchQuery
+	returnPage            repositories.CompaniesPage
+	returnSearchResults   []repositories.SearchResult
+	expectedDeletedBefore time.Time
+	returnPurged          int64
+	returnUpdated         repositories.Company
+	expectedCompanies     []repositories.Company
+	returnCompanies       []repositories.Company
+	returnErrors          []error
+	returnPrevious        *repositories.Company
+	expectedFilter        repositories.CompanyFilter
 }
 
 func (m mockCompaniesRepository) Create(ctx context.Context, company repositories.Company) (repositories.Company, error) {
@@ -193,21 +646,113 @@ func (m mockCompaniesRepository) Create(ctx context.Context, company repositorie
 	return m.returnCompany, m.returnError
 }
 
+func (m mockCompaniesRepository) CreateMany(ctx context.Context, companies []repositories.Company) ([]repositories.Company, []error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedCompanies, companies)
+	return m.returnCompanies, m.returnErrors
+}
+
+func (m mockCompaniesRepository) UpsertByName(ctx context.Context, company repositories.Company) (repositories.Company, *repositories.Company, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedCompany, company)
+	return m.returnCompany, m.returnPrevious, m.returnError
+}
+
+func (m mockCompaniesRepository) Export(ctx context.Context, filter repositories.CompanyFilter, fn func(repositories.Company) error) error {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedFilter, filter)
+	for _, company := range m.returnCompanies {
+		if err := fn(company); err != nil {
+			return err
+		}
+	}
+	return m.returnError
+}
+
 func (m mockCompaniesRepository) Get(ctx context.Context, id string) (repositories.Company, error) {
 	m.t.Helper()
 	require.Equal(m.t, m.expectedId, id)
 	return m.returnCompany, m.returnError
 }
 
-func (m mockCompaniesRepository) Update(ctx context.Context, company repositories.CompanyUpdate) error {
+func (m mockCompaniesRepository) List(ctx context.Context, query repositories.ListQuery) (repositories.CompaniesPage, error) {
+	m.t.Helper()
+	require.Equal(m.t, m.expectedListQuery, query)
+	return m.returnPage, m.returnError
+}
+
+func (m mockCompaniesRepository) Search(ctx context.Context, query repositories.SearchQuery) ([]repositories.SearchResult, error) {
+	m.t.Helper()
+	require.Equal(m.t, m.expectedSearchQuery, query)
+	return m.returnSearchResults, m.returnError
+}
+
+func (m mockCompaniesRepository) Update(ctx context.Context, company repositories.CompanyUpdate) (repositories.Company, error) {
 	m.t.Helper()
 	require.Equal(m.t, m.expectedCompanyUpdate, company)
-	return m.returnError
+	return m.returnUpdated, m.returnError
 }
 
-func (m mockCompaniesRepository) Delete(ctx context.Context, id string) error {
+func (m mockCompaniesRepository) Delete(ctx context.Context, id string, version int64) error {
 	m.t.Helper()
 
 	require.Equal(m.t, m.expectedId, id)
+	require.Equal(m.t, m.expectedVersion, version)
 	return m.returnError
 }
+
+func (m mockCompaniesRepository) Restore(ctx context.Context, id string) (repositories.Company, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedId, id)
+	return m.returnCompany, m.returnError
+}
+
+func (m mockCompaniesRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	m.t.Helper()
+
+	require.WithinDuration(m.t, m.expectedDeletedBefore, deletedBefore, time.Second)
+	return m.returnPurged, m.returnError
+}
+
+// mockConcurrentRepository returns the reads one by one, the update is applied only to the current company
+type mockConcurrentRepository struct {
+	mockCompaniesRepository
+	reads           []repositories.Company
+	current         repositories.Company
+	writtenVersions []int64
+}
+
+func (m *mockConcurrentRepository) Get(ctx context.Context, id string) (repositories.Company, error) {
+	m.t.Helper()
+	require.Equal(m.t, m.expectedId, id)
+
+	read := m.reads[0]
+	m.reads = m.reads[1:]
+	return read, nil
+}
+
+func (m *mockConcurrentRepository) Update(ctx context.Context, company repositories.CompanyUpdate) (repositories.Company, error) {
+	m.writtenVersions = append(m.writtenVersions, company.Version)
+	if company.Version != m.current.Version {
+		return repositories.Company{}, repositories.ErrVersionMismatch{}
+	}
+
+	m.current.Type = company.Type
+	m.current.Version++
+	return m.current, nil
+}
+
+// mockVersionMismatchRepository finds the company but fails to update it because of another version
+type mockVersionMismatchRepository struct {
+	mockCompaniesRepository
+}
+
+func (m mockVersionMismatchRepository) Update(ctx context.Context, company repositories.CompanyUpdate) (repositories.Company, error) {
+	m.t.Helper()
+	require.Equal(m.t, m.expectedCompanyUpdate, company)
+	return repositories.Company{}, repositories.ErrVersionMismatch{}
+}
@@ -24,6 +24,25 @@ func (ErrDbDuplicatedKey) Error() string {
 	return "db duplicated key"
 }
 
+type ErrVersionMismatch struct{}
+
+func (ErrVersionMismatch) Error() string {
+	return "version mismatch"
+}
+
+// ErrConcurrentUpdate is returned when unconditional update keeps failing because the company is changed concurrently
+type ErrConcurrentUpdate struct{}
+
+func (ErrConcurrentUpdate) Error() string {
+	return "company is changed concurrently"
+}
+
+type ErrInvalidCursor struct{}
+
+func (ErrInvalidCursor) Error() string {
+	return "invalid cursor"
+}
+
 func handleError(err error) error {
 	if err == nil {
 		return nil
@@ -34,6 +53,10 @@ func handleError(err error) error {
 		return errors.Join(ErrNotFound{}, err)
 	case errors.As(err, &repositories.ErrDuplicatedKey{}):
 		return errors.Join(ErrDbDuplicatedKey{}, err)
+	case errors.As(err, &repositories.ErrVersionMismatch{}):
+		return errors.Join(ErrVersionMismatch{}, err)
+	case errors.As(err, &repositories.ErrInvalidCursor{}):
+		return errors.Join(ErrInvalidCursor{}, err)
 	default:
 		return errors.Join(ErrDb{}, err)
 	}
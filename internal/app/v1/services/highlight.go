@@ -0,0 +1,121 @@
+package services
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	highlightOpenTag  = "<em>"
+	highlightCloseTag = "</em>"
+
+	// snippetLength is maximum length of the description snippet in runes
+	snippetLength = 160
+	// snippetLeading is amount of runes kept before the first match in the snippet
+	snippetLeading  = 40
+	snippetEllipsis = "…"
+)
+
+// searchTerms extracts lower cased words of the search query, excluded terms (prefixed by '-') are skipped
+func searchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+
+		terms = append(terms, strings.FieldsFunc(strings.ToLower(field), func(r rune) bool {
+			return !isWordRune(r)
+		})...)
+	}
+
+	return terms
+}
+
+// highlight escapes text and wraps every word starting with one of the terms into <em> tags,
+// it returns false if nothing matched
+func highlight(text string, terms []string) (string, bool) {
+	var sb strings.Builder
+	matched := false
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) == isWordRune(runes[i]) {
+			j++
+		}
+
+		part := string(runes[i:j])
+		if isWordRune(runes[i]) && matchesTerm(part, terms) {
+			matched = true
+			sb.WriteString(highlightOpenTag + html.EscapeString(part) + highlightCloseTag)
+		} else {
+			sb.WriteString(html.EscapeString(part))
+		}
+		i = j
+	}
+
+	return sb.String(), matched
+}
+
+// snippet cuts the part of the text around the first matched word and highlights it
+func snippet(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+	first := firstMatch(runes, terms)
+	if first < 0 {
+		return "", false
+	}
+
+	if len(runes) <= snippetLength {
+		return highlight(text, terms)
+	}
+
+	start := max(first-snippetLeading, 0)
+	// do not cut the word at the beginning of the snippet
+	for start > 0 && isWordRune(runes[start-1]) {
+		start--
+	}
+	end := min(start+snippetLength, len(runes))
+
+	res, _ := highlight(string(runes[start:end]), terms)
+	if start > 0 {
+		res = snippetEllipsis + res
+	}
+	if end < len(runes) {
+		res += snippetEllipsis
+	}
+
+	return res, true
+}
+
+// firstMatch returns position of the first matched word in runes or -1 if there is no match
+func firstMatch(runes []rune, terms []string) int {
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+
+		if j > i && matchesTerm(string(runes[i:j]), terms) {
+			return i
+		}
+		i = j + 1
+	}
+
+	return -1
+}
+
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+type HistoryRepository interface {
+	Add(ctx context.Context, entry repositories.HistoryEntry) error
+	List(ctx context.Context, query repositories.HistoryQuery) (repositories.HistoryPage, error)
+	Last(ctx context.Context, companyID string, at time.Time) (repositories.HistoryEntry, error)
+}
+
+// WithHistory enables recording of the companies changes
+func WithHistory(history HistoryRepository) Option {
+	return func(s *CompaniesService) {
+		s.history = history
+	}
+}
+
+func (s CompaniesService) History(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+	if s.history == nil {
+		return HistoryPage{}, nil
+	}
+
+	query.Limit = s.pageLimit(query.Limit)
+	res, err := s.history.List(ctx, RepositoryHistoryQuery(query))
+	if err != nil {
+		return HistoryPage{}, handleError(err)
+	}
+
+	return HistoryPageFromRepository(res), nil
+}
+
+// GetAsOf reconstructs the company as it was at the given time from the snapshot of its latest revision
+func (s CompaniesService) GetAsOf(ctx context.Context, id string, asOf time.Time) (Company, error) {
+	if s.history == nil {
+		return Company{}, ErrNotFound{}
+	}
+
+	res, err := s.history.Last(ctx, id, asOf)
+	if err != nil {
+		return Company{}, handleError(err)
+	}
+
+	// the company had been deleted by that time or its revision was recorded without a snapshot
+	if res.Action == ActionDelete || res.Snapshot == nil {
+		return Company{}, ErrNotFound{}
+	}
+
+	return CompanyFromRepository(*res.Snapshot), nil
+}
+
+// record adds the change to the company history with the state of the company after the change,
+// failure is only logged because the change is already applied
+func (s CompaniesService) record(ctx context.Context, action, companyID string, changes []FieldChange, snapshot *Company) {
+	if s.history == nil {
+		return
+	}
+
+	entry := HistoryEntry{
+		CompanyID: companyID,
+		Action:    action,
+		Actor:     reqctx.Actor(ctx),
+		RequestID: reqctx.RequestID(ctx),
+		Timestamp: time.Now().UTC().Truncate(time.Millisecond),
+		Changes:   changes,
+		Snapshot:  snapshot,
+	}
+
+	if err := s.history.Add(ctx, RepositoryHistoryEntry(entry)); err != nil {
+		slog.Error("failed to record company history", "company_id", companyID, "action", action, "error", err.Error())
+	}
+}
+
+// diffCompanies returns fields which values differ, nil before means the company has been created
+func diffCompanies(before *Company, after Company) []FieldChange {
+	var previous *repositories.Company
+	if before != nil {
+		company := RepositoryCompany(*before)
+		previous = &company
+	}
+
+	var changes []FieldChange
+	for _, c := range repositories.DiffCompanies(previous, RepositoryCompany(after)) {
+		changes = append(changes, FieldChange{Field: c.Field, Before: c.Before, After: c.After})
+	}
+	return changes
+}
@@ -0,0 +1,259 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/services"
+	"github.com/AndreyShep2012/go-company-handler/internal/reqctx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompaniesHistoryRecording(t *testing.T) {
+	ctx := reqctx.WithRequestID(reqctx.WithActor(context.Background(), "user"), "request")
+
+	t.Run("create", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:               t,
+			expectedCompany: createTestRepoCompany(),
+			returnCompany:   createTestRepoCompany(),
+		}
+		history := &mockHistoryRepository{t: t}
+
+		service := services.NewCompaniesService(repo, services.WithHistory(history))
+		_, err := service.Create(ctx, createTestCompany())
+		require.NoError(t, err)
+
+		require.Len(t, history.added, 1)
+		entry := history.added[0]
+		require.Equal(t, "id", entry.CompanyID)
+		require.Equal(t, services.ActionCreate, entry.Action)
+		require.Equal(t, "user", entry.Actor)
+		require.Equal(t, "request", entry.RequestID)
+		require.False(t, entry.Timestamp.IsZero())
+		require.Equal(t, []repositories.FieldChange{
+			{Field: "name", After: "test"},
+			{Field: "description", After: "test description"},
+			{Field: "amount_of_employees", After: 1},
+			{Field: "registered", After: true},
+			{Field: "type", After: "test"},
+		}, entry.Changes)
+		require.Equal(t, createTestRepoCompany(), *entry.Snapshot)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		updated := createTestRepoCompany()
+		updated.Name = "new name"
+		updated.Registered = false
+
+		expectedCompanyUpdate := createTestRepoCompanyUpdate()
+		expectedCompanyUpdate.Version = repositories.VersionUnset
+		repo := mockCompaniesRepository{
+			t:                     t,
+			expectedId:            "id",
+			expectedCompanyUpdate: expectedCompanyUpdate,
+			returnCompany:         createTestRepoCompany(),
+			returnUpdated:         updated,
+		}
+		history := &mockHistoryRepository{t: t}
+
+		service := services.NewCompaniesService(repo, services.WithHistory(history))
+		_, err := service.Update(ctx, createTestCompanyUpdate())
+		require.NoError(t, err)
+
+		require.Len(t, history.added, 1)
+		require.Equal(t, services.ActionUpdate, history.added[0].Action)
+		require.Equal(t, []repositories.FieldChange{
+			{Field: "name", Before: "test", After: "new name"},
+			{Field: "registered", Before: true, After: false},
+		}, history.added[0].Changes)
+		require.Equal(t, updated, *history.added[0].Snapshot)
+	})
+
+	t.Run("update failed", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:                     t,
+			expectedId:            "id",
+			expectedCompanyUpdate: createTestRepoCompanyUpdate(),
+			returnError:           repositories.ErrNotFound{},
+		}
+		history := &mockHistoryRepository{t: t}
+
+		service := services.NewCompaniesService(repo, services.WithHistory(history))
+		_, err := service.Update(ctx, createTestCompanyUpdate())
+		require.ErrorAs(t, err, &services.ErrNotFound{})
+		require.Empty(t, history.added)
+	})
+
+	t.Run("delete and restore", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:             t,
+			expectedId:    "id",
+			returnCompany: createTestRepoCompany(),
+		}
+		history := &mockHistoryRepository{t: t}
+
+		service := services.NewCompaniesService(repo, services.WithHistory(history))
+		err := service.Delete(ctx, "id", 0)
+		require.NoError(t, err)
+		_, err = service.Restore(ctx, "id")
+		require.NoError(t, err)
+
+		require.Len(t, history.added, 2)
+		require.Equal(t, services.ActionDelete, history.added[0].Action)
+		require.Empty(t, history.added[0].Changes)
+		require.Nil(t, history.added[0].Snapshot)
+		require.Equal(t, services.ActionRestore, history.added[1].Action)
+		require.Equal(t, createTestRepoCompany(), *history.added[1].Snapshot)
+	})
+
+	t.Run("history error does not fail the change", func(t *testing.T) {
+		repo := mockCompaniesRepository{
+			t:          t,
+			expectedId: "id",
+		}
+		history := &mockHistoryRepository{t: t, returnError: errors.New("error")}
+
+		service := services.NewCompaniesService(repo, services.WithHistory(history))
+		err := service.Delete(ctx, "id", 0)
+		require.NoError(t, err)
+	})
+}
+
+func TestCompaniesHistory(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		history := &mockHistoryRepository{
+			t:             t,
+			expectedQuery: repositories.HistoryQuery{CompanyID: "id", Cursor: "cursor", Limit: services.DefaultPageLimit},
+			returnPage: repositories.HistoryPage{
+				Entries:    []repositories.HistoryEntry{{ID: "1", CompanyID: "id", Action: services.ActionDelete}},
+				NextCursor: "next",
+			},
+		}
+
+		service := services.NewCompaniesService(mockCompaniesRepository{t: t}, services.WithHistory(history))
+		page, err := service.History(context.Background(), services.HistoryQuery{CompanyID: "id", Cursor: "cursor"})
+		require.NoError(t, err)
+		require.Equal(t, services.HistoryPage{
+			Entries:    []services.HistoryEntry{{ID: "1", CompanyID: "id", Action: services.ActionDelete}},
+			NextCursor: "next",
+		}, page)
+	})
+
+	t.Run("invalid cursor error", func(t *testing.T) {
+		history := &mockHistoryRepository{
+			t:             t,
+			expectedQuery: repositories.HistoryQuery{CompanyID: "id", Cursor: "broken", Limit: services.DefaultPageLimit},
+			returnError:   repositories.ErrInvalidCursor{},
+		}
+
+		service := services.NewCompaniesService(mockCompaniesRepository{t: t}, services.WithHistory(history))
+		_, err := service.History(context.Background(), services.HistoryQuery{CompanyID: "id", Cursor: "broken"})
+		require.ErrorAs(t, err, &services.ErrInvalidCursor{})
+	})
+
+	t.Run("history is disabled", func(t *testing.T) {
+		service := services.NewCompaniesService(mockCompaniesRepository{t: t})
+		page, err := service.History(context.Background(), services.HistoryQuery{CompanyID: "id"})
+		require.NoError(t, err)
+		require.Empty(t, page.Entries)
+	})
+}
+
+func TestCompaniesGetAsOf(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("success", func(t *testing.T) {
+		snapshot := createTestRepoCompany()
+		history := &mockHistoryRepository{
+			t:           t,
+			expectedId:  "id",
+			expectedAt:  at,
+			returnEntry: repositories.HistoryEntry{CompanyID: "id", Action: services.ActionUpdate, Snapshot: &snapshot},
+		}
+
+		service := services.NewCompaniesService(mockCompaniesRepository{t: t}, services.WithHistory(history))
+		company, err := service.GetAsOf(context.Background(), "id", at)
+		require.NoError(t, err)
+		require.Equal(t, createTestCompany(), company)
+	})
+
+	t.Run("deleted by that time", func(t *testing.T) {
+		history := &mockHistoryRepository{
+			t:           t,
+			expectedId:  "id",
+			expectedAt:  at,
+			returnEntry: repositories.HistoryEntry{CompanyID: "id", Action: services.ActionDelete},
+		}
+
+		service := services.NewCompaniesService(mockCompaniesRepository{t: t}, services.WithHistory(history))
+		_, err := service.GetAsOf(context.Background(), "id", at)
+		require.ErrorAs(t, err, &services.ErrNotFound{})
+	})
+
+	t.Run("not created by that time", func(t *testing.T) {
+		history := &mockHistoryRepository{
+			t:           t,
+			expectedId:  "id",
+			expectedAt:  at,
+			returnError: repositories.ErrNotFound{},
+		}
+
+		service := services.NewCompaniesService(mockCompaniesRepository{t: t}, services.WithHistory(history))
+		_, err := service.GetAsOf(context.Background(), "id", at)
+		require.ErrorAs(t, err, &services.ErrNotFound{})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		history := &mockHistoryRepository{
+			t:           t,
+			expectedId:  "id",
+			expectedAt:  at,
+			returnError: errors.New("error"),
+		}
+
+		service := services.NewCompaniesService(mockCompaniesRepository{t: t}, services.WithHistory(history))
+		_, err := service.GetAsOf(context.Background(), "id", at)
+		require.ErrorAs(t, err, &services.ErrDb{})
+	})
+
+	t.Run("history is disabled", func(t *testing.T) {
+		service := services.NewCompaniesService(mockCompaniesRepository{t: t})
+		_, err := service.GetAsOf(context.Background(), "id", at)
+		require.ErrorAs(t, err, &services.ErrNotFound{})
+	})
+}
+
+type mockHistoryRepository struct {
+	t             *testing.T
+	expectedQuery repositories.HistoryQuery
+	expectedId    string
+	expectedAt    time.Time
+	returnPage    repositories.HistoryPage
+	returnEntry   repositories.HistoryEntry
+	returnError   error
+	added         []repositories.HistoryEntry
+}
+
+func (m *mockHistoryRepository) Add(ctx context.Context, entry repositories.HistoryEntry) error {
+	m.added = append(m.added, entry)
+	return m.returnError
+}
+
+func (m *mockHistoryRepository) List(ctx context.Context, query repositories.HistoryQuery) (repositories.HistoryPage, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedQuery, query)
+	return m.returnPage, m.returnError
+}
+
+func (m *mockHistoryRepository) Last(ctx context.Context, companyID string, at time.Time) (repositories.HistoryEntry, error) {
+	m.t.Helper()
+
+	require.Equal(m.t, m.expectedId, companyID)
+	require.Equal(m.t, m.expectedAt, at)
+	return m.returnEntry, m.returnError
+}
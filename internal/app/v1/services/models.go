@@ -1,6 +1,10 @@
 package services
 
-import "github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+import (
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+)
 
 type Company struct {
 	ID                string
@@ -9,8 +13,16 @@ type Company struct {
 	AmountOfEmployees int
 	Registered        bool
 	Type              string
+	Version           int64
+	CreatedAt         time.Time
+	CreatedBy         string
+	UpdatedAt         time.Time
+	UpdatedBy         string
 }
 
+// VersionUnset is expected version of the company which has no version yet, as the ones created before versioning
+const VersionUnset = repositories.VersionUnset
+
 type CompanyUpdate struct {
 	ID                string
 	Name              string
@@ -18,6 +30,87 @@ type CompanyUpdate struct {
 	AmountOfEmployees int
 	Registered        *bool
 	Type              string
+	// Version is expected current version of the company, zero means the update is unconditional
+	// and VersionUnset means the company should have no version
+	Version int64
+}
+
+type CompanyFilter struct {
+	Type          string
+	Registered    *bool
+	MinEmployees  *int
+	MaxEmployees  *int
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	CreatedBy     string
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	UpdatedBy     string
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+type ListQuery struct {
+	Cursor string
+	Limit  int
+	Filter CompanyFilter
+	Sort   []SortField
+}
+
+type CompaniesPage struct {
+	Companies  []Company
+	NextCursor string
+}
+
+type SearchQuery struct {
+	Text  string
+	Limit int
+}
+
+type SearchResult struct {
+	Company
+	Score float64
+	// Highlights keeps escaped field values with matched words wrapped into <em> tags
+	Highlights map[string]string
+}
+
+type HistoryEntry struct {
+	ID        string
+	CompanyID string
+	Action    string
+	Actor     string
+	RequestID string
+	Timestamp time.Time
+	Changes   []FieldChange
+	Snapshot  *Company
+}
+
+// CompanyChange is the company state after the change and the fields the change has modified,
+// every field is modified when the company has been created
+type CompanyChange struct {
+	Company Company
+	Changes []FieldChange
+	Created bool
+}
+
+type FieldChange struct {
+	Field  string
+	Before any
+	After  any
+}
+
+type HistoryQuery struct {
+	CompanyID string
+	Cursor    string
+	Limit     int
+}
+
+type HistoryPage struct {
+	Entries    []HistoryEntry
+	NextCursor string
 }
 
 func CompanyFromRepository(company repositories.Company) Company {
@@ -28,6 +121,11 @@ func CompanyFromRepository(company repositories.Company) Company {
 		AmountOfEmployees: company.AmountOfEmployees,
 		Registered:        company.Registered,
 		Type:              company.Type,
+		Version:           company.Version,
+		CreatedAt:         company.CreatedAt,
+		CreatedBy:         company.CreatedBy,
+		UpdatedAt:         company.UpdatedAt,
+		UpdatedBy:         company.UpdatedBy,
 	}
 }
 
@@ -39,6 +137,11 @@ func RepositoryCompany(company Company) repositories.Company {
 		AmountOfEmployees: company.AmountOfEmployees,
 		Registered:        company.Registered,
 		Type:              company.Type,
+		Version:           company.Version,
+		CreatedAt:         company.CreatedAt,
+		CreatedBy:         company.CreatedBy,
+		UpdatedAt:         company.UpdatedAt,
+		UpdatedBy:         company.UpdatedBy,
 	}
 }
 
@@ -50,5 +153,115 @@ func RepositoryCompanyUpdate(company CompanyUpdate) repositories.CompanyUpdate {
 		AmountOfEmployees: company.AmountOfEmployees,
 		Registered:        company.Registered,
 		Type:              company.Type,
+		Version:           company.Version,
+	}
+}
+
+func CompaniesPageFromRepository(page repositories.CompaniesPage) CompaniesPage {
+	companies := make([]Company, 0, len(page.Companies))
+	for _, company := range page.Companies {
+		companies = append(companies, CompanyFromRepository(company))
+	}
+
+	return CompaniesPage{
+		Companies:  companies,
+		NextCursor: page.NextCursor,
+	}
+}
+
+func RepositoryListQuery(query ListQuery) repositories.ListQuery {
+	var sort []repositories.SortField
+	for _, s := range query.Sort {
+		sort = append(sort, repositories.SortField{Field: s.Field, Desc: s.Desc})
+	}
+
+	return repositories.ListQuery{
+		Cursor: query.Cursor,
+		Limit:  query.Limit,
+		Filter: RepositoryCompanyFilter(query.Filter),
+		Sort:   sort,
+	}
+}
+
+func RepositoryCompanyFilter(filter CompanyFilter) repositories.CompanyFilter {
+	return repositories.CompanyFilter{
+		Type:          filter.Type,
+		Registered:    filter.Registered,
+		MinEmployees:  filter.MinEmployees,
+		MaxEmployees:  filter.MaxEmployees,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		CreatedBy:     filter.CreatedBy,
+		UpdatedAfter:  filter.UpdatedAfter,
+		UpdatedBefore: filter.UpdatedBefore,
+		UpdatedBy:     filter.UpdatedBy,
+	}
+}
+
+func RepositoryHistoryEntry(entry HistoryEntry) repositories.HistoryEntry {
+	var changes []repositories.FieldChange
+	for _, c := range entry.Changes {
+		changes = append(changes, repositories.FieldChange{Field: c.Field, Before: c.Before, After: c.After})
+	}
+
+	var snapshot *repositories.Company
+	if entry.Snapshot != nil {
+		company := RepositoryCompany(*entry.Snapshot)
+		snapshot = &company
+	}
+
+	return repositories.HistoryEntry{
+		ID:        entry.ID,
+		CompanyID: entry.CompanyID,
+		Action:    entry.Action,
+		Actor:     entry.Actor,
+		RequestID: entry.RequestID,
+		Timestamp: entry.Timestamp,
+		Changes:   changes,
+		Snapshot:  snapshot,
+	}
+}
+
+func HistoryEntryFromRepository(entry repositories.HistoryEntry) HistoryEntry {
+	var changes []FieldChange
+	for _, c := range entry.Changes {
+		changes = append(changes, FieldChange{Field: c.Field, Before: c.Before, After: c.After})
+	}
+
+	var snapshot *Company
+	if entry.Snapshot != nil {
+		company := CompanyFromRepository(*entry.Snapshot)
+		snapshot = &company
+	}
+
+	return HistoryEntry{
+		ID:        entry.ID,
+		CompanyID: entry.CompanyID,
+		Action:    entry.Action,
+		Actor:     entry.Actor,
+		RequestID: entry.RequestID,
+		Timestamp: entry.Timestamp,
+		Changes:   changes,
+		Snapshot:  snapshot,
+	}
+}
+
+func RepositoryHistoryQuery(query HistoryQuery) repositories.HistoryQuery {
+	return repositories.HistoryQuery{
+		CompanyID: query.CompanyID,
+		Cursor:    query.Cursor,
+		Limit:     query.Limit,
+	}
+}
+
+func HistoryPageFromRepository(page repositories.HistoryPage) HistoryPage {
+	entries := make([]HistoryEntry, 0, len(page.Entries))
+	for _, entry := range page.Entries {
+		entries = append(entries, HistoryEntryFromRepository(entry))
+	}
+
+	return HistoryPage{
+		Entries:    entries,
+		NextCursor: page.NextCursor,
 	}
 }
@@ -0,0 +1,15 @@
+// Package backoff computes delays between retries of failed operations
+package backoff
+
+import "time"
+
+// Exponential returns delay before the next attempt after the given number of failures in a row,
+// the delay starts at minDelay and is doubled for every next failure up to maxDelay
+func Exponential(minDelay, maxDelay time.Duration, failures int) time.Duration {
+	delay := minDelay
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxDelay)
+}
@@ -0,0 +1,27 @@
+package backoff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/backoff"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExponential(t *testing.T) {
+	t.Run("starts at min delay", func(t *testing.T) {
+		require.Equal(t, time.Second, backoff.Exponential(time.Second, time.Minute, 0))
+		require.Equal(t, time.Second, backoff.Exponential(time.Second, time.Minute, 1))
+	})
+
+	t.Run("doubles for every failure", func(t *testing.T) {
+		require.Equal(t, 2*time.Second, backoff.Exponential(time.Second, time.Minute, 2))
+		require.Equal(t, 8*time.Second, backoff.Exponential(time.Second, time.Minute, 4))
+	})
+
+	t.Run("capped at max delay", func(t *testing.T) {
+		require.Equal(t, time.Minute, backoff.Exponential(time.Second, time.Minute, 7))
+		require.Equal(t, time.Minute, backoff.Exponential(time.Second, time.Minute, 1000))
+		require.Equal(t, time.Minute, backoff.Exponential(2*time.Minute, time.Minute, 1))
+	})
+}
@@ -0,0 +1,161 @@
+// Package broadcast fans company events out to in-process subscribers
+package broadcast
+
+import (
+	"sync"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+)
+
+const (
+	DefaultBufferSize = 1000
+	// DefaultSubscriberBuffer is how many events can wait for a subscriber before it is dropped
+	DefaultSubscriberBuffer = 64
+)
+
+// Broadcaster sends every event to all subscribers and keeps the latest events in the bounded buffer,
+// so subscriber can resume after the last event it has got. Slow subscriber is dropped instead of
+// blocking the publisher, it can subscribe again from its last event
+type Broadcaster struct {
+	mu sync.Mutex
+	// buffer is the ring of the latest events, start is index of the oldest one
+	buffer           []events.Event
+	start            int
+	count            int
+	subscribers      map[*Subscription]struct{}
+	subscriberBuffer int
+	closed           bool
+}
+
+// Subscription receives events published after it was created, C is closed when the subscription is dropped
+type Subscription struct {
+	C  <-chan events.Event
+	ch chan events.Event
+}
+
+type Option func(*Broadcaster)
+
+// WithSubscriberBuffer sets how many events can wait for a subscriber before it is dropped
+func WithSubscriberBuffer(size int) Option {
+	return func(b *Broadcaster) {
+		b.subscriberBuffer = size
+	}
+}
+
+// New returns broadcaster keeping up to bufferSize latest events for resuming subscribers
+func New(bufferSize int, opts ...Option) *Broadcaster {
+	b := &Broadcaster{
+		buffer:           make([]events.Event, bufferSize),
+		subscribers:      map[*Subscription]struct{}{},
+		subscriberBuffer: DefaultSubscriberBuffer,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+func (b *Broadcaster) OnCreateCompany(e events.CompanyCreated) error {
+	b.broadcast(e)
+	return nil
+}
+
+func (b *Broadcaster) OnPatchCompany(e events.CompanyUpdated) error {
+	b.broadcast(e)
+	return nil
+}
+
+func (b *Broadcaster) OnDeleteCompany(e events.CompanyDeleted) error {
+	b.broadcast(e)
+	return nil
+}
+
+// Subscribe returns buffered events published after the event with lastEventID and subscription to the next
+// events, nothing is missed in between. All buffered events are returned when the last event is not
+// in the buffer anymore, none when lastEventID is empty. Closed broadcaster returns closed subscription
+func (b *Broadcaster) Subscribe(lastEventID string) ([]events.Event, *Subscription) {
+	ch := make(chan events.Event, b.subscriberBuffer)
+	s := &Subscription{C: ch, ch: ch}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return nil, s
+	}
+
+	b.subscribers[s] = struct{}{}
+	if lastEventID == "" {
+		return nil, s
+	}
+
+	missed := b.buffered()
+	for i, e := range missed {
+		if e.Meta().ID == lastEventID {
+			return missed[i+1:], s
+		}
+	}
+
+	return missed, s
+}
+
+// Unsubscribe stops sending events to the subscription and closes it
+func (b *Broadcaster) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.drop(s)
+}
+
+// Close closes all subscriptions, events published after it are only buffered
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subscribers {
+		b.drop(s)
+	}
+}
+
+func (b *Broadcaster) broadcast(e events.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.buffer) > 0 {
+		if b.count < len(b.buffer) {
+			b.count++
+		} else {
+			b.start = (b.start + 1) % len(b.buffer)
+		}
+		b.buffer[(b.start+b.count-1)%len(b.buffer)] = e
+	}
+
+	for s := range b.subscribers {
+		select {
+		case s.ch <- e:
+		default:
+			b.drop(s)
+		}
+	}
+}
+
+// buffered returns buffered events from the oldest one
+func (b *Broadcaster) buffered() []events.Event {
+	result := make([]events.Event, 0, b.count)
+	for i := range b.count {
+		result = append(result, b.buffer[(b.start+i)%len(b.buffer)])
+	}
+
+	return result
+}
+
+func (b *Broadcaster) drop(s *Subscription) {
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.ch)
+	}
+}
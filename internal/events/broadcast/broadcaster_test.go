@@ -0,0 +1,104 @@
+package broadcast_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/broadcast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcaster(t *testing.T) {
+	t.Run("sends events to all subscribers", func(t *testing.T) {
+		b := broadcast.New(10)
+		_, first := b.Subscribe("")
+		_, second := b.Subscribe("")
+
+		require.NoError(t, b.OnCreateCompany(created(1)))
+		require.NoError(t, b.OnPatchCompany(events.CompanyUpdated{Metadata: events.Metadata{ID: "2"}}))
+		require.NoError(t, b.OnDeleteCompany(events.CompanyDeleted{Metadata: events.Metadata{ID: "3"}}))
+
+		for _, s := range []*broadcast.Subscription{first, second} {
+			require.Equal(t, []string{"1", "2", "3"}, receive(s, 3))
+		}
+
+		b.Unsubscribe(first)
+		_, ok := <-first.C
+		require.False(t, ok)
+
+		require.NoError(t, b.OnCreateCompany(created(4)))
+		require.Equal(t, []string{"4"}, receive(second, 1))
+	})
+
+	t.Run("resumes from the buffer", func(t *testing.T) {
+		b := broadcast.New(3)
+		for i := 1; i <= 5; i++ {
+			require.NoError(t, b.OnCreateCompany(created(i)))
+		}
+
+		missed, _ := b.Subscribe("4")
+		require.Equal(t, []string{"5"}, ids(missed))
+
+		missed, _ = b.Subscribe("5")
+		require.Empty(t, missed)
+
+		// the event is dropped from the buffer
+		missed, _ = b.Subscribe("1")
+		require.Equal(t, []string{"3", "4", "5"}, ids(missed))
+
+		missed, s := b.Subscribe("")
+		require.Empty(t, missed)
+		require.NoError(t, b.OnCreateCompany(created(6)))
+		require.Equal(t, []string{"6"}, receive(s, 1))
+	})
+
+	t.Run("drops slow subscriber", func(t *testing.T) {
+		b := broadcast.New(10, broadcast.WithSubscriberBuffer(2))
+		_, s := b.Subscribe("")
+
+		for i := 1; i <= 3; i++ {
+			require.NoError(t, b.OnCreateCompany(created(i)))
+		}
+
+		require.Equal(t, []string{"1", "2"}, receive(s, 2))
+		_, ok := <-s.C
+		require.False(t, ok)
+
+		missed, _ := b.Subscribe("2")
+		require.Equal(t, []string{"3"}, ids(missed))
+	})
+
+	t.Run("close", func(t *testing.T) {
+		b := broadcast.New(10)
+		_, s := b.Subscribe("")
+		b.Close()
+
+		_, ok := <-s.C
+		require.False(t, ok)
+
+		_, s = b.Subscribe("")
+		_, ok = <-s.C
+		require.False(t, ok)
+	})
+}
+
+func created(id int) events.CompanyCreated {
+	return events.CompanyCreated{Metadata: events.Metadata{ID: strconv.Itoa(id)}}
+}
+
+func receive(s *broadcast.Subscription, n int) []string {
+	var received []events.Event
+	for range n {
+		received = append(received, <-s.C)
+	}
+	return ids(received)
+}
+
+func ids(received []events.Event) []string {
+	result := make([]string, 0, len(received))
+	for _, e := range received {
+		result = append(result, e.Meta().ID)
+	}
+	return result
+}
@@ -0,0 +1,201 @@
+// Package changestream publishes company events of the changes read from the companies collection change stream
+package changestream
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repoevents"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/backoff"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+)
+
+const (
+	// DefaultName identifies the resume token of the watcher
+	DefaultName       = "companies"
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = time.Minute
+)
+
+type Source interface {
+	Watch(ctx context.Context, resumeToken []byte, handle func(repositories.CompanyChange) error) error
+}
+
+type TokenStore interface {
+	Load(ctx context.Context, name string) ([]byte, error)
+	Save(ctx context.Context, name string, token []byte) error
+}
+
+type Publisher interface {
+	OnCreateCompany(e events.CompanyCreated) error
+	OnPatchCompany(e events.CompanyUpdated) error
+	OnDeleteCompany(e events.CompanyDeleted) error
+}
+
+// Watcher publishes events of every change of the companies, no matter whether it was made by the service,
+// a migration or a script. Resume token is saved only after the event has been published, so watching
+// continues after restart or failure from the first change which is not published. Such change can be
+// published again, it has the same event id then, so consumers can recognise it
+type Watcher struct {
+	source     Source
+	tokens     TokenStore
+	publisher  Publisher
+	name       string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Watcher)
+
+// WithName sets name the resume token is saved with, watchers publishing to different publishers need different names
+func WithName(name string) Option {
+	return func(w *Watcher) {
+		w.name = name
+	}
+}
+
+// WithBackoff sets delay before watching is restarted after failure, the delay is doubled
+// for every next failure in a row up to maxBackoff
+func WithBackoff(minBackoff, maxBackoff time.Duration) Option {
+	return func(w *Watcher) {
+		w.minBackoff = minBackoff
+		w.maxBackoff = maxBackoff
+	}
+}
+
+func NewWatcher(source Source, tokens TokenStore, publisher Publisher, opts ...Option) *Watcher {
+	w := &Watcher{
+		source:     source,
+		tokens:     tokens,
+		publisher:  publisher,
+		name:       DefaultName,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Run publishes events of the changes until ctx is done, failed watching is restarted from the saved resume token.
+// Watching is restarted from now when the changes after the token are not kept anymore, changes which can not
+// be read are skipped, both are logged
+func (w *Watcher) Run(ctx context.Context) {
+	failures := 0
+	for {
+		err := w.watch(ctx, func() { failures = 0 })
+		if ctx.Err() != nil {
+			return
+		}
+
+		failures++
+		delay := backoff.Exponential(w.minBackoff, w.maxBackoff, failures)
+		slog.Error("failed to watch companies changes", "failures", failures, "retry_in", delay.String(), "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watch publishes events of the changes after the saved resume token, published is called after every published change
+func (w *Watcher) watch(ctx context.Context, published func()) error {
+	token, err := w.tokens.Load(ctx, w.name)
+	if err != nil && !errors.As(err, &repositories.ErrNotFound{}) {
+		return err
+	}
+	if token == nil {
+		slog.Info("no resume token is saved, watching companies changes from now", "name", w.name)
+	}
+
+	handle := func(change repositories.CompanyChange) error {
+		if change.Err != nil {
+			slog.Warn("skipping companies change which can not be read", "id", change.ID, "operation", change.Operation, "error", change.Err.Error())
+		} else if err := w.publish(change); err != nil {
+			return err
+		}
+		if err := w.tokens.Save(ctx, w.name, change.Token); err != nil {
+			return err
+		}
+
+		published()
+		return nil
+	}
+
+	err = w.source.Watch(ctx, token, handle)
+	if token != nil && errors.As(err, &repositories.ErrHistoryLost{}) {
+		// retrying with the same token fails forever
+		slog.Warn("changes after the saved resume token are lost, watching companies changes from now", "name", w.name, "error", err.Error())
+		return w.source.Watch(ctx, nil, handle)
+	}
+
+	return err
+}
+
+// publish sends event of the change, the change id is used as the event id. Soft deleting the company
+// is published as deleted event and restoring it as created one, changes of deleted companies are not published
+func (w *Watcher) publish(change repositories.CompanyChange) error {
+	meta := events.Metadata{ID: change.ID, Time: change.Time}
+
+	switch change.Operation {
+	case repositories.OperationInsert:
+		if change.Company == nil || change.Company.DeletedAt != nil {
+			return nil
+		}
+		return w.publisher.OnCreateCompany(events.CompanyCreated{Metadata: meta, Company: repoevents.Company(*change.Company)})
+	case repositories.OperationUpdate, repositories.OperationReplace:
+		// the company has no post-image and is already removed, its delete change follows
+		if change.Company == nil {
+			return nil
+		}
+
+		deleted, wasDeleted := change.Company.DeletedAt != nil, wasDeleted(change)
+		switch {
+		case deleted && wasDeleted:
+			return nil
+		case deleted:
+			return w.publisher.OnDeleteCompany(events.CompanyDeleted{Metadata: meta, CompanyID: change.CompanyID})
+		case wasDeleted:
+			return w.publisher.OnCreateCompany(events.CompanyCreated{Metadata: meta, Company: repoevents.Company(*change.Company)})
+		}
+
+		// the changes are known only when the company before the change is recorded
+		var changes []events.FieldChange
+		if change.Before != nil {
+			changes = repoevents.Changes(repositories.DiffCompanies(change.Before, *change.Company))
+		}
+		return w.publisher.OnPatchCompany(events.CompanyUpdated{Metadata: meta, Company: repoevents.Company(*change.Company), Changes: changes})
+	case repositories.OperationDelete:
+		// deleted company is purged
+		if change.Before != nil && change.Before.DeletedAt != nil {
+			return nil
+		}
+		return w.publisher.OnDeleteCompany(events.CompanyDeleted{Metadata: meta, CompanyID: change.CompanyID})
+	default:
+		return nil
+	}
+}
+
+// wasDeleted checks whether the company was deleted before the change, without the recorded company before
+// the change it is guessed from the fields modified by the update
+func wasDeleted(change repositories.CompanyChange) bool {
+	if change.Before != nil {
+		return change.Before.DeletedAt != nil
+	}
+
+	if slices.Contains(change.RemovedFields, "deleted_at") {
+		return true
+	}
+
+	return change.Operation == repositories.OperationUpdate && change.Company.DeletedAt != nil &&
+		!slices.Contains(change.UpdatedFields, "deleted_at")
+}
@@ -0,0 +1,304 @@
+package changestream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/changestream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	deletedAt := at.Add(time.Hour)
+	company := repositories.Company{ID: "c", Name: "name", Type: "Corporations"}
+	updated := repositories.Company{ID: "c", Name: "name", Type: "NonProfit"}
+	deleted := repositories.Company{ID: "c", Name: "name", Type: "NonProfit", DeletedAt: &deletedAt}
+
+	t.Run("changes are published as events", func(t *testing.T) {
+		source := newMockSource(
+			change("1", repositories.OperationInsert, &company, nil),
+			// pre-image is recorded
+			change("2", repositories.OperationUpdate, &updated, &company),
+			// pre-image is not recorded
+			change("3", repositories.OperationReplace, &updated, nil),
+			withFields(change("4", repositories.OperationUpdate, &deleted, nil), []string{"deleted_at"}, nil),
+			// update of the deleted company
+			withFields(change("5", repositories.OperationUpdate, &deleted, nil), []string{"name"}, nil),
+			withFields(change("6", repositories.OperationUpdate, &updated, nil), nil, []string{"deleted_at"}),
+			change("7", repositories.OperationDelete, nil, nil),
+			// purge of the deleted company
+			change("8", repositories.OperationDelete, nil, &deleted),
+			change("9", "drop", nil, nil),
+		)
+		tokens := newMockTokenStore()
+		publisher := &mockPublisher{}
+
+		runWatcher(t, changestream.NewWatcher(source, tokens, publisher), func() bool {
+			return string(tokens.saved()) == "9"
+		})
+
+		meta := func(id string) events.Metadata {
+			return events.Metadata{ID: id, Time: at}
+		}
+		require.Equal(t, []events.Event{
+			events.CompanyCreated{Metadata: meta("1"), Company: events.Company{ID: "c", Name: "name", Type: "Corporations"}},
+			events.CompanyUpdated{Metadata: meta("2"), Company: events.Company{ID: "c", Name: "name", Type: "NonProfit"},
+				Changes: []events.FieldChange{{Field: "type", Before: "Corporations", After: "NonProfit"}}},
+			events.CompanyUpdated{Metadata: meta("3"), Company: events.Company{ID: "c", Name: "name", Type: "NonProfit"}},
+			events.CompanyDeleted{Metadata: meta("4"), CompanyID: "c"},
+			events.CompanyCreated{Metadata: meta("6"), Company: events.Company{ID: "c", Name: "name", Type: "NonProfit"}},
+			events.CompanyDeleted{Metadata: meta("7"), CompanyID: "c"},
+		}, publisher.events())
+	})
+
+	t.Run("update followed by delete", func(t *testing.T) {
+		// post-image of the update is not deleted, though the company is deleted when the change is read
+		source := newMockSource(
+			withFields(change("1", repositories.OperationUpdate, &updated, nil), []string{"type"}, nil),
+			withFields(change("2", repositories.OperationUpdate, &deleted, &updated), []string{"deleted_at"}, nil),
+		)
+		tokens := newMockTokenStore()
+		publisher := &mockPublisher{}
+
+		runWatcher(t, changestream.NewWatcher(source, tokens, publisher), func() bool {
+			return string(tokens.saved()) == "2"
+		})
+
+		require.Equal(t, []events.Event{
+			events.CompanyUpdated{Metadata: events.Metadata{ID: "1", Time: at}, Company: events.Company{ID: "c", Name: "name", Type: "NonProfit"}},
+			events.CompanyDeleted{Metadata: events.Metadata{ID: "2", Time: at}, CompanyID: "c"},
+		}, publisher.events())
+	})
+
+	t.Run("resumes after the saved token", func(t *testing.T) {
+		source := newMockSource(
+			change("1", repositories.OperationInsert, &company, nil),
+			change("2", repositories.OperationDelete, nil, nil),
+		)
+		tokens := newMockTokenStore()
+		require.NoError(t, tokens.Save(context.Background(), changestream.DefaultName, []byte("1")))
+		publisher := &mockPublisher{}
+
+		runWatcher(t, changestream.NewWatcher(source, tokens, publisher), func() bool {
+			return string(tokens.saved()) == "2"
+		})
+
+		require.Equal(t, []events.Event{events.CompanyDeleted{Metadata: events.Metadata{ID: "2", Time: at}, CompanyID: "c"}}, publisher.events())
+		require.Equal(t, [][]byte{[]byte("1")}, source.resumedFrom())
+	})
+
+	t.Run("change which can not be read is skipped", func(t *testing.T) {
+		unreadable := change("1", repositories.OperationDelete, nil, nil)
+		unreadable.CompanyID, unreadable.Err = "", errors.New("cannot decode objectID into a string type")
+		source := newMockSource(unreadable, change("2", repositories.OperationInsert, &company, nil))
+		tokens := newMockTokenStore()
+		publisher := &mockPublisher{}
+
+		runWatcher(t, changestream.NewWatcher(source, tokens, publisher), func() bool {
+			return string(tokens.saved()) == "2"
+		})
+
+		require.Equal(t, []events.Event{
+			events.CompanyCreated{Metadata: events.Metadata{ID: "2", Time: at}, Company: events.Company{ID: "c", Name: "name", Type: "Corporations"}},
+		}, publisher.events())
+		require.Equal(t, [][]byte{nil}, source.resumedFrom())
+	})
+
+	t.Run("watches from now when history after the saved token is lost", func(t *testing.T) {
+		source := newMockSource(change("2", repositories.OperationInsert, &company, nil))
+		source.lost = "1"
+		tokens := newMockTokenStore()
+		require.NoError(t, tokens.Save(context.Background(), changestream.DefaultName, []byte("1")))
+		publisher := &mockPublisher{}
+
+		runWatcher(t, changestream.NewWatcher(source, tokens, publisher), func() bool {
+			return string(tokens.saved()) == "2"
+		})
+
+		require.Len(t, publisher.events(), 1)
+		require.Equal(t, [][]byte{[]byte("1"), nil}, source.resumedFrom())
+	})
+
+	t.Run("failed publishing is retried", func(t *testing.T) {
+		source := newMockSource(
+			change("1", repositories.OperationInsert, &company, nil),
+			change("2", repositories.OperationDelete, nil, nil),
+		)
+		tokens := newMockTokenStore()
+		publisher := &mockPublisher{failures: map[string]int{"2": 2}}
+		watcher := changestream.NewWatcher(source, tokens, publisher,
+			changestream.WithName("test"),
+			changestream.WithBackoff(time.Millisecond, 2*time.Millisecond),
+		)
+
+		runWatcher(t, watcher, func() bool {
+			return string(tokens.saved()) == "2"
+		})
+
+		// the change is published once, the event id is the same when it is published after the failure
+		require.Equal(t, []events.Event{
+			events.CompanyCreated{Metadata: events.Metadata{ID: "1", Time: at}, Company: events.Company{ID: "c", Name: "name", Type: "Corporations"}},
+			events.CompanyDeleted{Metadata: events.Metadata{ID: "2", Time: at}, CompanyID: "c"},
+		}, publisher.events())
+		require.Equal(t, [][]byte{nil, []byte("1"), []byte("1")}, source.resumedFrom())
+		require.Contains(t, tokens.tokens, "test")
+	})
+}
+
+func runWatcher(t *testing.T, watcher *changestream.Watcher, done func() bool) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		watcher.Run(ctx)
+	}()
+
+	require.Eventually(t, done, time.Second, time.Millisecond)
+	cancel()
+	<-stopped
+}
+
+func change(id, operation string, company, before *repositories.Company) repositories.CompanyChange {
+	return repositories.CompanyChange{
+		ID:        id,
+		Token:     []byte(id),
+		Operation: operation,
+		CompanyID: "c",
+		Company:   company,
+		Before:    before,
+		Time:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func withFields(change repositories.CompanyChange, updated, removed []string) repositories.CompanyChange {
+	change.UpdatedFields = updated
+	change.RemovedFields = removed
+	return change
+}
+
+// mockSource replays the changes after the resume token, then it waits until ctx is done.
+// Resuming after the lost token fails with ErrHistoryLost
+type mockSource struct {
+	mu      sync.Mutex
+	changes []repositories.CompanyChange
+	resumed [][]byte
+	lost    string
+}
+
+func newMockSource(changes ...repositories.CompanyChange) *mockSource {
+	return &mockSource{changes: changes}
+}
+
+func (m *mockSource) Watch(ctx context.Context, resumeToken []byte, handle func(repositories.CompanyChange) error) error {
+	m.mu.Lock()
+	m.resumed = append(m.resumed, resumeToken)
+	m.mu.Unlock()
+
+	if m.lost != "" && string(resumeToken) == m.lost {
+		return repositories.ErrHistoryLost{}
+	}
+
+	start := 0
+	for i, c := range m.changes {
+		if string(c.Token) == string(resumeToken) {
+			start = i + 1
+		}
+	}
+
+	for _, c := range m.changes[start:] {
+		if err := handle(c); err != nil {
+			return err
+		}
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (m *mockSource) resumedFrom() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.resumed
+}
+
+type mockTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string][]byte
+	last   []byte
+}
+
+func newMockTokenStore() *mockTokenStore {
+	return &mockTokenStore{tokens: map[string][]byte{}}
+}
+
+func (m *mockTokenStore) Load(_ context.Context, name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[name]
+	if !ok {
+		return nil, repositories.ErrNotFound{}
+	}
+	return token, nil
+}
+
+func (m *mockTokenStore) Save(_ context.Context, name string, token []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokens[name] = token
+	m.last = token
+	return nil
+}
+
+func (m *mockTokenStore) saved() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// mockPublisher fails the given number of times to publish events with the ids
+type mockPublisher struct {
+	mu        sync.Mutex
+	failures  map[string]int
+	published []events.Event
+}
+
+func (m *mockPublisher) OnCreateCompany(e events.CompanyCreated) error {
+	return m.publish(e)
+}
+
+func (m *mockPublisher) OnPatchCompany(e events.CompanyUpdated) error {
+	return m.publish(e)
+}
+
+func (m *mockPublisher) OnDeleteCompany(e events.CompanyDeleted) error {
+	return m.publish(e)
+}
+
+func (m *mockPublisher) publish(e events.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failures[e.Meta().ID] > 0 {
+		m.failures[e.Meta().ID]--
+		return errors.New("publisher is not available")
+	}
+
+	m.published = append(m.published, e)
+	return nil
+}
+
+func (m *mockPublisher) events() []events.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.published
+}
@@ -0,0 +1,275 @@
+// Package dispatcher queues company events and publishes them in background by a fixed pool of workers
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+)
+
+const (
+	DefaultQueueSize = 1000
+	DefaultWorkers   = 4
+
+	// PolicyBlock makes the caller wait until there is room in the queue
+	PolicyBlock = "block"
+	// PolicyDropOldest drops the oldest queued event to make room for the new one
+	PolicyDropOldest = "drop-oldest"
+	// PolicyReject refuses new events while the queue is full
+	PolicyReject = "reject"
+)
+
+type Publisher interface {
+	OnCreateCompany(e events.CompanyCreated) error
+	OnPatchCompany(e events.CompanyUpdated) error
+	OnDeleteCompany(e events.CompanyDeleted) error
+}
+
+type ErrQueueFull struct{}
+
+func (ErrQueueFull) Error() string {
+	return "events queue is full"
+}
+
+type ErrClosed struct{}
+
+func (ErrClosed) Error() string {
+	return "events dispatcher is closed"
+}
+
+// Dispatcher publishes events to the publisher asynchronously. Events are kept in the bounded queue,
+// what happens when it is full is set by the overflow policy. The queue is split evenly between the workers
+// by the company id, so events of one company are published one by one in the order they are queued.
+// Events still queued are lost when the process stops without Shutdown
+type Dispatcher struct {
+	publisher Publisher
+	// queues has a queue of every worker
+	queues    []chan events.Event
+	queueSize int
+	policy    string
+	workers   int
+
+	// mu guards closing of the queue, events are sent to the queue under read lock
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type Option func(*Dispatcher)
+
+// WithQueueSize sets how many events can wait for publishing
+func WithQueueSize(size int) Option {
+	return func(d *Dispatcher) {
+		d.queueSize = size
+	}
+}
+
+// WithWorkers sets how many events are published concurrently
+func WithWorkers(workers int) Option {
+	return func(d *Dispatcher) {
+		d.workers = workers
+	}
+}
+
+// WithPolicy sets what happens to the new event when the queue is full, PolicyBlock is used by default
+func WithPolicy(policy string) Option {
+	return func(d *Dispatcher) {
+		d.policy = policy
+	}
+}
+
+// New starts the workers, they run until Shutdown
+func New(publisher Publisher, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		publisher: publisher,
+		queueSize: DefaultQueueSize,
+		policy:    PolicyBlock,
+		workers:   DefaultWorkers,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	d.queues = make([]chan events.Event, d.workers)
+	d.wg.Add(d.workers)
+	for i := range d.queues {
+		d.queues[i] = make(chan events.Event, max(1, (d.queueSize+d.workers-1)/d.workers))
+		go d.work(d.queues[i])
+	}
+
+	return d
+}
+
+func (d *Dispatcher) OnCreateCompany(e events.CompanyCreated) error {
+	return d.enqueue(e, d.policy)
+}
+
+func (d *Dispatcher) OnPatchCompany(e events.CompanyUpdated) error {
+	return d.enqueue(e, d.policy)
+}
+
+func (d *Dispatcher) OnDeleteCompany(e events.CompanyDeleted) error {
+	return d.enqueue(e, d.policy)
+}
+
+// Blocking returns publisher queuing events to the dispatcher, it waits for room in the queue regardless
+// of the policy. It is used by the change of many companies admitted as a whole, so none of its events is lost
+func (d *Dispatcher) Blocking() Publisher {
+	return blocking{d: d}
+}
+
+// Admitted returns publisher for events of the changes admitted by Admit. With reject policy it waits for room
+// in the queue, as the room was checked before the change was applied and the event must not be lost after it,
+// other policies are kept
+func (d *Dispatcher) Admitted() Publisher {
+	if d.policy == PolicyReject {
+		return blocking{d: d}
+	}
+
+	return d
+}
+
+// Admit reports whether the given number of new events would be accepted now, it lets callers refuse the change
+// before it is applied instead of losing its events. Only reject policy refuses events of the open dispatcher,
+// as the companies of the events are not known yet, they are refused when any of the queues is full
+// or all queues together have no room for them
+func (d *Dispatcher) Admit(count int) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrClosed{}
+	}
+
+	if d.policy != PolicyReject {
+		return nil
+	}
+
+	free := 0
+	for _, queue := range d.queues {
+		if len(queue) == cap(queue) {
+			return ErrQueueFull{}
+		}
+		free += cap(queue) - len(queue)
+	}
+
+	if free < count {
+		return ErrQueueFull{}
+	}
+
+	return nil
+}
+
+// Shutdown stops accepting events and waits until the queued ones are published or ctx is done
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Join(errors.New("events are not drained"), ctx.Err())
+	}
+}
+
+func (d *Dispatcher) enqueue(e events.Event, policy string) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrClosed{}
+	}
+
+	queue := d.queues[d.worker(e.Subject())]
+	switch policy {
+	case PolicyReject:
+		select {
+		case queue <- e:
+			return nil
+		default:
+			return ErrQueueFull{}
+		}
+	case PolicyDropOldest:
+		for {
+			select {
+			case queue <- e:
+				return nil
+			default:
+			}
+
+			// workers can take the oldest event first, then there is room for the new one on the next try
+			select {
+			case dropped := <-queue:
+				slog.Warn("events queue is full, the oldest event is dropped", "id", dropped.Meta().ID, "type", dropped.Type(), "subject", dropped.Subject())
+			default:
+			}
+		}
+	default:
+		queue <- e
+		return nil
+	}
+}
+
+type blocking struct {
+	d *Dispatcher
+}
+
+func (b blocking) OnCreateCompany(e events.CompanyCreated) error {
+	return b.d.enqueue(e, PolicyBlock)
+}
+
+func (b blocking) OnPatchCompany(e events.CompanyUpdated) error {
+	return b.d.enqueue(e, PolicyBlock)
+}
+
+func (b blocking) OnDeleteCompany(e events.CompanyDeleted) error {
+	return b.d.enqueue(e, PolicyBlock)
+}
+
+// worker returns index of the worker publishing events of the company
+func (d *Dispatcher) worker(companyID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(companyID))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+func (d *Dispatcher) work(queue <-chan events.Event) {
+	defer d.wg.Done()
+
+	for e := range queue {
+		if err := d.publish(e); err != nil {
+			slog.Error("failed to publish company event", "id", e.Meta().ID, "type", e.Type(), "error", err.Error())
+		}
+	}
+}
+
+func (d *Dispatcher) publish(e events.Event) error {
+	switch e := e.(type) {
+	case events.CompanyCreated:
+		return d.publisher.OnCreateCompany(e)
+	case events.CompanyUpdated:
+		return d.publisher.OnPatchCompany(e)
+	case events.CompanyDeleted:
+		return d.publisher.OnDeleteCompany(e)
+	default:
+		return errors.New("unknown event type: " + e.Type())
+	}
+}
@@ -0,0 +1,267 @@
+package dispatcher_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/dispatcher"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher(t *testing.T) {
+	t.Run("publishes events by type", func(t *testing.T) {
+		publisher := newMockPublisher(nil)
+		d := dispatcher.New(publisher)
+
+		require.NoError(t, d.OnCreateCompany(created("1")))
+		require.NoError(t, d.OnPatchCompany(events.CompanyUpdated{Metadata: events.Metadata{ID: "2"}}))
+		require.NoError(t, d.OnDeleteCompany(events.CompanyDeleted{Metadata: events.Metadata{ID: "3"}}))
+		require.NoError(t, d.Shutdown(context.Background()))
+
+		require.ElementsMatch(t, []string{"create 1", "patch 2", "delete 3"}, publisher.published())
+	})
+
+	t.Run("keeps order of company events", func(t *testing.T) {
+		publisher := newMockPublisher(nil)
+		d := dispatcher.New(publisher, dispatcher.WithWorkers(4))
+
+		companies := []string{"a", "b", "c", "d", "e"}
+		for i := range 20 {
+			for _, company := range companies {
+				e := events.CompanyUpdated{Metadata: events.Metadata{ID: fmt.Sprintf("%s-%02d", company, i)}, Company: events.Company{ID: company}}
+				require.NoError(t, d.OnPatchCompany(e))
+			}
+		}
+		require.NoError(t, d.Shutdown(context.Background()))
+
+		byCompany := map[string][]string{}
+		for _, e := range publisher.published() {
+			company := strings.TrimPrefix(e, "patch ")[:1]
+			byCompany[company] = append(byCompany[company], e)
+		}
+		require.Len(t, byCompany, len(companies))
+		for company, published := range byCompany {
+			require.Len(t, published, 20, company)
+			require.True(t, slices.IsSorted(published), company)
+		}
+	})
+
+	t.Run("reject policy", func(t *testing.T) {
+		publisher, d := newBusyDispatcher(t, dispatcher.PolicyReject)
+
+		require.ErrorIs(t, d.Admit(1), dispatcher.ErrQueueFull{})
+		require.ErrorIs(t, d.OnCreateCompany(created("3")), dispatcher.ErrQueueFull{})
+
+		publisher.release()
+		require.NoError(t, d.Shutdown(context.Background()))
+		require.Equal(t, []string{"create 1", "create 2"}, publisher.published())
+	})
+
+	t.Run("reject policy admits events which fit into the queues", func(t *testing.T) {
+		d := dispatcher.New(newMockPublisher(nil), dispatcher.WithWorkers(2), dispatcher.WithQueueSize(4), dispatcher.WithPolicy(dispatcher.PolicyReject))
+		defer d.Shutdown(context.Background()) //nolint errcheck
+
+		require.NoError(t, d.Admit(4))
+		require.ErrorIs(t, d.Admit(5), dispatcher.ErrQueueFull{})
+	})
+
+	t.Run("blocking publisher waits for room with reject policy", func(t *testing.T) {
+		publisher, d := newBusyDispatcher(t, dispatcher.PolicyReject)
+
+		enqueued := make(chan error)
+		go func() {
+			enqueued <- d.Blocking().OnCreateCompany(created("3"))
+		}()
+
+		select {
+		case <-enqueued:
+			require.Fail(t, "event is enqueued to the full queue")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		publisher.release()
+		require.NoError(t, <-enqueued)
+		require.NoError(t, d.Shutdown(context.Background()))
+		require.Equal(t, []string{"create 1", "create 2", "create 3"}, publisher.published())
+	})
+
+	t.Run("admitted events are not refused with reject policy", func(t *testing.T) {
+		started := make(chan struct{}, 1)
+		publisher := newMockPublisher(started)
+		d := dispatcher.New(publisher, dispatcher.WithWorkers(1), dispatcher.WithQueueSize(4), dispatcher.WithPolicy(dispatcher.PolicyReject))
+
+		require.NoError(t, d.OnCreateCompany(created("0")))
+		<-started
+
+		// concurrent changes are admitted for the same room in the queue before any of them is applied
+		var admitted atomic.Int32
+		var decided, wg sync.WaitGroup
+		applied := make(chan struct{})
+		errs := make(chan error, 20)
+		for i := range 20 {
+			decided.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if d.Admit(1) != nil {
+					decided.Done()
+					return
+				}
+				admitted.Add(1)
+				decided.Done()
+				<-applied
+				errs <- d.Admitted().OnCreateCompany(created(strconv.Itoa(i + 1)))
+			}()
+		}
+
+		decided.Wait()
+		close(applied)
+		// the admitted events fill the queue before the worker takes any of them
+		time.Sleep(10 * time.Millisecond)
+		publisher.release()
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, d.Shutdown(context.Background()))
+		require.Greater(t, int(admitted.Load()), 4)
+		require.Len(t, publisher.published(), int(admitted.Load())+1)
+	})
+
+	t.Run("admitted events keep drop oldest policy", func(t *testing.T) {
+		publisher, d := newBusyDispatcher(t, dispatcher.PolicyDropOldest)
+
+		require.NoError(t, d.Admit(1))
+		require.NoError(t, d.Admitted().OnCreateCompany(created("3")))
+
+		publisher.release()
+		require.NoError(t, d.Shutdown(context.Background()))
+		require.Equal(t, []string{"create 1", "create 3"}, publisher.published())
+	})
+
+	t.Run("drop oldest policy", func(t *testing.T) {
+		publisher, d := newBusyDispatcher(t, dispatcher.PolicyDropOldest)
+
+		require.NoError(t, d.Admit(1))
+		require.NoError(t, d.OnCreateCompany(created("3")))
+
+		publisher.release()
+		require.NoError(t, d.Shutdown(context.Background()))
+		require.Equal(t, []string{"create 1", "create 3"}, publisher.published())
+	})
+
+	t.Run("block policy", func(t *testing.T) {
+		publisher, d := newBusyDispatcher(t, dispatcher.PolicyBlock)
+
+		require.NoError(t, d.Admit(1))
+		enqueued := make(chan error)
+		go func() {
+			enqueued <- d.OnCreateCompany(created("3"))
+		}()
+
+		select {
+		case <-enqueued:
+			require.Fail(t, "event is enqueued to the full queue")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		publisher.release()
+		require.NoError(t, <-enqueued)
+		require.NoError(t, d.Shutdown(context.Background()))
+		require.Equal(t, []string{"create 1", "create 2", "create 3"}, publisher.published())
+	})
+
+	t.Run("shutdown timeout", func(t *testing.T) {
+		publisher, d := newBusyDispatcher(t, dispatcher.PolicyBlock)
+		defer publisher.release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, d.Shutdown(ctx), context.DeadlineExceeded)
+
+		require.ErrorIs(t, d.Admit(1), dispatcher.ErrClosed{})
+		require.ErrorIs(t, d.OnCreateCompany(created("3")), dispatcher.ErrClosed{})
+	})
+}
+
+// newBusyDispatcher returns dispatcher with the only worker publishing event "1" until release
+// and event "2" waiting in the full queue
+func newBusyDispatcher(t *testing.T, policy string) (*mockPublisher, *dispatcher.Dispatcher) {
+	t.Helper()
+
+	started := make(chan struct{}, 1)
+	publisher := newMockPublisher(started)
+	d := dispatcher.New(publisher, dispatcher.WithWorkers(1), dispatcher.WithQueueSize(1), dispatcher.WithPolicy(policy))
+
+	require.NoError(t, d.OnCreateCompany(created("1")))
+	<-started
+	require.NoError(t, d.OnCreateCompany(created("2")))
+
+	return publisher, d
+}
+
+func created(id string) events.CompanyCreated {
+	return events.CompanyCreated{Metadata: events.Metadata{ID: id}}
+}
+
+// mockPublisher records published events, it waits for release after the first event when started is set
+type mockPublisher struct {
+	mu       sync.Mutex
+	events   []string
+	started  chan<- struct{}
+	released chan struct{}
+	once     sync.Once
+}
+
+func newMockPublisher(started chan<- struct{}) *mockPublisher {
+	m := &mockPublisher{started: started, released: make(chan struct{})}
+	if started == nil {
+		m.release()
+	}
+	return m
+}
+
+func (m *mockPublisher) OnCreateCompany(e events.CompanyCreated) error {
+	return m.record("create " + e.ID)
+}
+
+func (m *mockPublisher) OnPatchCompany(e events.CompanyUpdated) error {
+	return m.record("patch " + e.ID)
+}
+
+func (m *mockPublisher) OnDeleteCompany(e events.CompanyDeleted) error {
+	return m.record("delete " + e.ID)
+}
+
+func (m *mockPublisher) record(event string) error {
+	m.mu.Lock()
+	m.events = append(m.events, event)
+	first := len(m.events) == 1
+	m.mu.Unlock()
+
+	if first && m.started != nil {
+		m.started <- struct{}{}
+	}
+	<-m.released
+	return nil
+}
+
+func (m *mockPublisher) release() {
+	m.once.Do(func() { close(m.released) })
+}
+
+func (m *mockPublisher) published() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.events...)
+}
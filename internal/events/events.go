@@ -0,0 +1,163 @@
+// Package events defines company events and their CloudEvents 1.0 representation, publishers get events
+// of these types and send them serialised as CloudEvents
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TypeCompanyCreated = "company.created"
+	TypeCompanyUpdated = "company.updated"
+	TypeCompanyDeleted = "company.deleted"
+
+	// SchemaVersion is version of the event data schemas, it is increased on incompatible changes of the data
+	SchemaVersion = 1
+)
+
+// Event is a company event, its data is serialised as the data of the CloudEvent
+type Event interface {
+	// Meta returns identity of the event occurrence
+	Meta() Metadata
+	Type() string
+	// Subject returns id of the company the event is about
+	Subject() string
+}
+
+// Metadata identifies the event occurrence, redelivered event keeps the same metadata,
+// so consumers can drop duplicates by the id
+type Metadata struct {
+	ID   string
+	Time time.Time
+}
+
+// NewMetadata returns metadata of the event occurred now
+func NewMetadata() Metadata {
+	return Metadata{ID: uuid.NewString(), Time: time.Now().UTC().Truncate(time.Millisecond)}
+}
+
+func (m Metadata) Meta() Metadata {
+	return m
+}
+
+type Company struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Description       string    `json:"description,omitempty"`
+	AmountOfEmployees int       `json:"amount_of_employees"`
+	Registered        bool      `json:"registered"`
+	Type              string    `json:"type"`
+	Version           int64     `json:"version"`
+	CreatedAt         time.Time `json:"created_at"`
+	CreatedBy         string    `json:"created_by,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	UpdatedBy         string    `json:"updated_by,omitempty"`
+}
+
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+type CompanyCreated struct {
+	Metadata `json:"-"`
+	Company  Company `json:"company"`
+}
+
+func (CompanyCreated) Type() string {
+	return TypeCompanyCreated
+}
+
+func (e CompanyCreated) Subject() string {
+	return e.Company.ID
+}
+
+// CompanyUpdated has the company state after the update and the fields the update has changed
+type CompanyUpdated struct {
+	Metadata `json:"-"`
+	Company  Company       `json:"company"`
+	Changes  []FieldChange `json:"changes"`
+}
+
+func (CompanyUpdated) Type() string {
+	return TypeCompanyUpdated
+}
+
+func (e CompanyUpdated) Subject() string {
+	return e.Company.ID
+}
+
+type CompanyDeleted struct {
+	Metadata  `json:"-"`
+	CompanyID string `json:"company_id"`
+}
+
+func (CompanyDeleted) Type() string {
+	return TypeCompanyDeleted
+}
+
+func (e CompanyDeleted) Subject() string {
+	return e.CompanyID
+}
+
+const (
+	specVersion     = "1.0"
+	source          = "/company-handler"
+	dataContentType = "application/json"
+	// ContentType is media type of the event serialised in CloudEvents structured mode
+	ContentType = "application/cloudevents+json"
+)
+
+// CloudEvent is the event in CloudEvents 1.0 structured JSON format
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// ToCloudEvent wraps the event into CloudEvent, the schema version is part of the data schema URI
+func ToCloudEvent(e Event) (CloudEvent, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+
+	meta := e.Meta()
+	return CloudEvent{
+		SpecVersion:     specVersion,
+		ID:              meta.ID,
+		Source:          source,
+		Type:            e.Type(),
+		Subject:         e.Subject(),
+		Time:            meta.Time,
+		DataContentType: dataContentType,
+		DataSchema:      DataSchema(e.Type()),
+		Data:            data,
+	}, nil
+}
+
+// Marshal returns JSON of the event in CloudEvents structured mode
+func Marshal(e Event) ([]byte, error) {
+	ce, err := ToCloudEvent(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(ce)
+}
+
+// DataSchema returns URI of the data schema of the given event type
+func DataSchema(eventType string) string {
+	return "urn:company-handler:schema:" + eventType + ":v" + strconv.Itoa(SchemaVersion)
+}
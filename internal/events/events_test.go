@@ -0,0 +1,93 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshal(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("company created", func(t *testing.T) {
+		data, err := events.Marshal(events.CompanyCreated{
+			Metadata: events.Metadata{ID: "event", Time: at},
+			Company: events.Company{
+				ID:                "company",
+				Name:              "name",
+				AmountOfEmployees: 10,
+				Registered:        true,
+				Type:              "Corporations",
+				Version:           1,
+				CreatedAt:         createdAt,
+				CreatedBy:         "user",
+				UpdatedAt:         createdAt,
+				UpdatedBy:         "user",
+			},
+		})
+		require.NoError(t, err)
+		require.JSONEq(t, `{
+			"specversion": "1.0",
+			"id": "event",
+			"source": "/company-handler",
+			"type": "company.created",
+			"subject": "company",
+			"time": "2026-01-02T03:04:05.006Z",
+			"datacontenttype": "application/json",
+			"dataschema": "urn:company-handler:schema:company.created:v1",
+			"data": {
+				"company": {
+					"id": "company",
+					"name": "name",
+					"amount_of_employees": 10,
+					"registered": true,
+					"type": "Corporations",
+					"version": 1,
+					"created_at": "2026-01-01T00:00:00Z",
+					"created_by": "user",
+					"updated_at": "2026-01-01T00:00:00Z",
+					"updated_by": "user"
+				}
+			}
+		}`, string(data))
+	})
+
+	t.Run("company updated", func(t *testing.T) {
+		ce, err := events.ToCloudEvent(events.CompanyUpdated{
+			Metadata: events.Metadata{ID: "event", Time: at},
+			Company:  events.Company{ID: "company", Name: "new"},
+			Changes:  []events.FieldChange{{Field: "name", Before: "old", After: "new"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, events.TypeCompanyUpdated, ce.Type)
+		require.Equal(t, "company", ce.Subject)
+		require.Equal(t, "urn:company-handler:schema:company.updated:v1", ce.DataSchema)
+
+		var data struct {
+			Changes []events.FieldChange `json:"changes"`
+		}
+		require.NoError(t, json.Unmarshal(ce.Data, &data))
+		require.Equal(t, []events.FieldChange{{Field: "name", Before: "old", After: "new"}}, data.Changes)
+	})
+
+	t.Run("company deleted", func(t *testing.T) {
+		ce, err := events.ToCloudEvent(events.CompanyDeleted{Metadata: events.Metadata{ID: "event", Time: at}, CompanyID: "company"})
+		require.NoError(t, err)
+		require.Equal(t, events.TypeCompanyDeleted, ce.Type)
+		require.Equal(t, "company", ce.Subject)
+		require.True(t, at.Equal(ce.Time))
+		require.JSONEq(t, `{"company_id": "company"}`, string(ce.Data))
+	})
+}
+
+func TestNewMetadata(t *testing.T) {
+	first, second := events.NewMetadata(), events.NewMetadata()
+	require.NotEmpty(t, first.ID)
+	require.NotEqual(t, first.ID, second.ID)
+	require.Equal(t, time.UTC, first.Time.Location())
+	require.WithinDuration(t, time.Now(), first.Time, time.Second)
+}
@@ -0,0 +1,107 @@
+// Package jetstream publishes company events to NATS JetStream
+package jetstream
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	DefaultSubjectPrefix = "companies"
+	DefaultTimeout       = 5 * time.Second
+	// DefaultDuplicateWindow is how long JetStream remembers ids of the published messages
+	DefaultDuplicateWindow = 2 * time.Minute
+)
+
+// Publisher publishes every event as CloudEvent in structured mode to the subject "<prefix>.<action>",
+// for example "companies.created". The event id is used as the message id, so JetStream drops the event
+// published again within the duplicate window of the stream, for example when the outbox relay redelivers it
+type Publisher struct {
+	js            nats.JetStreamContext
+	subjectPrefix string
+	timeout       time.Duration
+}
+
+type Option func(*Publisher)
+
+// WithSubjectPrefix sets the first token of the subjects events are published to
+func WithSubjectPrefix(prefix string) Option {
+	return func(p *Publisher) {
+		p.subjectPrefix = prefix
+	}
+}
+
+// WithTimeout sets how long the publisher waits for the stream to acknowledge the event
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Publisher) {
+		p.timeout = timeout
+	}
+}
+
+func NewPublisher(js nats.JetStreamContext, opts ...Option) *Publisher {
+	p := &Publisher{
+		js:            js,
+		subjectPrefix: DefaultSubjectPrefix,
+		timeout:       DefaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+func (p *Publisher) OnCreateCompany(e events.CompanyCreated) error {
+	return p.publish(e)
+}
+
+func (p *Publisher) OnPatchCompany(e events.CompanyUpdated) error {
+	return p.publish(e)
+}
+
+func (p *Publisher) OnDeleteCompany(e events.CompanyDeleted) error {
+	return p.publish(e)
+}
+
+// EnsureStream creates the stream storing all subjects of the publisher unless it exists,
+// ids of the published events are kept for the duplicate window. Existing stream is not changed
+func (p *Publisher) EnsureStream(name string, duplicateWindow time.Duration) error {
+	_, err := p.js.StreamInfo(name)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+
+	_, err = p.js.AddStream(&nats.StreamConfig{
+		Name:       name,
+		Subjects:   []string{p.subjectPrefix + ".>"},
+		Duplicates: duplicateWindow,
+	})
+	return err
+}
+
+// Subject returns subject events of the given type are published to
+func (p *Publisher) Subject(eventType string) string {
+	return p.subjectPrefix + "." + strings.TrimPrefix(eventType, "company.")
+}
+
+func (p *Publisher) publish(e events.Event) error {
+	data, err := events.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(p.Subject(e.Type()))
+	msg.Header.Set("Content-Type", events.ContentType)
+	msg.Data = data
+
+	_, err = p.js.PublishMsg(msg, nats.MsgId(e.Meta().ID), nats.AckWait(p.timeout))
+	return err
+}
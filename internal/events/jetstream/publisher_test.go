@@ -0,0 +1,96 @@
+package jetstream_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/jetstream"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher(t *testing.T) {
+	js := runJetStream(t)
+	publisher := jetstream.NewPublisher(js, jetstream.WithTimeout(time.Second))
+	require.NoError(t, publisher.EnsureStream("COMPANIES", time.Minute))
+	// existing stream is kept
+	require.NoError(t, publisher.EnsureStream("COMPANIES", time.Minute))
+
+	sub, err := js.SubscribeSync("companies.>", nats.DeliverAll())
+	require.NoError(t, err)
+
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Run("publishes events as CloudEvents", func(t *testing.T) {
+		require.NoError(t, publisher.OnCreateCompany(events.CompanyCreated{
+			Metadata: events.Metadata{ID: "event-1", Time: at},
+			Company:  events.Company{ID: "company", Name: "name"},
+		}))
+		require.NoError(t, publisher.OnPatchCompany(events.CompanyUpdated{
+			Metadata: events.Metadata{ID: "event-2", Time: at},
+			Company:  events.Company{ID: "company", Name: "new"},
+			Changes:  []events.FieldChange{{Field: "name", Before: "name", After: "new"}},
+		}))
+		require.NoError(t, publisher.OnDeleteCompany(events.CompanyDeleted{Metadata: events.Metadata{ID: "event-3", Time: at}, CompanyID: "company"}))
+
+		for _, expected := range []struct{ subject, id, eventType string }{
+			{"companies.created", "event-1", events.TypeCompanyCreated},
+			{"companies.updated", "event-2", events.TypeCompanyUpdated},
+			{"companies.deleted", "event-3", events.TypeCompanyDeleted},
+		} {
+			msg, err := sub.NextMsg(time.Second)
+			require.NoError(t, err)
+			require.Equal(t, expected.subject, msg.Subject)
+			require.Equal(t, expected.id, msg.Header.Get(nats.MsgIdHdr))
+			require.Equal(t, events.ContentType, msg.Header.Get("Content-Type"))
+
+			var ce events.CloudEvent
+			require.NoError(t, json.Unmarshal(msg.Data, &ce))
+			require.Equal(t, expected.id, ce.ID)
+			require.Equal(t, expected.eventType, ce.Type)
+			require.Equal(t, "company", ce.Subject)
+		}
+	})
+
+	t.Run("drops duplicates", func(t *testing.T) {
+		event := events.CompanyDeleted{Metadata: events.Metadata{ID: "event-3", Time: at}, CompanyID: "company"}
+		require.NoError(t, publisher.OnDeleteCompany(event))
+
+		info, err := js.StreamInfo("COMPANIES")
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), info.State.Msgs)
+
+		_, err = sub.NextMsg(100 * time.Millisecond)
+		require.ErrorIs(t, err, nats.ErrTimeout)
+	})
+
+	t.Run("subject prefix", func(t *testing.T) {
+		publisher := jetstream.NewPublisher(js, jetstream.WithSubjectPrefix("acme.companies"))
+		require.Equal(t, "acme.companies.created", publisher.Subject(events.TypeCompanyCreated))
+
+		// there is no stream for the subject
+		err := publisher.OnCreateCompany(events.CompanyCreated{Metadata: events.NewMetadata()})
+		require.ErrorIs(t, err, nats.ErrNoStreamResponse)
+	})
+}
+
+// runJetStream starts in-process NATS server with JetStream enabled and returns JetStream of the connection to it
+func runJetStream(t *testing.T) nats.JetStreamContext {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	require.NoError(t, err)
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+	require.True(t, ns.ReadyForConnections(5*time.Second), "nats server is not ready")
+
+	nc, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+	return js
+}
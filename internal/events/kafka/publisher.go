@@ -0,0 +1,124 @@
+// Package kafka publishes company events to Kafka topic
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+
+	// AcksAll waits until all in-sync replicas have the event
+	AcksAll = "all"
+	// AcksLeader waits until the partition leader has the event
+	AcksLeader = "leader"
+	// AcksNone does not wait for the broker, the event can be lost without an error
+	AcksNone = "none"
+
+	contentTypeHeader = "content-type"
+)
+
+// Writer writes messages to the topic, *kafkago.Writer implements it
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafkago.Message) error
+}
+
+type ErrUnknownAcks struct {
+	Acks string
+}
+
+func (e ErrUnknownAcks) Error() string {
+	return "unknown kafka acks: " + e.Acks
+}
+
+// Publisher writes every event as CloudEvent in structured mode keyed by the company id. Writer created by
+// NewWriter puts messages of the same key to the same partition, so consumers get events of a company in order
+type Publisher struct {
+	writer  Writer
+	timeout time.Duration
+}
+
+type Option func(*Publisher)
+
+// WithTimeout sets how long the publisher waits for the event to be written, including time in the batch
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Publisher) {
+		p.timeout = timeout
+	}
+}
+
+func NewPublisher(writer Writer, opts ...Option) *Publisher {
+	p := &Publisher{
+		writer:  writer,
+		timeout: DefaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// NewWriter returns writer of the topic partitioning messages by hash of the key. Messages are sent
+// in batches of up to batchSize messages, not full batch is sent after batchTimeout
+func NewWriter(brokers []string, topic, acks string, batchSize int, batchTimeout time.Duration) (*kafkago.Writer, error) {
+	requiredAcks, err := parseAcks(acks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkago.Writer{
+		Addr:         kafkago.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafkago.Hash{},
+		RequiredAcks: requiredAcks,
+		BatchSize:    batchSize,
+		BatchTimeout: batchTimeout,
+	}, nil
+}
+
+func (p *Publisher) OnCreateCompany(e events.CompanyCreated) error {
+	return p.publish(e)
+}
+
+func (p *Publisher) OnPatchCompany(e events.CompanyUpdated) error {
+	return p.publish(e)
+}
+
+func (p *Publisher) OnDeleteCompany(e events.CompanyDeleted) error {
+	return p.publish(e)
+}
+
+func (p *Publisher) publish(e events.Event) error {
+	data, err := events.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	return p.writer.WriteMessages(ctx, kafkago.Message{
+		Key:     []byte(e.Subject()),
+		Value:   data,
+		Headers: []kafkago.Header{{Key: contentTypeHeader, Value: []byte(events.ContentType)}},
+	})
+}
+
+func parseAcks(acks string) (kafkago.RequiredAcks, error) {
+	switch acks {
+	case AcksAll:
+		return kafkago.RequireAll, nil
+	case AcksLeader:
+		return kafkago.RequireOne, nil
+	case AcksNone:
+		return kafkago.RequireNone, nil
+	default:
+		return 0, ErrUnknownAcks{Acks: acks}
+	}
+}
@@ -0,0 +1,165 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/dispatcher"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("writes events as CloudEvents keyed by company", func(t *testing.T) {
+		broker := newFakeBroker(3)
+		publisher := kafka.NewPublisher(broker)
+
+		require.NoError(t, publisher.OnCreateCompany(events.CompanyCreated{
+			Metadata: events.Metadata{ID: "event-1", Time: at},
+			Company:  events.Company{ID: "company", Name: "name"},
+		}))
+		require.NoError(t, publisher.OnDeleteCompany(events.CompanyDeleted{Metadata: events.Metadata{ID: "event-2", Time: at}, CompanyID: "company"}))
+
+		messages := broker.companyMessages(t, "company")
+		require.Len(t, messages, 2)
+		for i, expected := range []struct{ id, eventType string }{
+			{"event-1", events.TypeCompanyCreated},
+			{"event-2", events.TypeCompanyDeleted},
+		} {
+			require.Equal(t, "company", string(messages[i].Key))
+			require.Equal(t, []kafkago.Header{{Key: "content-type", Value: []byte(events.ContentType)}}, messages[i].Headers)
+
+			var ce events.CloudEvent
+			require.NoError(t, json.Unmarshal(messages[i].Value, &ce))
+			require.Equal(t, expected.id, ce.ID)
+			require.Equal(t, expected.eventType, ce.Type)
+			require.Equal(t, "company", ce.Subject)
+		}
+	})
+
+	t.Run("keeps order of company events", func(t *testing.T) {
+		broker := newFakeBroker(3)
+		d := dispatcher.New(kafka.NewPublisher(broker), dispatcher.WithWorkers(4))
+
+		companies := []string{"a", "b", "c", "d", "e", "f"}
+		for version := range 20 {
+			for _, company := range companies {
+				require.NoError(t, d.OnPatchCompany(events.CompanyUpdated{
+					Metadata: events.NewMetadata(),
+					Company:  events.Company{ID: company, Version: int64(version + 1)},
+				}))
+			}
+		}
+		require.NoError(t, d.Shutdown(context.Background()))
+
+		for _, company := range companies {
+			messages := broker.companyMessages(t, company)
+			require.Len(t, messages, 20, company)
+			for i, message := range messages {
+				var ce events.CloudEvent
+				require.NoError(t, json.Unmarshal(message.Value, &ce))
+				var data events.CompanyUpdated
+				require.NoError(t, json.Unmarshal(ce.Data, &data))
+				require.Equal(t, int64(i+1), data.Company.Version, company)
+			}
+		}
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		broker := newFakeBroker(1)
+		broker.err = errors.New("leader not available")
+		publisher := kafka.NewPublisher(broker, kafka.WithTimeout(time.Second))
+
+		err := publisher.OnDeleteCompany(events.CompanyDeleted{Metadata: events.NewMetadata(), CompanyID: "company"})
+		require.ErrorIs(t, err, broker.err)
+		require.WithinDuration(t, time.Now().Add(time.Second), broker.deadline, 100*time.Millisecond)
+	})
+}
+
+func TestNewWriter(t *testing.T) {
+	writer, err := kafka.NewWriter([]string{"localhost:9092", "localhost:9093"}, "companies", kafka.AcksLeader, 50, 20*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, "localhost:9092,localhost:9093", writer.Addr.String())
+	require.Equal(t, "companies", writer.Topic)
+	require.Equal(t, kafkago.RequireOne, writer.RequiredAcks)
+	require.Equal(t, 50, writer.BatchSize)
+	require.Equal(t, 20*time.Millisecond, writer.BatchTimeout)
+	require.IsType(t, &kafkago.Hash{}, writer.Balancer)
+
+	for acks, expected := range map[string]kafkago.RequiredAcks{kafka.AcksAll: kafkago.RequireAll, kafka.AcksNone: kafkago.RequireNone} {
+		writer, err := kafka.NewWriter([]string{"localhost:9092"}, "companies", acks, 1, time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, expected, writer.RequiredAcks, acks)
+	}
+
+	_, err = kafka.NewWriter([]string{"localhost:9092"}, "companies", "two", 1, time.Millisecond)
+	require.ErrorIs(t, err, kafka.ErrUnknownAcks{Acks: "two"})
+}
+
+// fakeBroker stands in for the topic with the given number of partitions, messages are assigned to
+// partitions by the balancer used by the writer of the publisher
+type fakeBroker struct {
+	mu         sync.Mutex
+	partitions [][]kafkago.Message
+	balancer   kafkago.Balancer
+	err        error
+	deadline   time.Time
+}
+
+func newFakeBroker(partitions int) *fakeBroker {
+	return &fakeBroker{partitions: make([][]kafkago.Message, partitions), balancer: &kafkago.Hash{}}
+}
+
+func (b *fakeBroker) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deadline, _ = ctx.Deadline()
+	if b.err != nil {
+		return b.err
+	}
+
+	ids := make([]int, len(b.partitions))
+	for i := range ids {
+		ids[i] = i
+	}
+	for _, msg := range msgs {
+		partition := b.balancer.Balance(msg, ids...)
+		msg.Partition = partition
+		msg.Offset = int64(len(b.partitions[partition]))
+		b.partitions[partition] = append(b.partitions[partition], msg)
+	}
+
+	return nil
+}
+
+// companyMessages returns messages of the company in the offset order, it fails the test when they are in different partitions
+func (b *fakeBroker) companyMessages(t *testing.T, companyID string) []kafkago.Message {
+	t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []kafkago.Message
+	for _, partition := range b.partitions {
+		for _, msg := range partition {
+			if string(msg.Key) != companyID {
+				continue
+			}
+			if len(messages) > 0 {
+				require.Equal(t, messages[0].Partition, msg.Partition, "messages of company %s are in different partitions", companyID)
+			}
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
@@ -0,0 +1,166 @@
+// Package outbox delivers company events stored in the outbox to the events publisher
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repoevents"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/backoff"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+)
+
+const (
+	DefaultInterval   = time.Second
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultLease is how long claimed event is hidden from other relays, it should be longer than delivery takes
+	DefaultLease = time.Minute
+)
+
+type Store interface {
+	// Claim returns due event, the event is not returned while an older event of the same company
+	// is not delivered
+	Claim(ctx context.Context, at time.Time, lease time.Duration) (repositories.OutboxEvent, error)
+	MarkDelivered(ctx context.Context, id string, at time.Time) error
+	MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error
+}
+
+type Publisher interface {
+	OnCreateCompany(e events.CompanyCreated) error
+	OnPatchCompany(e events.CompanyUpdated) error
+	OnDeleteCompany(e events.CompanyDeleted) error
+}
+
+// Relay polls the outbox and delivers events to the publisher. Event is marked as delivered only after
+// the publisher has accepted it, so it is delivered at least once: crash between publishing and marking
+// makes the event delivered again. Failed deliveries are retried with exponential backoff until they succeed,
+// later events of the same company wait until the failed one is delivered, so events of every company are in order
+type Relay struct {
+	store      Store
+	publisher  Publisher
+	interval   time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	lease      time.Duration
+	now        func() time.Time
+}
+
+type Option func(*Relay)
+
+// WithInterval sets how often the outbox is checked for new events
+func WithInterval(interval time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = interval
+	}
+}
+
+// WithBackoff sets delay before the first retry of failed delivery, the delay is doubled
+// for every next retry up to maxBackoff
+func WithBackoff(minBackoff, maxBackoff time.Duration) Option {
+	return func(r *Relay) {
+		r.minBackoff = minBackoff
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// WithClock sets the source of the current time, it is used in tests
+func WithClock(now func() time.Time) Option {
+	return func(r *Relay) {
+		r.now = now
+	}
+}
+
+func NewRelay(store Store, publisher Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		store:      store,
+		publisher:  publisher,
+		interval:   DefaultInterval,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		lease:      DefaultLease,
+		now:        time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run delivers events until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("failed to relay outbox events", "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending tries to deliver every event which is due, it returns number of delivered events.
+// Delivery failures are recorded to the outbox and are not returned, error means the outbox is not available
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	delivered := 0
+	for ctx.Err() == nil {
+		event, err := r.store.Claim(ctx, r.now().UTC(), r.lease)
+		if errors.As(err, &repositories.ErrNotFound{}) {
+			return delivered, nil
+		}
+		if err != nil {
+			return delivered, err
+		}
+
+		if err := r.publish(event); err != nil {
+			slog.Warn("failed to deliver outbox event", "id", event.ID, "type", event.Type, "attempts", event.Attempts, "error", err.Error())
+			nextAttemptAt := r.now().UTC().Add(backoff.Exponential(r.minBackoff, r.maxBackoff, event.Attempts))
+			if err := r.store.MarkFailed(ctx, event.ID, err.Error(), nextAttemptAt); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		if err := r.store.MarkDelivered(ctx, event.ID, r.now().UTC()); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+
+	return delivered, ctx.Err()
+}
+
+// publish sends the event stored in the outbox, the outbox event id is used as the event id,
+// so redelivered events can be recognised by consumers
+func (r *Relay) publish(event repositories.OutboxEvent) error {
+	meta := events.Metadata{ID: event.ID, Time: event.CreatedAt}
+	if event.Type == repositories.EventCompanyDeleted {
+		return r.publisher.OnDeleteCompany(events.CompanyDeleted{Metadata: meta, CompanyID: event.CompanyID})
+	}
+
+	if event.Type != repositories.EventCompanyCreated && event.Type != repositories.EventCompanyUpdated {
+		return errors.New("unknown event type: " + event.Type)
+	}
+
+	if event.Company == nil {
+		return errors.New("company is missing in event: " + event.Type)
+	}
+
+	company := repoevents.Company(*event.Company)
+	if event.Type == repositories.EventCompanyCreated {
+		return r.publisher.OnCreateCompany(events.CompanyCreated{Metadata: meta, Company: company})
+	}
+
+	return r.publisher.OnPatchCompany(events.CompanyUpdated{Metadata: meta, Company: company, Changes: repoevents.Changes(event.Changes)})
+}
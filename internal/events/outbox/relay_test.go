@@ -0,0 +1,264 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/outbox"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayPending(t *testing.T) {
+	t.Run("events are delivered in order", func(t *testing.T) {
+		now := time.Now()
+		store := newMockStore(now,
+			repositories.OutboxEvent{ID: "1", Type: repositories.EventCompanyCreated, CompanyID: "c", Company: &repositories.Company{ID: "c", Name: "created"}},
+			repositories.OutboxEvent{ID: "2", Type: repositories.EventCompanyUpdated, CompanyID: "c", Company: &repositories.Company{ID: "c", Name: "updated"},
+				Changes: []repositories.FieldChange{{Field: "name", Before: "created", After: "updated"}}},
+			repositories.OutboxEvent{ID: "3", Type: repositories.EventCompanyDeleted, CompanyID: "c"},
+		)
+		publisher := &mockPublisher{}
+		relay := outbox.NewRelay(store, publisher, outbox.WithClock(func() time.Time { return now }))
+
+		delivered, err := relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 3, delivered)
+
+		// outbox event id and time identify the event, so redelivered event is the same
+		at := now.UTC()
+		require.Equal(t, []events.Event{
+			events.CompanyCreated{Metadata: events.Metadata{ID: "1", Time: at}, Company: events.Company{ID: "c", Name: "created"}},
+			events.CompanyUpdated{Metadata: events.Metadata{ID: "2", Time: at}, Company: events.Company{ID: "c", Name: "updated"},
+				Changes: []events.FieldChange{{Field: "name", Before: "created", After: "updated"}}},
+			events.CompanyDeleted{Metadata: events.Metadata{ID: "3", Time: at}, CompanyID: "c"},
+		}, publisher.published)
+
+		for _, event := range store.events {
+			require.NotNil(t, event.DeliveredAt)
+		}
+
+		delivered, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		require.Zero(t, delivered)
+		require.Len(t, publisher.published, 3)
+	})
+
+	t.Run("failed delivery is retried with backoff", func(t *testing.T) {
+		now := time.Now()
+		createdAt := now.UTC()
+		store := newMockStore(now, repositories.OutboxEvent{ID: "1", Type: repositories.EventCompanyDeleted, CompanyID: "c"})
+		publisher := &mockPublisher{failures: 3}
+		relay := outbox.NewRelay(store, publisher,
+			outbox.WithClock(func() time.Time { return now }),
+			outbox.WithBackoff(time.Second, 3*time.Second),
+		)
+
+		// delays are 1s, 2s and 3s because of the limit
+		for _, delay := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+			delivered, err := relay.RelayPending(context.Background())
+			require.NoError(t, err)
+			require.Zero(t, delivered)
+			require.Equal(t, "publisher is not available", store.events[0].LastError)
+			require.Equal(t, now.UTC().Add(delay), store.events[0].NextAttemptAt)
+
+			now = now.Add(delay - time.Millisecond)
+			delivered, err = relay.RelayPending(context.Background())
+			require.NoError(t, err)
+			require.Zero(t, delivered)
+
+			now = now.Add(time.Millisecond)
+		}
+
+		delivered, err := relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, delivered)
+		require.Equal(t, []events.Event{events.CompanyDeleted{Metadata: events.Metadata{ID: "1", Time: createdAt}, CompanyID: "c"}}, publisher.published)
+		require.Equal(t, 4, store.events[0].Attempts)
+	})
+
+	t.Run("failed event blocks later events of the company", func(t *testing.T) {
+		now := time.Now()
+		store := newMockStore(now,
+			repositories.OutboxEvent{ID: "1", Type: repositories.EventCompanyDeleted, CompanyID: "c"},
+			repositories.OutboxEvent{ID: "2", Type: repositories.EventCompanyDeleted, CompanyID: "d"},
+			repositories.OutboxEvent{ID: "3", Type: repositories.EventCompanyCreated, CompanyID: "c", Company: &repositories.Company{ID: "c"}},
+		)
+		publisher := &mockPublisher{failures: 1}
+		relay := outbox.NewRelay(store, publisher, outbox.WithClock(func() time.Time { return now }), outbox.WithBackoff(time.Second, time.Second))
+
+		delivered, err := relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, delivered)
+		require.Equal(t, []events.Event{events.CompanyDeleted{Metadata: events.Metadata{ID: "2", Time: now.UTC()}, CompanyID: "d"}}, publisher.published)
+
+		now = now.Add(time.Second)
+		delivered, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 2, delivered)
+		require.Len(t, publisher.published, 3)
+		require.Equal(t, "1", publisher.published[1].Meta().ID)
+		require.Equal(t, "3", publisher.published[2].Meta().ID)
+	})
+
+	t.Run("broken event does not block other companies", func(t *testing.T) {
+		now := time.Now()
+		store := newMockStore(now,
+			repositories.OutboxEvent{ID: "1", Type: repositories.EventCompanyCreated, CompanyID: "c"},
+			repositories.OutboxEvent{ID: "2", Type: "unknown", CompanyID: "d"},
+			repositories.OutboxEvent{ID: "3", Type: repositories.EventCompanyDeleted, CompanyID: "e"},
+		)
+		publisher := &mockPublisher{}
+		relay := outbox.NewRelay(store, publisher, outbox.WithClock(func() time.Time { return now }))
+
+		delivered, err := relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, delivered)
+		require.Equal(t, []events.Event{events.CompanyDeleted{Metadata: events.Metadata{ID: "3", Time: now.UTC()}, CompanyID: "e"}}, publisher.published)
+		require.Equal(t, "company is missing in event: company.created", store.events[0].LastError)
+		require.Equal(t, "unknown event type: unknown", store.events[1].LastError)
+	})
+
+	t.Run("outbox is not available", func(t *testing.T) {
+		store := newMockStore(time.Now())
+		store.err = errors.New("broken")
+		relay := outbox.NewRelay(store, &mockPublisher{})
+
+		_, err := relay.RelayPending(context.Background())
+		require.EqualError(t, err, "broken")
+	})
+}
+
+func TestRun(t *testing.T) {
+	store := newMockStore(time.Now(), repositories.OutboxEvent{ID: "1", Type: repositories.EventCompanyDeleted, CompanyID: "c"})
+	publisher := &mockPublisher{}
+	relay := outbox.NewRelay(store, publisher, outbox.WithInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return publisher.count() == 1 }, time.Second, 10*time.Millisecond)
+
+	store.add(repositories.OutboxEvent{ID: "2", Type: repositories.EventCompanyDeleted, CompanyID: "d", NextAttemptAt: time.Now()})
+	require.Eventually(t, func() bool { return publisher.count() == 2 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+// mockStore keeps events in memory the same way as the outbox repository
+type mockStore struct {
+	mu     sync.Mutex
+	events []repositories.OutboxEvent
+	err    error
+}
+
+func newMockStore(createdAt time.Time, events ...repositories.OutboxEvent) *mockStore {
+	for i := range events {
+		events[i].CreatedAt, events[i].NextAttemptAt = createdAt.UTC(), createdAt.UTC()
+	}
+	return &mockStore{events: events}
+}
+
+func (s *mockStore) add(event repositories.OutboxEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, event)
+}
+
+func (s *mockStore) Claim(_ context.Context, at time.Time, lease time.Duration) (repositories.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return repositories.OutboxEvent{}, s.err
+	}
+
+	seen := make(map[string]bool)
+	for i, event := range s.events {
+		if event.DeliveredAt != nil || seen[event.CompanyID] {
+			continue
+		}
+		seen[event.CompanyID] = true
+
+		if !event.NextAttemptAt.After(at) {
+			s.events[i].NextAttemptAt = at.Add(lease)
+			s.events[i].Attempts++
+			return s.events[i], nil
+		}
+	}
+
+	return repositories.OutboxEvent{}, repositories.ErrNotFound{}
+}
+
+func (s *mockStore) MarkDelivered(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.events {
+		if s.events[i].ID == id {
+			s.events[i].DeliveredAt = &at
+		}
+	}
+	return nil
+}
+
+func (s *mockStore) MarkFailed(_ context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.events {
+		if s.events[i].ID == id {
+			s.events[i].LastError, s.events[i].NextAttemptAt = lastError, nextAttemptAt
+		}
+	}
+	return nil
+}
+
+// mockPublisher fails the given number of times before it accepts events
+type mockPublisher struct {
+	mu        sync.Mutex
+	failures  int
+	published []events.Event
+}
+
+func (p *mockPublisher) OnCreateCompany(e events.CompanyCreated) error {
+	return p.publish(e)
+}
+
+func (p *mockPublisher) OnPatchCompany(e events.CompanyUpdated) error {
+	return p.publish(e)
+}
+
+func (p *mockPublisher) OnDeleteCompany(e events.CompanyDeleted) error {
+	return p.publish(e)
+}
+
+func (p *mockPublisher) publish(e events.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("publisher is not available")
+	}
+
+	p.published = append(p.published, e)
+	return nil
+}
+
+func (p *mockPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.published)
+}
@@ -1,6 +1,10 @@
 package simple
 
-import "log/slog"
+import (
+	"log/slog"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+)
 
 type Publisher struct {
 }
@@ -9,14 +13,25 @@ func New() *Publisher {
 	return new(Publisher)
 }
 
-func (Publisher) OnCreateCompany(e any) {
-	slog.Info("OnCreateCompany event received", "event", e)
+func (Publisher) OnCreateCompany(e events.CompanyCreated) error {
+	return log(e)
+}
+
+func (Publisher) OnPatchCompany(e events.CompanyUpdated) error {
+	return log(e)
 }
 
-func (Publisher) OnPatchCompany(e any) {
-	slog.Info("OnPatchCompany event received", "event", e)
+func (Publisher) OnDeleteCompany(e events.CompanyDeleted) error {
+	return log(e)
 }
 
-func (Publisher) OnDeleteCompany(e any) {
-	slog.Info("OnDeleteCompany event received", "event", e)
+// log writes the event as CloudEvent
+func log(e events.Event) error {
+	ce, err := events.ToCloudEvent(e)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("company event received", "type", ce.Type, "id", ce.ID, "subject", ce.Subject, "data", string(ce.Data))
+	return nil
 }
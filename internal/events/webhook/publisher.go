@@ -0,0 +1,315 @@
+// Package webhook delivers company events to subscribers over HTTP
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/backoff"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+)
+
+const (
+	DefaultTimeout     = 5 * time.Second
+	DefaultMaxAttempts = 5
+	DefaultMinBackoff  = time.Second
+	DefaultMaxBackoff  = time.Minute
+	// DefaultDeliveryTimeout limits delivery of the event to all subscribers including retries
+	DefaultDeliveryTimeout = 30 * time.Second
+
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	// secretSize is size of generated secrets in bytes
+	secretSize = 32
+)
+
+type Store interface {
+	AddSubscription(ctx context.Context, subscription repositories.WebhookSubscription) (repositories.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (repositories.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]repositories.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	AddDelivery(ctx context.Context, delivery repositories.WebhookDelivery) error
+	ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]repositories.WebhookDelivery, error)
+}
+
+type ErrNotFound struct{}
+
+func (ErrNotFound) Error() string {
+	return "webhook subscription not found"
+}
+
+// Publisher sends every event to all subscribers as CloudEvent in structured mode. Request is signed with
+// the subscriber secret, failed requests are retried with exponential backoff and every attempt is recorded to the store
+type Publisher struct {
+	store       Store
+	client      *http.Client
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	// deliveryTimeout is how long the event is delivered, the caller waits for the delivery
+	deliveryTimeout time.Duration
+	now             func() time.Time
+	sleep           func(ctx context.Context, d time.Duration) error
+}
+
+type Option func(*Publisher)
+
+// WithHTTPClient sets the client requests are sent with, the client timeout limits a single attempt
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Publisher) {
+		p.client = client
+	}
+}
+
+// WithRetries sets how many times delivery is attempted and delay before the first retry,
+// the delay is doubled for every next retry up to maxBackoff
+func WithRetries(maxAttempts int, minBackoff, maxBackoff time.Duration) Option {
+	return func(p *Publisher) {
+		p.maxAttempts = maxAttempts
+		p.minBackoff = minBackoff
+		p.maxBackoff = maxBackoff
+	}
+}
+
+// WithDeliveryTimeout sets how long the event is delivered to all subscribers including retries,
+// the retries which do not fit into the timeout are not made, so a failing subscriber does not hold the caller
+func WithDeliveryTimeout(timeout time.Duration) Option {
+	return func(p *Publisher) {
+		p.deliveryTimeout = timeout
+	}
+}
+
+// WithClock sets the source of the current time and the way to wait between attempts, it is used in tests
+func WithClock(now func() time.Time, sleep func(ctx context.Context, d time.Duration) error) Option {
+	return func(p *Publisher) {
+		p.now = now
+		p.sleep = sleep
+	}
+}
+
+func NewPublisher(store Store, opts ...Option) *Publisher {
+	p := &Publisher{
+		store:           store,
+		client:          &http.Client{Timeout: DefaultTimeout},
+		maxAttempts:     DefaultMaxAttempts,
+		minBackoff:      DefaultMinBackoff,
+		maxBackoff:      DefaultMaxBackoff,
+		deliveryTimeout: DefaultDeliveryTimeout,
+		now:             time.Now,
+		sleep:           sleep,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+func (p *Publisher) OnCreateCompany(e events.CompanyCreated) error {
+	return p.publish(context.Background(), e)
+}
+
+func (p *Publisher) OnPatchCompany(e events.CompanyUpdated) error {
+	return p.publish(context.Background(), e)
+}
+
+func (p *Publisher) OnDeleteCompany(e events.CompanyDeleted) error {
+	return p.publish(context.Background(), e)
+}
+
+// Subscribe adds subscriber of all company events, random secret is generated when secret is empty
+func (p *Publisher) Subscribe(ctx context.Context, url, secret string) (repositories.WebhookSubscription, error) {
+	if secret == "" {
+		var err error
+		if secret, err = newSecret(); err != nil {
+			return repositories.WebhookSubscription{}, err
+		}
+	}
+
+	return p.store.AddSubscription(ctx, repositories.WebhookSubscription{URL: url, Secret: secret})
+}
+
+func (p *Publisher) Subscriptions(ctx context.Context) ([]repositories.WebhookSubscription, error) {
+	return p.store.ListSubscriptions(ctx)
+}
+
+func (p *Publisher) Unsubscribe(ctx context.Context, id string) error {
+	return handleError(p.store.DeleteSubscription(ctx, id))
+}
+
+// Deliveries returns up to limit latest delivery attempts of the subscription from the newest one
+func (p *Publisher) Deliveries(ctx context.Context, subscriptionID string, limit int) ([]repositories.WebhookDelivery, error) {
+	if _, err := p.store.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, handleError(err)
+	}
+
+	return p.store.ListDeliveries(ctx, subscriptionID, limit)
+}
+
+// publish delivers the event as CloudEvent to all subscribers in parallel, it returns after all deliveries are done
+// or the delivery timeout is over
+func (p *Publisher) publish(ctx context.Context, e events.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, p.deliveryTimeout)
+	defer cancel()
+
+	subscriptions, err := p.store.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	event, err := events.ToCloudEvent(e)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(subscriptions))
+	for i, subscription := range subscriptions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = p.deliver(ctx, subscription, event, body)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// deliver sends the event to the subscriber until it is accepted or attempts are over
+func (p *Publisher) deliver(ctx context.Context, subscription repositories.WebhookSubscription, event events.CloudEvent, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= p.maxAttempts; attempt++ {
+		if attempt > 1 {
+			if sleepErr := p.sleep(ctx, backoff.Exponential(p.minBackoff, p.maxBackoff, attempt-1)); sleepErr != nil {
+				err = errors.Join(err, sleepErr)
+				break
+			}
+		}
+
+		var retry bool
+		if retry, err = p.attempt(ctx, subscription, event, body, attempt); err == nil || !retry {
+			break
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to deliver event %s to webhook %s: %w", event.ID, subscription.ID, err)
+	}
+
+	return nil
+}
+
+// attempt sends the request once and records the result, it reports whether failed request is worth retrying
+func (p *Publisher) attempt(ctx context.Context, subscription repositories.WebhookSubscription, event events.CloudEvent, body []byte, attempt int) (bool, error) {
+	start := p.now()
+	status, retry, err := p.send(ctx, subscription, event, body, start)
+
+	delivery := repositories.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Attempt:        attempt,
+		StatusCode:     status,
+		Timestamp:      start.UTC().Truncate(time.Millisecond),
+		Duration:       p.now().Sub(start),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	// the attempt stopped by the delivery timeout is recorded too
+	if err := p.store.AddDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		slog.Warn("failed to record webhook delivery", "subscription", subscription.ID, "event", event.ID, "error", err.Error())
+	}
+
+	return retry, err
+}
+
+func (p *Publisher) send(ctx context.Context, subscription repositories.WebhookSubscription, event events.CloudEvent, body []byte, at time.Time) (int, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	timestamp := at.Unix()
+	req.Header.Set("Content-Type", events.ContentType)
+	req.Header.Set(HeaderID, event.ID)
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // lets the connection be reused
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return resp.StatusCode, retry, errors.New("unexpected response status: " + resp.Status)
+}
+
+// Sign returns signature of the request body sent at the given unix time. Subscribers verify requests
+// by computing HMAC-SHA256 of "<timestamp>.<body>" with their secret and comparing it with X-Webhook-Signature
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+func handleError(err error) error {
+	if errors.As(err, &repositories.ErrNotFound{}) {
+		return errors.Join(ErrNotFound{}, err)
+	}
+
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
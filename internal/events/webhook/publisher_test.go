@@ -0,0 +1,254 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories"
+	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/repositories/memory"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
+	"github.com/AndreyShep2012/go-company-handler/internal/events/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublish(t *testing.T) {
+	t.Run("event is signed and delivered to every subscriber", func(t *testing.T) {
+		store := memory.NewWebhooksRepository()
+		publisher := webhook.NewPublisher(store)
+
+		first := newSubscriber(t)
+		second := newSubscriber(t)
+		firstSubscription, err := publisher.Subscribe(context.Background(), first.URL, "first")
+		require.NoError(t, err)
+		_, err = publisher.Subscribe(context.Background(), second.URL, "")
+		require.NoError(t, err)
+
+		created := events.CompanyCreated{Metadata: events.NewMetadata(), Company: events.Company{ID: "c", Name: "created"}}
+		require.NoError(t, publisher.OnCreateCompany(created))
+
+		require.Len(t, first.requests(), 1)
+		require.Len(t, second.requests(), 1)
+
+		req := first.requests()[0]
+		require.Equal(t, events.ContentType, req.header.Get("Content-Type"))
+		require.Equal(t, events.TypeCompanyCreated, req.header.Get(webhook.HeaderEvent))
+		timestamp, err := strconv.ParseInt(req.header.Get(webhook.HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, webhook.Sign("first", timestamp, req.body), req.header.Get(webhook.HeaderSignature))
+
+		var event events.CloudEvent
+		require.NoError(t, json.Unmarshal(req.body, &event))
+		require.Equal(t, created.ID, event.ID)
+		require.Equal(t, req.header.Get(webhook.HeaderID), event.ID)
+		require.Equal(t, events.TypeCompanyCreated, event.Type)
+		require.Equal(t, "c", event.Subject)
+
+		var data events.CompanyCreated
+		require.NoError(t, json.Unmarshal(event.Data, &data))
+		require.Equal(t, created.Company, data.Company)
+
+		// the other subscriber has its own generated secret
+		require.NotEqual(t, webhook.Sign("first", timestamp, req.body), second.requests()[0].header.Get(webhook.HeaderSignature))
+
+		deliveries, err := publisher.Deliveries(context.Background(), firstSubscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		require.Equal(t, event.ID, deliveries[0].EventID)
+		require.Equal(t, 1, deliveries[0].Attempt)
+		require.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+		require.Empty(t, deliveries[0].Error)
+	})
+
+	t.Run("failed delivery is retried with backoff", func(t *testing.T) {
+		store := memory.NewWebhooksRepository()
+		var delays []time.Duration
+		publisher := webhook.NewPublisher(store,
+			webhook.WithRetries(5, time.Second, 3*time.Second),
+			webhook.WithClock(time.Now, func(_ context.Context, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}),
+		)
+
+		subscriber := newSubscriber(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusInternalServerError)
+		subscription, err := publisher.Subscribe(context.Background(), subscriber.URL, "secret")
+		require.NoError(t, err)
+
+		require.NoError(t, publisher.OnDeleteCompany(events.CompanyDeleted{Metadata: events.NewMetadata(), CompanyID: "c"}))
+
+		// every attempt sends the same event
+		requests := subscriber.requests()
+		require.Len(t, requests, 4)
+		for _, req := range requests {
+			require.Equal(t, requests[0].header.Get(webhook.HeaderID), req.header.Get(webhook.HeaderID))
+			require.Equal(t, events.TypeCompanyDeleted, req.header.Get(webhook.HeaderEvent))
+		}
+		require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, delays)
+
+		deliveries, err := publisher.Deliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 4)
+		require.Equal(t, 4, deliveries[0].Attempt)
+		require.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+		require.Equal(t, 1, deliveries[3].Attempt)
+		require.Equal(t, http.StatusServiceUnavailable, deliveries[3].StatusCode)
+		require.Equal(t, "unexpected response status: 503 Service Unavailable", deliveries[3].Error)
+	})
+
+	t.Run("delivery fails when attempts are over", func(t *testing.T) {
+		store := memory.NewWebhooksRepository()
+		publisher := webhook.NewPublisher(store,
+			webhook.WithRetries(2, time.Second, time.Second),
+			webhook.WithClock(time.Now, func(context.Context, time.Duration) error { return nil }),
+		)
+
+		subscriber := newSubscriber(t, http.StatusBadGateway, http.StatusBadGateway)
+		healthy := newSubscriber(t)
+		_, err := publisher.Subscribe(context.Background(), subscriber.URL, "secret")
+		require.NoError(t, err)
+		_, err = publisher.Subscribe(context.Background(), healthy.URL, "secret")
+		require.NoError(t, err)
+
+		err = publisher.OnPatchCompany(events.CompanyUpdated{Metadata: events.NewMetadata(), Company: events.Company{ID: "c"}})
+		require.ErrorContains(t, err, "unexpected response status: 502 Bad Gateway")
+		require.Len(t, subscriber.requests(), 2)
+		require.Len(t, healthy.requests(), 1)
+	})
+
+	t.Run("retries are limited by delivery timeout", func(t *testing.T) {
+		store := memory.NewWebhooksRepository()
+		publisher := webhook.NewPublisher(store,
+			webhook.WithRetries(5, time.Minute, time.Minute),
+			webhook.WithDeliveryTimeout(50*time.Millisecond),
+		)
+
+		subscriber := newSubscriber(t, http.StatusServiceUnavailable)
+		subscription, err := publisher.Subscribe(context.Background(), subscriber.URL, "secret")
+		require.NoError(t, err)
+
+		start := time.Now()
+		err = publisher.OnDeleteCompany(events.CompanyDeleted{Metadata: events.NewMetadata(), CompanyID: "c"})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorContains(t, err, "unexpected response status: 503 Service Unavailable")
+		require.Less(t, time.Since(start), time.Second)
+		require.Len(t, subscriber.requests(), 1)
+
+		deliveries, err := publisher.Deliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		store := memory.NewWebhooksRepository()
+		publisher := webhook.NewPublisher(store, webhook.WithClock(time.Now, func(context.Context, time.Duration) error { return nil }))
+
+		subscriber := newSubscriber(t, http.StatusGone)
+		subscription, err := publisher.Subscribe(context.Background(), subscriber.URL, "secret")
+		require.NoError(t, err)
+
+		require.Error(t, publisher.OnPatchCompany(events.CompanyUpdated{Metadata: events.NewMetadata(), Company: events.Company{ID: "c"}}))
+		require.Len(t, subscriber.requests(), 1)
+
+		deliveries, err := publisher.Deliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+	})
+
+	t.Run("unavailable subscriber", func(t *testing.T) {
+		store := memory.NewWebhooksRepository()
+		publisher := webhook.NewPublisher(store,
+			webhook.WithRetries(2, time.Second, time.Second),
+			webhook.WithClock(time.Now, func(context.Context, time.Duration) error { return nil }),
+		)
+
+		subscriber := newSubscriber(t)
+		subscriber.Close()
+		subscription, err := publisher.Subscribe(context.Background(), subscriber.URL, "secret")
+		require.NoError(t, err)
+
+		require.Error(t, publisher.OnCreateCompany(events.CompanyCreated{Metadata: events.NewMetadata(), Company: events.Company{ID: "c"}}))
+
+		deliveries, err := publisher.Deliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+		require.Zero(t, deliveries[0].StatusCode)
+		require.NotEmpty(t, deliveries[0].Error)
+	})
+
+	t.Run("no subscribers", func(t *testing.T) {
+		publisher := webhook.NewPublisher(memory.NewWebhooksRepository())
+		require.NoError(t, publisher.OnCreateCompany(events.CompanyCreated{Metadata: events.NewMetadata(), Company: events.Company{ID: "c"}}))
+	})
+}
+
+func TestSubscriptions(t *testing.T) {
+	publisher := webhook.NewPublisher(memory.NewWebhooksRepository())
+
+	subscription, err := publisher.Subscribe(context.Background(), "http://localhost/hook", "")
+	require.NoError(t, err)
+	require.Len(t, subscription.Secret, 64)
+
+	subscriptions, err := publisher.Subscriptions(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []repositories.WebhookSubscription{subscription}, subscriptions)
+
+	require.NoError(t, publisher.Unsubscribe(context.Background(), subscription.ID))
+
+	err = publisher.Unsubscribe(context.Background(), subscription.ID)
+	require.ErrorAs(t, err, &webhook.ErrNotFound{})
+
+	_, err = publisher.Deliveries(context.Background(), subscription.ID, 10)
+	require.ErrorAs(t, err, &webhook.ErrNotFound{})
+}
+
+func TestSign(t *testing.T) {
+	// the signature can be checked with: printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	require.Equal(t, "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163", webhook.Sign("secret", 1700000000, []byte("{}")))
+}
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// subscriber responds with the given statuses one by one and with 200 when they are over
+type subscriber struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	received []request
+}
+
+func newSubscriber(t *testing.T, statuses ...int) *subscriber {
+	s := &subscriber{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.received = append(s.received, request{header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *subscriber) requests() []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.received
+}
@@ -0,0 +1,29 @@
+package reqctx
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor returns context which carries the user who performs the request
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the user who performs the request or empty string if it is unknown
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns context which carries id of the request
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns id of the request or empty string if it is unknown
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
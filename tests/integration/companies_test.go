@@ -1,15 +1,19 @@
 package integration
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/AndreyShep2012/go-company-handler/internal/app/v1/handlers"
+	"github.com/AndreyShep2012/go-company-handler/internal/events"
 	"github.com/go-faker/faker/v4"
 	"github.com/go-faker/faker/v4/pkg/options"
 	"github.com/golang-jwt/jwt"
@@ -57,9 +61,14 @@ func TestCreateCompany(t *testing.T) {
 		AmountOfEmployees: 100,
 		Registered:        true,
 		Type:              "Sole Proprietorship",
+		CreatedAt:         res.CreatedAt,
+		CreatedBy:         "test",
+		UpdatedAt:         res.CreatedAt,
+		UpdatedBy:         "test",
 	}
 
 	require.Equal(t, expectedResponse, res)
+	require.False(t, res.CreatedAt.IsZero())
 
 	// try one more time to check unique of company name
 	req, err = http.NewRequest("POST", createRequestUrl(testConf.ListenAddr, "/companies/create"), bytes.NewReader([]byte(createBody)))
@@ -74,6 +83,110 @@ func TestCreateCompany(t *testing.T) {
 	require.Equal(t, http.StatusConflict, resp.StatusCode)
 }
 
+func TestBulkCreateCompanies(t *testing.T) {
+	client := &http.Client{}
+
+	var name string
+	require.NoError(t, faker.FakeData(&name, options.WithRandomStringLength(10)))
+
+	body := fmt.Sprintf(`[
+		{"name":"%[1]s","amount_of_employees":10,"registered":true,"type":"Corporations"},
+		{"name":"%[1]s","amount_of_employees":10,"registered":true,"type":"Corporations"},
+		{"name":"%[1]s","amount_of_employees":10,"type":"Corporations"}
+	]`, name)
+
+	req, err := http.NewRequest("POST", createRequestUrl(testConf.ListenAddr, "/companies/bulk"), bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var res handlers.BulkCreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.Len(t, res.Results, 3)
+	require.Equal(t, handlers.BulkStatusCreated, res.Results[0].Status)
+	require.Equal(t, name, res.Results[0].Company.Name)
+	require.Equal(t, handlers.BulkStatusDuplicate, res.Results[1].Status)
+	require.Equal(t, handlers.BulkStatusInvalid, res.Results[2].Status)
+}
+
+func TestImportCompanies(t *testing.T) {
+	client := &http.Client{}
+
+	var name string
+	require.NoError(t, faker.FakeData(&name, options.WithRandomStringLength(10)))
+
+	doImport := func(query, contentType, body string) handlers.ImportResponse {
+		req, err := http.NewRequest("POST", createRequestUrl(testConf.ListenAddr, "/companies/import"+query), bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var res handlers.ImportResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res
+	}
+
+	csvBody := fmt.Sprintf("name,amount_of_employees,registered,type\n%s,10,true,Corporations\n%s,10,true,Unknown\n", name, name)
+
+	res := doImport("?dry_run=true", "text/csv", csvBody)
+	require.Equal(t, 2, res.Total)
+	require.Equal(t, 1, res.Valid)
+	require.Zero(t, res.Created)
+	require.Len(t, res.Errors, 1)
+	require.Equal(t, 3, res.Errors[0].Line)
+
+	res = doImport("", "text/csv", csvBody)
+	require.Equal(t, 1, res.Created)
+
+	ndjsonBody := fmt.Sprintf(`{"name":"%s","amount_of_employees":20,"registered":false,"type":"NonProfit"}`, name)
+
+	res = doImport("", "application/x-ndjson", ndjsonBody)
+	require.Zero(t, res.Created)
+	require.Equal(t, handlers.BulkStatusDuplicate, res.Errors[0].Status)
+
+	res = doImport("?mode=upsert", "application/x-ndjson", ndjsonBody)
+	require.Equal(t, 1, res.Updated)
+	require.Empty(t, res.Errors)
+}
+
+func TestExportCompanies(t *testing.T) {
+	client := &http.Client{}
+
+	id := createCompany(t)
+
+	req, err := http.NewRequest("GET", createRequestUrl(testConf.ListenAddr, "/companies/export?format=ndjson&type=Sole%20Proprietorship"), nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	found := false
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var company handlers.Company
+		require.NoError(t, decoder.Decode(&company))
+		require.Equal(t, "Sole Proprietorship", company.Type)
+		found = found || company.ID == id
+	}
+	require.True(t, found)
+}
+
 func TestGetCompany(t *testing.T) {
 	client := &http.Client{}
 
@@ -102,11 +215,82 @@ func TestGetCompany(t *testing.T) {
 		AmountOfEmployees: 100,
 		Registered:        true,
 		Type:              "Sole Proprietorship",
+		CreatedAt:         res.CreatedAt,
+		CreatedBy:         "test",
+		UpdatedAt:         res.CreatedAt,
+		UpdatedBy:         "test",
 	}
 
 	require.Equal(t, expectedResponse, res)
 }
 
+func TestListCompanies(t *testing.T) {
+	client := &http.Client{}
+
+	createCompany(t)
+	createCompany(t)
+
+	listPage := func(url string) handlers.ListCompaniesResponse {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		bodyBytes, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		var res handlers.ListCompaniesResponse
+		err = json.Unmarshal(bodyBytes, &res)
+		require.NoError(t, err)
+
+		return res
+	}
+
+	first := listPage(createRequestUrl(testConf.ListenAddr, "/companies?limit=1"))
+	require.Len(t, first.Companies, 1)
+	require.NotEmpty(t, first.NextCursor)
+
+	second := listPage(createRequestUrl(testConf.ListenAddr, "/companies?limit=1&cursor="+first.NextCursor))
+	require.Len(t, second.Companies, 1)
+	require.NotEqual(t, first.Companies[0].ID, second.Companies[0].ID)
+}
+
+func TestSearchCompanies(t *testing.T) {
+	client := &http.Client{}
+
+	id := createCompany(t)
+
+	// get company to know generated name
+	req, err := http.NewRequest("GET", createRequestUrl(testConf.ListenAddr, "/companies/"+id), nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var company handlers.Company
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&company))
+
+	req, err = http.NewRequest("GET", createRequestUrl(testConf.ListenAddr, "/companies/search?q="+company.Name), nil)
+	require.NoError(t, err)
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var res handlers.SearchCompaniesResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NotEmpty(t, res.Results)
+	require.Equal(t, company, res.Results[0].Company)
+	require.Equal(t, "<em>"+company.Name+"</em>", res.Results[0].Highlights["name"])
+}
+
 func TestDeleteCompany(t *testing.T) {
 	client := &http.Client{}
 
@@ -131,6 +315,53 @@ func TestDeleteCompany(t *testing.T) {
 	resp.Body.Close()
 
 	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// delete one more time
+	req, err = http.NewRequest("DELETE", createRequestUrl(testConf.ListenAddr, "/companies/"+id), nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRestoreCompany(t *testing.T) {
+	client := &http.Client{}
+
+	id := createCompany(t)
+
+	req, err := http.NewRequest("DELETE", createRequestUrl(testConf.ListenAddr, "/companies/"+id), nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	req, err = http.NewRequest("POST", createRequestUrl(testConf.ListenAddr, "/companies/"+id+"/restore"), nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// get company
+	req, err = http.NewRequest("GET", createRequestUrl(testConf.ListenAddr, "/companies/"+id), nil)
+	require.NoError(t, err)
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
 func TestUpdateCompany(t *testing.T) {
@@ -186,9 +417,217 @@ func TestUpdateCompany(t *testing.T) {
 		AmountOfEmployees: 10,
 		Registered:        false,
 		Type:              "Corporations",
+		CreatedAt:         res.CreatedAt,
+		CreatedBy:         "test",
+		UpdatedAt:         res.UpdatedAt,
+		UpdatedBy:         "test",
 	}
 
 	require.Equal(t, expectedResponse, res)
+	require.False(t, res.UpdatedAt.Before(res.CreatedAt))
+}
+
+func TestUpdateCompanyIfMatch(t *testing.T) {
+	client := &http.Client{}
+
+	id := createCompany(t)
+
+	req, err := http.NewRequest("GET", createRequestUrl(testConf.ListenAddr, "/companies/"+id), nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	var newName string
+	require.NoError(t, faker.FakeData(&newName, options.WithRandomStringLength(10)))
+
+	patchBody := fmt.Sprintf(`{
+		"name":"%s",
+		"amount_of_employees":10,
+		"registered":false,
+		"type":"Corporations"
+	}`, newName)
+
+	patch := func(ifMatch string) int {
+		req, err := http.NewRequest("PATCH", createRequestUrl(testConf.ListenAddr, "/companies/"+id), bytes.NewReader([]byte(patchBody)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusNoContent, patch(etag))
+	// the same entity tag is stale after the first update
+	require.Equal(t, http.StatusPreconditionFailed, patch(etag))
+}
+
+func TestCompanyHistory(t *testing.T) {
+	client := &http.Client{}
+
+	id := createCompany(t)
+
+	req, err := http.NewRequest("DELETE", createRequestUrl(testConf.ListenAddr, "/companies/"+id), nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	req, err = http.NewRequest("GET", createRequestUrl(testConf.ListenAddr, "/companies/"+id+"/history"), nil)
+	require.NoError(t, err)
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var res handlers.HistoryResponse
+	err = json.Unmarshal(bodyBytes, &res)
+	require.NoError(t, err)
+
+	require.Len(t, res.Entries, 2)
+	require.Equal(t, "create", res.Entries[0].Action)
+	require.NotEmpty(t, res.Entries[0].RequestID)
+	require.NotEmpty(t, res.Entries[0].Changes)
+	require.Equal(t, "delete", res.Entries[1].Action)
+}
+
+func TestGetCompanyAsOf(t *testing.T) {
+	client := &http.Client{}
+
+	id := createCompany(t)
+	createdAt := time.Now().UTC()
+
+	// history keeps milliseconds, so let the update happen after the moment taken above
+	time.Sleep(10 * time.Millisecond)
+
+	patchBody := `{
+		"name":"%s",
+		"amount_of_employees":10,
+		"registered":false,
+		"type":"Corporations"
+	}`
+
+	var newName string
+	require.NoError(t, faker.FakeData(&newName, options.WithRandomStringLength(10)))
+
+	req, err := http.NewRequest("PATCH", createRequestUrl(testConf.ListenAddr, "/companies/"+id), bytes.NewReader([]byte(fmt.Sprintf(patchBody, newName))))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	getAsOf := func(asOf time.Time) (int, handlers.Company) {
+		req, err := http.NewRequest("GET", createRequestUrl(testConf.ListenAddr, "/companies/"+id+"?as_of="+url.QueryEscape(asOf.Format(time.RFC3339Nano))), nil)
+		require.NoError(t, err)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var res handlers.Company
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		}
+
+		return resp.StatusCode, res
+	}
+
+	status, company := getAsOf(createdAt)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, 100, company.AmountOfEmployees)
+	require.Equal(t, "Sole Proprietorship", company.Type)
+
+	status, company = getAsOf(time.Now().UTC())
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, newName, company.Name)
+
+	status, _ = getAsOf(createdAt.Add(-time.Hour))
+	require.Equal(t, http.StatusNotFound, status)
+}
+
+func TestCompanyEventsStream(t *testing.T) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	openStream := func(lastEventID string) (*http.Response, *bufio.Scanner) {
+		req, err := http.NewRequest("GET", createRequestUrl(testConf.ListenAddr, "/companies/events?type="+url.QueryEscape("Sole Proprietorship")), nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		return resp, bufio.NewScanner(resp.Body)
+	}
+
+	// nextEvent returns id and type of the next event of the company in the stream
+	nextEvent := func(scanner *bufio.Scanner, companyID string) (string, string) {
+		var id string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				var event events.CloudEvent
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+				if event.Subject == companyID {
+					require.Equal(t, id, event.ID)
+					return event.ID, event.Type
+				}
+			}
+		}
+
+		require.Fail(t, "stream is closed", scanner.Err())
+		return "", ""
+	}
+
+	resp, scanner := openStream("")
+	id := createCompany(t)
+	createdID, eventType := nextEvent(scanner, id)
+	require.Equal(t, events.TypeCompanyCreated, eventType)
+	resp.Body.Close()
+
+	req, err := http.NewRequest("DELETE", createRequestUrl(testConf.ListenAddr, "/companies/"+id), nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", createToken(t, "test", []byte(testConf.JWTSecretKey)))
+	deleteResp, err := client.Do(req)
+	require.NoError(t, err)
+	deleteResp.Body.Close()
+	require.Equal(t, http.StatusNoContent, deleteResp.StatusCode)
+
+	// the event published while disconnected is sent on resume
+	resp, scanner = openStream(createdID)
+	defer resp.Body.Close()
+	_, eventType = nextEvent(scanner, id)
+	require.Equal(t, events.TypeCompanyDeleted, eventType)
 }
 
 func createCompany(t *testing.T) string {
@@ -240,6 +679,7 @@ func createToken(t *testing.T, username string, secretKey []byte) string {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
 		jwt.MapClaims{
 			"username": username,
+			"sub":      username,
 			"exp":      time.Now().Add(time.Hour * 24).Unix(),
 		})
 